@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Typed decoding of the v1 account answers: the answers are decoded in place into structures,
+// instead of generic maps and slices of interfaces, the worker lists of large accounts (thousands
+// of workers) otherwise allocating several values per worker at every scrape.
+// The answer is valid JSON when UnmarshalJSON is called, it is split into its elements without
+// being decoded again
+
+type AccountWorker struct {
+	Name                        string
+	Hashrate                    float64
+	HashesLastHour              float64
+	StaleHashesRejectedLastHour float64
+	HashesLastDay               float64
+	StaleHashesRejectedLastDay  float64
+	LastShare                   string
+	// Hashrate reported by the mining software, for the tuples with the field
+	LocalHashrate    float64
+	HasLocalHashrate bool
+	// Count of elements of the tuple
+	Fields int
+}
+
+type AccountInfo struct {
+	Balance                     float64
+	Paid                        float64
+	Value                       float64
+	ValueLastDay                float64
+	Hashrate                    float64
+	HashesLastHour              float64
+	StaleHashesRejectedLastHour float64
+	HashesLastDay               float64
+	StaleHashesRejectedLastDay  float64
+	Workers                     []AccountWorker
+	// Most recent point of the hashrate history, nil if none
+	LastUpdate *time.Time
+	// Fields unknown to the exporter
+	UnknownFields []string
+	// Metrics specific to the backend the account is retrieved with
+	Metrics []prometheus.Metric
+	// Set before decoding to skip the workers
+	SkipWorkers bool
+}
+
+// Fields of the worker tuples
+const (
+	workerName = iota
+	workerHashrate
+	workerHashesLastHour
+	workerStaleHashesRejectedLastHour
+	workerHashesLastDay
+	workerStaleHashesRejectedLastDay
+	workerLastShare
+	workerLocalHashrate
+)
+
+// Fields of the worker tuples by position, for each tuple length (schema) answered by the API:
+// name, hashrate, hashes and stale hashes of last hour, hashes and stale hashes of last 24 hours,
+// then last share time and local hashrate in the longer ones. Tuples longer than the longest
+// schema are decoded with it, their extra values being ignored (and reported as unknown fields)
+var workerTupleSchemas = map[int][]int{
+	6: {workerName, workerHashrate, workerHashesLastHour, workerStaleHashesRejectedLastHour, workerHashesLastDay, workerStaleHashesRejectedLastDay},
+	7: {workerName, workerHashrate, workerHashesLastHour, workerStaleHashesRejectedLastHour, workerHashesLastDay, workerStaleHashesRejectedLastDay, workerLastShare},
+	8: {workerName, workerHashrate, workerHashesLastHour, workerStaleHashesRejectedLastHour, workerHashesLastDay, workerStaleHashesRejectedLastDay, workerLastShare, workerLocalHashrate},
+}
+
+// Lengths of the shortest and longest worker tuple schemas
+var minWorkerTuple, maxWorkerTuple = 6, 8
+
+// workerTupleSchema returns the fields of a tuple of the given length, nil if too short
+func workerTupleSchema(length int) []int {
+	if length > maxWorkerTuple {
+		length = maxWorkerTuple
+	}
+	for ; length >= minWorkerTuple; length-- {
+		if schema, ok := workerTupleSchemas[length]; ok {
+			return schema
+		}
+	}
+	return nil
+}
+
+// Workers are arrays, whose fields are mapped by their schema
+func (w *AccountWorker) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '[' {
+		return errors.New("not an array")
+	}
+	w.Fields = 0
+	eachJsonElement(data, func(_ []byte, _ []byte) error {
+		w.Fields++
+		return nil
+	})
+	schema := workerTupleSchema(w.Fields)
+	if schema == nil {
+		return fmt.Errorf("%d fields instead of at least %d", w.Fields, minWorkerTuple)
+	}
+
+	index := 0
+	return eachJsonElement(data, func(_ []byte, value []byte) error {
+		if index >= len(schema) {
+			return nil
+		}
+		var err error
+		switch schema[index] {
+		case workerName:
+			w.Name, err = jsonString(value)
+		case workerHashrate:
+			w.Hashrate, err = jsonNumber(value)
+		case workerHashesLastHour:
+			w.HashesLastHour, err = jsonNumber(value)
+		case workerStaleHashesRejectedLastHour:
+			w.StaleHashesRejectedLastHour, err = jsonNumber(value)
+		case workerHashesLastDay:
+			w.HashesLastDay, err = jsonNumber(value)
+		case workerStaleHashesRejectedLastDay:
+			w.StaleHashesRejectedLastDay, err = jsonNumber(value)
+		case workerLastShare:
+			w.LastShare, err = jsonShareTime(value)
+		case workerLocalHashrate:
+			w.LocalHashrate, err = jsonNumber(value)
+			w.HasLocalHashrate = err == nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid field %d", index)
+		}
+		index++
+		return nil
+	})
+}
+
+func (a *AccountInfo) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '{' {
+		return errors.New("not an object")
+	}
+	numbers := map[string]*float64{
+		"balance":                         &a.Balance,
+		"paid":                            &a.Paid,
+		"value":                           &a.Value,
+		"value_last_day":                  &a.ValueLastDay,
+		"hashrate":                        &a.Hashrate,
+		"hashes_last_hour":                &a.HashesLastHour,
+		"stale_hashes_rejected_last_hour": &a.StaleHashesRejectedLastHour,
+		"hashes_last_day":                 &a.HashesLastDay,
+		"stale_hashes_rejected_last_day":  &a.StaleHashesRejectedLastDay,
+	}
+	ignored := map[string]bool{}
+	for _, field := range accountPayloadIgnoredFields {
+		ignored[field] = true
+	}
+
+	found := map[string]bool{}
+	workers := false
+	err := eachJsonElement(data, func(key []byte, value []byte) error {
+		field, err := jsonString(key)
+		if err != nil {
+			return err
+		}
+		if number, ok := numbers[field]; ok {
+			if *number, err = jsonNumber(value); err != nil {
+				return fmt.Errorf("missing or non-numeric %s", field)
+			}
+			found[field] = true
+			return nil
+		}
+		switch {
+		case field == "workers":
+			if value[0] != '[' {
+				return errors.New("missing or invalid workers")
+			}
+			workers = true
+			if a.SkipWorkers {
+				return nil
+			}
+			return a.unmarshalWorkers(value)
+		case field == "hashrate_history":
+			a.LastUpdate = lastHistoryTime(value)
+		case !ignored[field]:
+			a.UnknownFields = append(a.UnknownFields, field)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, field := range accountPayloadFields {
+		if !found[field] {
+			return fmt.Errorf("missing or non-numeric %s", field)
+		}
+	}
+	if !workers {
+		return errors.New("missing or invalid workers")
+	}
+	sort.Strings(a.UnknownFields)
+	return nil
+}
+
+// Decodes the workers in a slice allocated once, from their count
+func (a *AccountInfo) unmarshalWorkers(data []byte) error {
+	count := 0
+	eachJsonElement(data, func(_ []byte, _ []byte) error {
+		count++
+		return nil
+	})
+	a.Workers = make([]AccountWorker, count)
+	index, fields := 0, 0
+	err := eachJsonElement(data, func(_ []byte, value []byte) error {
+		if err := a.Workers[index].UnmarshalJSON(value); err != nil {
+			return fmt.Errorf("invalid worker %d: %w", index, err)
+		}
+		if a.Workers[index].Fields > fields {
+			fields = a.Workers[index].Fields
+		}
+		index++
+		return nil
+	})
+	// Positions of the tuples unknown to the exporter
+	for position := maxWorkerTuple; position < fields; position++ {
+		a.UnknownFields = append(a.UnknownFields, "workers."+strconv.Itoa(position))
+	}
+	return err
+}
+
+// The hashrate history is an object of hashrates by RFC 3339 time
+func lastHistoryTime(data []byte) *time.Time {
+	var last *time.Time
+	eachJsonElement(data, func(key []byte, _ []byte) error {
+		date, err := jsonString(key)
+		if err != nil {
+			return nil
+		}
+		if t, err := time.Parse(time.RFC3339, date); err == nil && (last == nil || t.After(*last)) {
+			last = &t
+		}
+		return nil
+	})
+	return last
+}
+
+// Calls fn for every element of a valid JSON array or object, with its key for objects. The
+// elements are the raw JSON values, sub-slices of the data
+func eachJsonElement(data []byte, fn func(key []byte, value []byte) error) error {
+	depth, inString, escaped := 0, false, false
+	start, colon := -1, -1
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+			if depth == 1 {
+				start = i + 1
+				continue
+			}
+		case ']', '}':
+			depth--
+		}
+		if depth == 1 && c == ':' {
+			colon = i
+		}
+		if (depth == 1 && c == ',') || depth == 0 {
+			key, value := []byte(nil), trimJsonSpace(data[start:i])
+			if colon != -1 {
+				key, value = trimJsonSpace(data[start:colon]), trimJsonSpace(data[colon+1:i])
+			}
+			if len(value) != 0 {
+				if err := fn(key, value); err != nil {
+					return err
+				}
+			}
+			start, colon = i+1, -1
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func trimJsonSpace(data []byte) []byte {
+	for len(data) != 0 && isJsonSpace(data[0]) {
+		data = data[1:]
+	}
+	for len(data) != 0 && isJsonSpace(data[len(data)-1]) {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+func isJsonSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Value of a JSON string, strings with escapes being decoded by encoding/json
+func jsonString(data []byte) (string, error) {
+	if len(data) < 2 || data[0] != '"' {
+		return "", errors.New("not a string")
+	}
+	for _, c := range data {
+		if c == '\\' {
+			var value string
+			err := json.Unmarshal(data, &value)
+			return value, err
+		}
+	}
+	return string(data[1 : len(data)-1]), nil
+}
+
+// Text of a last share time, given as a string or as a number (epoch times), parsed with the share
+// time layouts. Null and 0 are no last share
+func jsonShareTime(data []byte) (string, error) {
+	if string(data) == "null" {
+		return "", nil
+	}
+	if len(data) != 0 && data[0] == '"' {
+		return jsonString(data)
+	}
+	number, err := jsonNumber(data)
+	if err != nil || number == 0 {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func jsonNumber(data []byte) (float64, error) {
+	if len(data) == 0 || (data[0] != '-' && (data[0] < '0' || data[0] > '9')) {
+		return 0, errors.New("not a number")
+	}
+	return strconv.ParseFloat(string(data), 64)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccountWorkerUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    AccountWorker
+		wantErr bool
+	}{
+		{
+			name: "6 fields",
+			data: `["rig-1", 100, 3600, 36, 86400, 864]`,
+			want: AccountWorker{Name: "rig-1", Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, Fields: 6},
+		},
+		{
+			name: "7 fields, string last share",
+			data: `["rig-1", 100, 3600, 36, 86400, 864, "2024-01-02T03:04:05Z"]`,
+			want: AccountWorker{Name: "rig-1", Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, LastShare: "2024-01-02T03:04:05Z", Fields: 7},
+		},
+		{
+			name: "7 fields, numeric last share",
+			data: `["rig-1", 100, 3600, 36, 86400, 864, 1704164645]`,
+			want: AccountWorker{Name: "rig-1", Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, LastShare: "1704164645", Fields: 7},
+		},
+		{
+			name: "7 fields, null last share",
+			data: `["rig-1", 0, 0, 0, 0, 0, null]`,
+			want: AccountWorker{Name: "rig-1", Fields: 7},
+		},
+		{
+			name: "7 fields, zero last share",
+			data: `["rig-1", 0, 0, 0, 0, 0, 0]`,
+			want: AccountWorker{Name: "rig-1", Fields: 7},
+		},
+		{
+			name: "8 fields",
+			data: `["rig-1", 100, 3600, 36, 86400, 864, "2024-01-02T03:04:05Z", 110]`,
+			want: AccountWorker{Name: "rig-1", Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, LastShare: "2024-01-02T03:04:05Z", LocalHashrate: 110, HasLocalHashrate: true, Fields: 8},
+		},
+		{
+			name: "extra fields ignored",
+			data: `["rig-1", 100, 3600, 36, 86400, 864, "2024-01-02T03:04:05Z", 110, "extra"]`,
+			want: AccountWorker{Name: "rig-1", Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, LastShare: "2024-01-02T03:04:05Z", LocalHashrate: 110, HasLocalHashrate: true, Fields: 9},
+		},
+		{
+			name: "escaped name",
+			data: `["rig \"1\"", 100, 3600, 36, 86400, 864]`,
+			want: AccountWorker{Name: `rig "1"`, Hashrate: 100, HashesLastHour: 3600, StaleHashesRejectedLastHour: 36, HashesLastDay: 86400, StaleHashesRejectedLastDay: 864, Fields: 6},
+		},
+		{name: "too short", data: `["rig-1", 100, 3600, 36, 86400]`, wantErr: true},
+		{name: "not an array", data: `{"name": "rig-1"}`, wantErr: true},
+		{name: "invalid last share", data: `["rig-1", 100, 3600, 36, 86400, 864, true]`, wantErr: true},
+		{name: "non-numeric hashrate", data: `["rig-1", "100", 3600, 36, 86400, 864]`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var worker AccountWorker
+			err := worker.UnmarshalJSON([]byte(test.data))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalJSON(%s) = nil error, want an error", test.data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalJSON(%s) error: %v", test.data, err)
+			}
+			if !reflect.DeepEqual(worker, test.want) {
+				t.Errorf("UnmarshalJSON(%s) = %+v, want %+v", test.data, worker, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountInfoUnmarshalJSON(t *testing.T) {
+	const values = `"balance": 1, "paid": 2, "value": 3, "value_last_day": 4, "hashrate": 5, "hashes_last_hour": 6,
+		"hashes_last_day": 7, "stale_hashes_rejected_last_hour": 8, "stale_hashes_rejected_last_day": 9`
+	tests := []struct {
+		name          string
+		data          string
+		skipWorkers   bool
+		workers       []string
+		unknownFields []string
+		wantErr       bool
+	}{
+		{
+			name:    "workers of every schema",
+			data:    `{` + values + `, "workers": [["a", 1, 2, 3, 4, 5], ["b", 1, 2, 3, 4, 5, 1704164645], ["c", 1, 2, 3, 4, 5, "2024-01-02T03:04:05Z", 6]]}`,
+			workers: []string{"a", "b", "c"},
+		},
+		{
+			name:          "unknown fields",
+			data:          `{` + values + `, "worker_length": 1, "new_field": 1, "workers": [["a", 1, 2, 3, 4, 5, "", 6, 7]]}`,
+			workers:       []string{"a"},
+			unknownFields: []string{"new_field", "workers.8"},
+		},
+		{
+			name:        "skipped workers",
+			data:        `{` + values + `, "workers": [["a", 1, 2, 3, 4, 5]]}`,
+			skipWorkers: true,
+		},
+		{name: "missing value", data: `{"balance": 1, "workers": []}`, wantErr: true},
+		{name: "missing workers", data: `{` + values + `}`, wantErr: true},
+		{name: "invalid worker", data: `{` + values + `, "workers": [["a", 1]]}`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := AccountInfo{SkipWorkers: test.skipWorkers}
+			err := info.UnmarshalJSON([]byte(test.data))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalJSON = nil error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalJSON error: %v", err)
+			}
+			if info.Balance != 1 || info.StaleHashesRejectedLastDay != 9 {
+				t.Errorf("UnmarshalJSON values = %+v", info)
+			}
+			workers := []string{}
+			for _, worker := range info.Workers {
+				workers = append(workers, worker.Name)
+			}
+			if len(workers) != len(test.workers) || (len(workers) != 0 && !reflect.DeepEqual(workers, test.workers)) {
+				t.Errorf("UnmarshalJSON workers = %v, want %v", workers, test.workers)
+			}
+			if !reflect.DeepEqual(info.UnknownFields, test.unknownFields) {
+				t.Errorf("UnmarshalJSON unknown fields = %v, want %v", info.UnknownFields, test.unknownFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// Account-only resources: the workers of the resources configured as account_only (by
+// {currency}/{account} or currency) are neither retrieved (v2 backend) nor decoded (v1 backend) nor
+// exported, for the wallets whose balance and revenue only matter, saving the decoding of large
+// worker lists
+
+// AccountOnlyFor returns whether only the account-level values of a resource are collected
+func (c *Config) AccountOnlyFor(currency string, user string) bool {
+	for _, resource := range c.AccountOnly {
+		if resource == currency+"/"+user || resource == currency {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Built-in alerting, for exporters running without Prometheus/Alertmanager: rules are evaluated
+// on the collected data and alerts are sent to the configured notification channels
+
+type AlertsConfig struct {
+	Interval Duration `json:"interval"`
+	// Webhook the alerts are posted to as JSON
+	WebhookUrl string `json:"webhook_url"`
+	// Alertmanager the alerts are posted to
+	AlertmanagerUrl string `json:"alertmanager_url"`
+	// Email the alerts are sent to
+	Smtp  *SmtpConfig `json:"smtp"`
+	Rules []AlertRule `json:"rules"`
+}
+
+// AlertRule types:
+//
+//	worker_offline: a worker has no hashrate (or no share) for more than Minutes
+//	hashrate_drop: the account hashrate is more than Percent under its 24 hours average
+//	payout: a payout was received (the paid amount increased)
+//	reject_rate_high: the stale rejected ratio of the last hour of a worker is over --reject-rate-threshold
+//
+// Currency and Account restrict the rule to matching resources
+type AlertRule struct {
+	Type     string  `json:"type"`
+	Minutes  float64 `json:"minutes"`
+	Percent  float64 `json:"percent"`
+	Currency string  `json:"currency"`
+	Account  string  `json:"account"`
+}
+
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Status   string    `json:"status"`
+	Currency string    `json:"currency"`
+	Account  string    `json:"account"`
+	Worker   string    `json:"worker,omitempty"`
+	Message  string    `json:"message"`
+	Value    float64   `json:"value"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at,omitempty"`
+}
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+func (a *Alert) key() string {
+	return a.Rule + "/" + a.Currency + "/" + a.Account + "/" + a.Worker
+}
+
+type Notifier interface {
+	Notify(alert *Alert) error
+}
+
+// Notifiers which are also given the firing alerts after each evaluation
+type RepeatNotifier interface {
+	Repeat(alerts []*Alert) error
+}
+
+type WebhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (n *WebhookNotifier) Notify(alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+type Alerter struct {
+	exporter  *F2PoolExporter
+	config    *AlertsConfig
+	notifiers []Notifier
+	active    map[string]*Alert
+	// Time each worker (by resource/worker) was first seen without hashrate
+	offlineSince map[string]time.Time
+	// Last paid amount of each resource
+	paid map[string]float64
+}
+
+func NewAlerter(exporter *F2PoolExporter, config *AlertsConfig, client *http.Client) *Alerter {
+	alerter := &Alerter{
+		exporter:     exporter,
+		config:       config,
+		active:       map[string]*Alert{},
+		offlineSince: map[string]time.Time{},
+		paid:         map[string]float64{},
+	}
+	if len(config.WebhookUrl) != 0 {
+		alerter.notifiers = append(alerter.notifiers, &WebhookNotifier{client: client, url: config.WebhookUrl})
+	}
+	if len(config.AlertmanagerUrl) != 0 {
+		alerter.notifiers = append(alerter.notifiers, NewAlertmanagerNotifier(client, config.AlertmanagerUrl))
+	}
+	if config.Smtp != nil {
+		alerter.notifiers = append(alerter.notifiers, &SmtpNotifier{config: config.Smtp})
+	}
+	return alerter
+}
+
+// Run evaluates the rules every interval (1 minute by default) on the snapshots of the last
+// collection, it never returns. A collection is only run when nothing collected the data during the
+// interval (no scrape), the API calls and the trackers of the scrapes being otherwise doubled
+func (a *Alerter) Run() {
+	interval := a.config.Interval.Duration
+	if interval == 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if updatedAt, ok := a.exporter.snapshots.UpdatedAt(); !ok || time.Since(updatedAt) >= interval {
+			a.exporter.Refresh()
+		}
+		a.Evaluate(time.Now())
+		<-ticker.C
+	}
+}
+
+func (a *Alerter) Evaluate(now time.Time) {
+	firing := map[string]*Alert{}
+	snapshots := a.exporter.snapshots.All()
+	a.prune(snapshots)
+	for _, snapshot := range snapshots {
+		for _, rule := range a.config.Rules {
+			if !rule.matches(snapshot) {
+				continue
+			}
+			for _, alert := range a.evaluateRule(&rule, snapshot, now) {
+				firing[alert.key()] = alert
+			}
+		}
+	}
+
+	for key, alert := range firing {
+		if _, ok := a.active[key]; ok {
+			continue
+		}
+		alert.Status = AlertFiring
+		a.notify(alert)
+		// Payouts are events, they are not resolved
+		if alert.Rule != "payout" {
+			a.active[key] = alert
+		}
+	}
+	for key, alert := range a.active {
+		if _, ok := firing[key]; ok {
+			continue
+		}
+		alert.Status = AlertResolved
+		alert.EndsAt = now
+		a.notify(alert)
+		delete(a.active, key)
+	}
+
+	active := []*Alert{}
+	for _, alert := range a.active {
+		active = append(active, alert)
+	}
+	for _, notifier := range a.notifiers {
+		if repeater, ok := notifier.(RepeatNotifier); ok {
+			if err := repeater.Repeat(active); err != nil {
+				log.Println("Error sending firing alerts:", err)
+			}
+		}
+	}
+}
+
+// Forgets the workers and resources which are not collected anymore
+func (a *Alerter) prune(snapshots []*AccountSnapshot) {
+	resources := map[string]bool{}
+	workers := map[string]bool{}
+	for _, snapshot := range snapshots {
+		resource := snapshot.Currency + "/" + snapshot.Account
+		resources[resource] = true
+		for _, worker := range snapshot.Workers {
+			workers[resource+"/"+worker.Name] = true
+		}
+	}
+	for key := range a.offlineSince {
+		if !workers[key] {
+			delete(a.offlineSince, key)
+		}
+	}
+	for resource := range a.paid {
+		if !resources[resource] {
+			delete(a.paid, resource)
+		}
+	}
+}
+
+// Validates the types of the rules and their thresholds, when the configuration is loaded
+func validateAlertRules(rules []AlertRule) error {
+	for i, rule := range rules {
+		switch rule.Type {
+		case "worker_offline":
+			if rule.Minutes <= 0 {
+				return fmt.Errorf("alert rule %d (worker_offline) requires minutes", i)
+			}
+		case "hashrate_drop":
+			if rule.Percent <= 0 || rule.Percent > 100 {
+				return fmt.Errorf("alert rule %d (hashrate_drop) requires a percent between 0 and 100", i)
+			}
+		case "payout", "reject_rate_high":
+		default:
+			return fmt.Errorf("unknown alert rule type %q", rule.Type)
+		}
+	}
+	return nil
+}
+
+func (r *AlertRule) matches(snapshot *AccountSnapshot) bool {
+	return (len(r.Currency) == 0 || strings.EqualFold(r.Currency, snapshot.Currency)) &&
+		(len(r.Account) == 0 || AccountLabel(r.Account) == snapshot.Account)
+}
+
+func (a *Alerter) evaluateRule(rule *AlertRule, snapshot *AccountSnapshot, now time.Time) []*Alert {
+	resource := snapshot.Currency + "/" + snapshot.Account
+	newAlert := func(worker string, value float64, message string) *Alert {
+		return &Alert{Rule: rule.Type, Currency: snapshot.Currency, Account: snapshot.Account, Worker: worker,
+			Value: value, Message: message, StartsAt: now}
+	}
+
+	alerts := []*Alert{}
+	switch rule.Type {
+	case "worker_offline":
+		for _, worker := range snapshot.Workers {
+			key := resource + "/" + worker.Name
+			since, offline := a.offlineSince[key]
+			if worker.Hashrate > 0 {
+				delete(a.offlineSince, key)
+				continue
+			}
+			if !offline {
+				since = now
+				if worker.LastShareAt != nil {
+					since = *worker.LastShareAt
+				}
+				a.offlineSince[key] = since
+			}
+			if minutes := now.Sub(since).Minutes(); minutes >= rule.Minutes {
+				alerts = append(alerts, newAlert(worker.Name, minutes,
+					fmt.Sprintf("Worker %s of %s is offline for %.0f minutes", worker.Name, resource, minutes)))
+			}
+		}
+	case "hashrate_drop":
+		average := snapshot.HashesLastDay / 86400
+		if average == 0 {
+			break
+		}
+		if drop := (1 - snapshot.Hashrate/average) * 100; drop > rule.Percent {
+			alerts = append(alerts, newAlert("", drop,
+				fmt.Sprintf("Hashrate of %s is %.1f%% under its 24 hours average", resource, drop)))
+		}
+	case "reject_rate_high":
+		for i := range snapshot.Workers {
+			worker := &snapshot.Workers[i]
+			if !RejectRateHigh(worker) {
+				continue
+			}
+			ratio, _ := RejectRate(worker)
+			alerts = append(alerts, newAlert(worker.Name, ratio,
+				fmt.Sprintf("Stale rejected ratio of worker %s of %s is %.1f%% over the last hour", worker.Name, resource, ratio*100)))
+		}
+	case "payout":
+		previous, ok := a.paid[resource]
+		a.paid[resource] = snapshot.Paid
+		if ok && snapshot.Paid > previous {
+			amount := snapshot.Paid - previous
+			alerts = append(alerts, newAlert("", amount,
+				fmt.Sprintf("Payout of %g %s received by %s", amount, snapshot.Currency, resource)))
+		}
+	}
+	return alerts
+}
+
+func (a *Alerter) notify(alert *Alert) {
+	for _, notifier := range a.notifiers {
+		if err := notifier.Notify(alert); err != nil {
+			log.Println("Error sending alert", alert.Rule, ":", err)
+		}
+	}
+}
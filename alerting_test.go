@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigAlertRules(t *testing.T) {
+	tests := []struct {
+		rules   string
+		wantErr bool
+	}{
+		{`[{"type": "worker_offline", "minutes": 15}, {"type": "hashrate_drop", "percent": 30}, {"type": "payout"}, {"type": "reject_rate_high"}]`, false},
+		{`[{"type": "worker_ofline", "minutes": 15}]`, true},
+		{`[{"type": ""}]`, true},
+		{`[{"type": "worker_offline"}]`, true},
+		{`[{"type": "hashrate_drop"}]`, true},
+		{`[{"type": "hashrate_drop", "percent": 150}]`, true},
+	}
+	for _, test := range tests {
+		_, err := loadTestConfig(t, `{"alerts": {"rules": `+test.rules+`}}`)
+		if (err != nil) != test.wantErr {
+			t.Errorf("LoadConfig(%s) error = %v, want error %v", test.rules, err, test.wantErr)
+		}
+	}
+}
+
+// Notifications received by a test webhook, as rule/status/worker
+type alertsRecorder struct {
+	mutex  sync.Mutex
+	alerts []string
+}
+
+func (r *alertsRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	alert := Alert{}
+	if err := json.NewDecoder(req.Body).Decode(&alert); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.alerts = append(r.alerts, alert.Rule+"/"+alert.Status+"/"+alert.Worker)
+}
+
+func (r *alertsRecorder) take() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	alerts := r.alerts
+	r.alerts = nil
+	return alerts
+}
+
+func TestAlerterEvaluate(t *testing.T) {
+	recorder := &alertsRecorder{}
+	webhook := httptest.NewServer(recorder)
+	defer webhook.Close()
+	alertmanager := map[string]int{}
+	var alertmanagerMutex sync.Mutex
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alerts := []alertmanagerAlert{}
+		json.NewDecoder(r.Body).Decode(&alerts)
+		alertmanagerMutex.Lock()
+		defer alertmanagerMutex.Unlock()
+		for _, alert := range alerts {
+			status := "firing"
+			if alert.EndsAt != nil {
+				status = "resolved"
+			}
+			alertmanager[alert.Labels["alertname"]+"/"+status]++
+		}
+	}))
+	defer am.Close()
+
+	exporter := &F2PoolExporter{snapshots: NewSnapshotStore()}
+	alerter := NewAlerter(exporter, &AlertsConfig{
+		WebhookUrl:      webhook.URL,
+		AlertmanagerUrl: am.URL,
+		Rules: []AlertRule{
+			{Type: "worker_offline", Minutes: 10},
+			{Type: "hashrate_drop", Percent: 50},
+			{Type: "payout", Currency: "bitcoin"},
+		},
+	}, webhook.Client())
+
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	lastShare := start.Add(-time.Minute)
+	steps := []struct {
+		name     string
+		at       time.Duration
+		hashrate float64
+		paid     float64
+		workers  []WorkerSnapshot
+		want     []string
+	}{
+		{
+			name:     "offline for less than the threshold",
+			hashrate: 100, paid: 1,
+			workers: []WorkerSnapshot{{Name: "rig-1", Hashrate: 100}, {Name: "rig-2", LastShareAt: &lastShare}},
+		},
+		{
+			name: "offline for more than the threshold, payout", at: 10 * time.Minute,
+			hashrate: 100, paid: 2,
+			workers: []WorkerSnapshot{{Name: "rig-1", Hashrate: 100}, {Name: "rig-2", LastShareAt: &lastShare}},
+			want:    []string{"payout/firing/", "worker_offline/firing/rig-2"},
+		},
+		{
+			name: "still offline, not sent again", at: 11 * time.Minute,
+			hashrate: 100, paid: 2,
+			workers: []WorkerSnapshot{{Name: "rig-1", Hashrate: 100}, {Name: "rig-2", LastShareAt: &lastShare}},
+		},
+		{
+			name: "back online, hashrate drop", at: 12 * time.Minute,
+			hashrate: 10, paid: 2,
+			workers: []WorkerSnapshot{{Name: "rig-1", Hashrate: 100}, {Name: "rig-2", Hashrate: 1}},
+			want:    []string{"hashrate_drop/firing/", "worker_offline/resolved/rig-2"},
+		},
+		{
+			name: "hashrate back", at: 13 * time.Minute,
+			hashrate: 100, paid: 2,
+			workers: []WorkerSnapshot{{Name: "rig-1", Hashrate: 100}},
+			want:    []string{"hashrate_drop/resolved/"},
+		},
+	}
+	for _, step := range steps {
+		exporter.snapshots.Set("bitcoin/test", &AccountSnapshot{
+			Currency: "bitcoin", Account: "test", Hashrate: step.hashrate, HashesLastDay: 100 * 86400,
+			Paid: step.paid, Workers: step.workers, UpdatedAt: start.Add(step.at),
+		})
+		alerter.Evaluate(start.Add(step.at))
+		got := recorder.take()
+		sort.Strings(got)
+		if len(got) != len(step.want) || (len(got) != 0 && !reflect.DeepEqual(got, step.want)) {
+			t.Errorf("%s: notifications = %v, want %v", step.name, got, step.want)
+		}
+	}
+	if len(alerter.offlineSince) != 0 {
+		t.Errorf("offline workers = %v, want none", alerter.offlineSince)
+	}
+
+	alertmanagerMutex.Lock()
+	defer alertmanagerMutex.Unlock()
+	// Firing alerts are sent again after each evaluation
+	want := map[string]int{
+		"F2PoolPayout/firing": 1, "F2PoolWorkerOffline/firing": 3, "F2PoolWorkerOffline/resolved": 1,
+		"F2PoolHashrateDrop/firing": 2, "F2PoolHashrateDrop/resolved": 1,
+	}
+	if !reflect.DeepEqual(alertmanager, want) {
+		t.Errorf("alertmanager alerts = %v, want %v", alertmanager, want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Alertmanager notification channel of the built-in alerting, alerts are posted to its v2 API
+// See: https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorUrl string            `json:"generatorURL,omitempty"`
+}
+
+type AlertmanagerNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func NewAlertmanagerNotifier(client *http.Client, url string) *AlertmanagerNotifier {
+	return &AlertmanagerNotifier{client: client, url: strings.TrimSuffix(url, "/") + "/api/v2/alerts"}
+}
+
+func (n *AlertmanagerNotifier) Notify(alert *Alert) error {
+	return n.post([]*Alert{alert})
+}
+
+// Alertmanager resolves the alerts which are not sent again within its resolve_timeout,
+// the firing alerts are so sent after each evaluation
+func (n *AlertmanagerNotifier) Repeat(alerts []*Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	return n.post(alerts)
+}
+
+func (n *AlertmanagerNotifier) post(alerts []*Alert) error {
+	payload := []alertmanagerAlert{}
+	for _, alert := range alerts {
+		labels := map[string]string{
+			"alertname": alertmanagerName(alert.Rule),
+			"currency":  alert.Currency,
+			"account":   alert.Account,
+		}
+		if len(alert.Worker) != 0 {
+			labels["worker"] = alert.Worker
+		}
+		a := alertmanagerAlert{
+			Labels: labels,
+			Annotations: map[string]string{
+				"summary": alert.Message,
+				"value":   fmt.Sprintf("%g", alert.Value),
+			},
+			StartsAt: alert.StartsAt,
+		}
+		if alert.Status == AlertResolved {
+			endsAt := alert.EndsAt
+			a.EndsAt = &endsAt
+		}
+		payload = append(payload, a)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("alertmanager: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Alert name of a rule type, the names of the generated Prometheus rules are used (worker_offline: F2PoolWorkerOffline)
+func alertmanagerName(rule string) string {
+	name := "F2Pool"
+	for _, word := range strings.Split(rule, "_") {
+		if len(word) != 0 {
+			name += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return name
+}
@@ -0,0 +1,37 @@
+package main
+
+// Mining algorithm of each currency, the hash metrics are exported with an algorithm label and the
+// unit of their hashrates, so that only hashrates of a same algorithm are compared. The F2Pool API
+// answers the hashrates and numbers of hashes in the base unit of the algorithm (H/s, or Sol/s for
+// Equihash), they are exported as is
+
+type Algorithm struct {
+	Name string `json:"name"`
+	// Unit of the hashrates (H/s or Sol/s)
+	Unit string `json:"unit"`
+}
+
+var currencyAlgorithms = map[string]Algorithm{
+	"bitcoin":         {Name: "sha256", Unit: "H/s"},
+	"bitcoincash":     {Name: "sha256", Unit: "H/s"},
+	"bitcoinsv":       {Name: "sha256", Unit: "H/s"},
+	"litecoin":        {Name: "scrypt", Unit: "H/s"},
+	"dogecoin":        {Name: "scrypt", Unit: "H/s"},
+	"ethereum":        {Name: "ethash", Unit: "H/s"},
+	"ethereumclassic": {Name: "etchash", Unit: "H/s"},
+	"dash":            {Name: "x11", Unit: "H/s"},
+	"zec":             {Name: "equihash", Unit: "Sol/s"},
+	"xmr":             {Name: "randomx", Unit: "H/s"},
+	"dcr":             {Name: "blake256", Unit: "H/s"},
+	"conflux":         {Name: "octopus", Unit: "H/s"},
+	"ravencoin":       {Name: "kawpow", Unit: "H/s"},
+	"kaspa":           {Name: "kheavyhash", Unit: "H/s"},
+}
+
+// AlgorithmFor returns the algorithm of a currency, the configured one prevails over the built-in one
+func (c *Config) AlgorithmFor(currency string) Algorithm {
+	if algorithm, ok := c.Algorithms[currency]; ok {
+		return algorithm
+	}
+	return currencyAlgorithms[currency]
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestConfigAlgorithmFor(t *testing.T) {
+	config, err := loadTestConfig(t, `{"algorithms": {"zen": {"name": "equihash", "unit": "Sol/s"}, "bitcoin": {"name": "sha256d", "unit": "H/s"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		currency string
+		want     Algorithm
+	}{
+		{"litecoin", Algorithm{Name: "scrypt", Unit: "H/s"}},
+		{"zec", Algorithm{Name: "equihash", Unit: "Sol/s"}},
+		// Configured
+		{"zen", Algorithm{Name: "equihash", Unit: "Sol/s"}},
+		{"bitcoin", Algorithm{Name: "sha256d", Unit: "H/s"}},
+		{"unknown", Algorithm{}},
+	}
+	for _, test := range tests {
+		if got := config.AlgorithmFor(test.currency); got != test.want {
+			t.Errorf("AlgorithmFor(%s) = %+v, want %+v", test.currency, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Hashrate anomalies: a rolling baseline of the hashrate of each account and worker (exponentially
+// weighted moving average over --hashrate-baseline-window) is kept in memory, the deviation of the
+// current hashrate from it being exported, so that a single alert rule (e.g. below -0.3) catches
+// hashrates significantly below normal without per-account thresholds
+
+var f2pool_hashrate_deviation_ratio = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hashrate_deviation_ratio"),
+	"Deviation of the hashrate from its moving average (current / average - 1)", []string{"currency", "account", "worker"}, nil)
+
+type hashrateBaseline struct {
+	average float64
+	at      time.Time
+}
+
+type BaselineTracker struct {
+	window time.Duration
+
+	mutex     sync.Mutex
+	baselines map[string]*hashrateBaseline
+}
+
+func NewBaselineTracker(window time.Duration) *BaselineTracker {
+	return &BaselineTracker{window: window, baselines: map[string]*hashrateBaseline{}}
+}
+
+// Observe records the current hashrate of an account or worker and returns its deviation from the
+// baseline before the observation, false while the baseline is zero
+func (t *BaselineTracker) Observe(key string, hashrate float64, now time.Time) (float64, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	baseline, ok := t.baselines[key]
+	if !ok {
+		t.baselines[key] = &hashrateBaseline{average: hashrate, at: now}
+		return 0, hashrate != 0
+	}
+	deviation, valid := 0.0, baseline.average > 0
+	if valid {
+		deviation = hashrate/baseline.average - 1
+	}
+	// Weight of the observation from the time elapsed since the previous one, irregular scrape
+	// intervals weighing the same over the window
+	weight := 1 - math.Exp(-float64(now.Sub(baseline.at))/float64(t.window))
+	baseline.average += weight * (hashrate - baseline.average)
+	baseline.at = now
+	return deviation, valid
+}
+
+// Expire removes the baselines not observed for a window (removed workers and resources)
+func (t *BaselineTracker) Expire(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for key, baseline := range t.baselines {
+		if now.Sub(baseline.at) > t.window {
+			delete(t.baselines, key)
+		}
+	}
+}
+
+func (t *BaselineTracker) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.baselines)
+}
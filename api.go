@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSON API exposing the latest collected data:
+//   /api/v1/accounts
+//   /api/v1/accounts/{currency}/{account}/workers
+// And its CSV export:
+//   /export/workers.csv?resource={currency}/{account}
+// And the status of the last retrieval of every resource, as HTML or JSON:
+//   /status
+// With --history-dir, the recorded history of a resource:
+//   /api/v1/history?resource={currency}/{account}&range=7d
+// And the recorded exchange rates of a currency to a fiat, with --fiat:
+//   /api/v1/prices?currency={currency}&fiat={fiat}&range=30d
+// With --hash-accounts, the account of a hash (requires the lookup token):
+//   /api/v1/accounts/lookup?hash={hash}
+
+const apiAccountsPath = "/api/v1/accounts"
+
+func (e *F2PoolExporter) RegisterApi(mux *http.ServeMux) {
+	mux.HandleFunc(apiAccountsPath, e.serveAccounts)
+	mux.HandleFunc(apiAccountsPath+"/", e.serveAccountWorkers)
+	mux.HandleFunc("/export/workers.csv", e.serveWorkersCsv)
+	mux.HandleFunc("/-/selftest", e.serveSelftest)
+	mux.HandleFunc(statusPath, e.serveStatus)
+	if e.history != nil {
+		mux.HandleFunc("/api/v1/history", e.serveHistory)
+		mux.HandleFunc("/api/v1/prices", e.servePrices)
+	}
+	if *hashAccounts && len(e.lookupToken) != 0 {
+		mux.HandleFunc(apiAccountsPath+"/lookup", Audited("account_lookup", e.serveAccountLookup))
+	}
+	if len(e.adminToken) != 0 {
+		mux.HandleFunc(apiAdminCredentialsPath, Audited("credentials_replace", e.serveCredentials))
+		mux.HandleFunc(apiAdminPausedPath, Audited("paused", e.servePaused))
+	}
+}
+
+func (e *F2PoolExporter) serveAccounts(w http.ResponseWriter, r *http.Request) {
+	e.ensureCollected()
+	writeJson(w, http.StatusOK, e.snapshots.All())
+}
+
+func (e *F2PoolExporter) serveAccountWorkers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiAccountsPath+"/"), "/")
+	if len(parts) != 3 || parts[2] != "workers" {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	e.ensureCollected()
+	var snapshot *AccountSnapshot
+	if resource, ok := e.resourceOf(parts[0] + "/" + parts[1]); ok {
+		snapshot = e.snapshots.Get(resource)
+	}
+	if snapshot == nil {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "unknown resource"})
+		return
+	}
+	writeJson(w, http.StatusOK, snapshot.Workers)
+}
+
+// Workers of the requested resource (all resources if none) as CSV
+func (e *F2PoolExporter) serveWorkersCsv(w http.ResponseWriter, r *http.Request) {
+	e.ensureCollected()
+
+	snapshots := e.snapshots.All()
+	if resource := r.URL.Query().Get("resource"); len(resource) != 0 {
+		var snapshot *AccountSnapshot
+		if resource, ok := e.resourceOf(resource); ok {
+			snapshot = e.snapshots.Get(resource)
+		}
+		if snapshot == nil {
+			http.Error(w, "unknown resource", http.StatusNotFound)
+			return
+		}
+		snapshots = []*AccountSnapshot{snapshot}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="workers.csv"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{"currency", "account", "worker", "online", "hashrate", "hashes_last_hour", "hashes_last_day",
+		"stale_hashes_rejected_last_hour", "stale_hashes_rejected_last_day", "last_share_at"})
+	for _, snapshot := range snapshots {
+		for _, worker := range snapshot.Workers {
+			lastShare := ""
+			if worker.LastShareAt != nil {
+				lastShare = worker.LastShareAt.Format(time.RFC3339)
+			}
+			out.Write([]string{
+				snapshot.Currency,
+				snapshot.Account,
+				worker.Name,
+				strconv.FormatBool(worker.Hashrate > 0),
+				formatCsvFloat(worker.Hashrate),
+				formatCsvFloat(worker.HashesLastHour),
+				formatCsvFloat(worker.HashesLastDay),
+				formatCsvFloat(worker.StaleHashesRejectedLastHour),
+				formatCsvFloat(worker.StaleHashesRejectedLastDay),
+				lastShare,
+			})
+		}
+	}
+	out.Flush()
+}
+
+// Resources whose account label is the requested hash
+func (e *F2PoolExporter) serveAccountLookup(w http.ResponseWriter, r *http.Request) {
+	if !Authorized(w, r, e.lookupToken) {
+		return
+	}
+
+	hash := r.URL.Query().Get("hash")
+	matches := []map[string]string{}
+	for _, resource := range e.resources.All() {
+		tmp := strings.Split(resource, "/")
+		if AccountLabel(tmp[1]) == hash {
+			matches = append(matches, map[string]string{"currency": tmp[0], "account": tmp[1]})
+		}
+	}
+	if len(matches) == 0 {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "unknown hash"})
+		return
+	}
+	writeJson(w, http.StatusOK, matches)
+}
+
+// resourceOf returns the resource of a {currency}/{account} value given to the API, whose account is
+// the label value (the hash with --hash-accounts), false if no collected resource matches
+func (e *F2PoolExporter) resourceOf(value string) (string, bool) {
+	value = e.config.CanonicalResources([]string{value})[0]
+	if !*hashAccounts {
+		return value, true
+	}
+	for _, resource := range e.resources.All() {
+		if ResourceLabel(resource) == value {
+			return resource, true
+		}
+	}
+	return "", false
+}
+
+func formatCsvFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Runs a collection when nothing was collected yet (no scrape since the exporter started)
+func (e *F2PoolExporter) ensureCollected() {
+	if e.snapshots.Len() == 0 {
+		e.Refresh()
+	}
+}
+
+// Refresh runs a collection whose metrics are discarded, updating the snapshots
+func (e *F2PoolExporter) Refresh() {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	e.Collect(ch)
+	close(ch)
+	<-done
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
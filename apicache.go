@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Response cache of the F2Pool API: successful answers are reused for --api-cache-ttl, so that
+// scrapes (or API and sink refreshes) within the TTL do not call the API again, whatever the
+// scrape interval. Requests are keyed like the fixtures, along with their API token
+
+type cachedApiResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	fetched time.Time
+}
+
+type ApiCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cachedApiResponse
+}
+
+// apiCache is set when the TTL is not 0
+var apiCache *ApiCache
+
+func NewApiCache(ttl time.Duration) *ApiCache {
+	return &ApiCache{ttl: ttl, entries: map[string]cachedApiResponse{}}
+}
+
+// Len returns the number of cached answers
+func (c *ApiCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Do returns the cached answer of the request, or makes it with do and caches its answer if
+// successful
+func (c *ApiCache) Do(req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	body := []byte{}
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	token := sha256.Sum256([]byte(req.Header.Get("F2P-API-SECRET")))
+	key := fixtureKey(req, body) + "/" + hex.EncodeToString(token[:8])
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if ok && now.Sub(entry.fetched) >= c.ttl {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mutex.Unlock()
+	cacheStats.Lookup("api_responses", ok)
+	if ok {
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", entry.status, http.StatusText(entry.status)),
+			StatusCode: entry.status,
+			Header:     entry.header.Clone(),
+			Body:       ioutil.NopCloser(bytes.NewReader(entry.body)),
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	c.mutex.Lock()
+	// Expired answers of the requests not made anymore (removed resources) are dropped
+	for key, entry := range c.entries {
+		if now.Sub(entry.fetched) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[key] = cachedApiResponse{status: resp.StatusCode, header: resp.Header.Clone(), body: data, fetched: now}
+	c.mutex.Unlock()
+	return resp, nil
+}
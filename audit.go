@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit log: an entry (JSON line) is written for each request to the administrative and sensitive
+// endpoints (admin API, account lookup), with the client, the request and its outcome
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Client address, and forwarded address when behind a proxy
+	RemoteAddr   string `json:"remote_addr"`
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+	// Subject of the verified client certificate (mTLS)
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	Authenticated     bool   `json:"authenticated"`
+	Method            string `json:"method"`
+	Path              string `json:"path"`
+	Query             string `json:"query,omitempty"`
+	Status            int    `json:"status"`
+	UserAgent         string `json:"user_agent,omitempty"`
+}
+
+type AuditLogger struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// auditLogger is set when the audit log is enabled
+var auditLogger *AuditLogger
+
+// OpenAuditLog appends the entries to a file, - for the standard output
+func OpenAuditLog(path string) (*AuditLogger, error) {
+	if path == "-" {
+		return &AuditLogger{writer: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLogger{writer: file}, nil
+}
+
+func (a *AuditLogger) Record(entry *AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Error encoding audit entry:", err)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err := a.writer.Write(append(data, '\n')); err != nil {
+		log.Println("Error writing audit entry:", err)
+	}
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Audited records the requests of a handler in the audit log, when it is enabled
+func Audited(action string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auditLogger == nil {
+			handler(w, r)
+			return
+		}
+
+		recorder := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+
+		entry := &AuditEntry{
+			Time:          time.Now().UTC(),
+			Action:        action,
+			RemoteAddr:    r.RemoteAddr,
+			ForwardedFor:  r.Header.Get("X-Forwarded-For"),
+			Authenticated: recorder.status != http.StatusUnauthorized && recorder.status != http.StatusForbidden,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Query:         r.URL.RawQuery,
+			Status:        recorder.status,
+			UserAgent:     r.UserAgent(),
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			entry.RemoteAddr = host
+		}
+		if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+			entry.ClientCertificate = r.TLS.VerifiedChains[0][0].Subject.String()
+		}
+		auditLogger.Record(entry)
+	}
+}
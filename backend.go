@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pool backends: the data of a resource is retrieved by the backend of its pool, the collector only
+// handles the account values and workers they return, so that the APIs of other pools can be added
+// as backends without changing the metrics. The backend of a resource is its configured one
+// (backends of the configuration file, by {currency}/{account} or currency), --backend otherwise
+
+type PoolBackend interface {
+	// FetchAccount returns the account-level values of a resource, the workers the answer may contain
+	// being only decoded with workers
+	FetchAccount(client *http.Client, currency string, user string, token string, workers bool) (*AccountInfo, error)
+	// FetchWorkers returns the workers of a resource, account being the answer of FetchAccount
+	FetchWorkers(client *http.Client, currency string, user string, token string, account *AccountInfo) ([]AccountWorker, error)
+	// Describe sends the descriptors of the metrics the backend adds to the account ones
+	Describe(ch chan<- *prometheus.Desc)
+}
+
+var poolBackends = map[string]PoolBackend{
+	"f2pool":    &F2PoolV1Backend{},
+	"f2pool-v2": &F2PoolV2Backend{},
+}
+
+func validateBackends(config *Config) error {
+	names := []string{}
+	for name := range poolBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, backend := range append([]string{*backendArg}, mapValues(config.Backends)...) {
+		if _, ok := poolBackends[backend]; !ok {
+			return fmt.Errorf("unknown backend %q (%s)", backend, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+func mapValues(m map[string]string) []string {
+	values := []string{}
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
+
+// BackendFor returns the backend of a resource
+func (c *Config) BackendFor(currency string, user string) PoolBackend {
+	return poolBackends[c.BackendNameFor(currency, user)]
+}
+
+// BackendNameFor returns the backend name of a resource, the one of the resource prevailing over
+// the one of its currency
+func (c *Config) BackendNameFor(currency string, user string) string {
+	if backend, ok := c.Backends[currency+"/"+user]; ok {
+		return backend
+	}
+	if backend, ok := c.Backends[currency]; ok {
+		return backend
+	}
+	return *backendArg
+}
+
+// F2PoolV1Backend retrieves the account and its workers with one call of the (public) v1 API
+type F2PoolV1Backend struct{}
+
+func (b *F2PoolV1Backend) FetchAccount(client *http.Client, currency string, user string, token string, workers bool) (*AccountInfo, error) {
+	resource := currency + "/" + user
+	infos := &AccountInfo{SkipWorkers: !workers}
+	infosBody, err := HttpGetCall(client, f2poolApiUrl+resource, token)
+	if err == nil {
+		err = json.Unmarshal([]byte(infosBody), infos)
+	}
+	if err != nil && len(infosBody) != 0 {
+		LogPayload(resource, infosBody, err)
+		err = fmt.Errorf("unexpected response (%w): %.200s", &PayloadError{Err: err}, infosBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiDrift.Observe("v1", infos.UnknownFields)
+	return infos, nil
+}
+
+func (b *F2PoolV1Backend) FetchWorkers(client *http.Client, currency string, user string, token string, account *AccountInfo) ([]AccountWorker, error) {
+	return account.Workers, nil
+}
+
+func (b *F2PoolV1Backend) Describe(ch chan<- *prometheus.Desc) {}
+
+// F2PoolV2Backend retrieves the account balance, hashrates and workers with the v2 API, which
+// requires a token
+type F2PoolV2Backend struct{}
+
+var f2pool_immature_balance = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "immature_balance"),
+	"Balance not confirmed yet (v2 backend)", []string{"currency", "account"}, nil)
+
+func (b *F2PoolV2Backend) FetchAccount(client *http.Client, currency string, user string, token string, workers bool) (*AccountInfo, error) {
+	if len(token) == 0 {
+		return nil, fmt.Errorf("the f2pool-v2 backend requires a token")
+	}
+	balance, err := FetchBalance(client, token, currency, user)
+	if err != nil {
+		return nil, err
+	}
+	hashrates, err := FetchHashRateInfo(client, token, currency, user)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountInfo{
+		Balance: balance.Balance,
+		Paid:    balance.Paid,
+		Value:   balance.TotalIncome,
+		// Revenue of the previous day, the v2 API has no revenue of the last 24 hours
+		ValueLastDay:                balance.YesterdayIncome,
+		Hashrate:                    hashrates.HashRate,
+		HashesLastHour:              hashrates.H1HashRate * 3600,
+		StaleHashesRejectedLastHour: hashrates.H1StaleHashRate * 3600,
+		HashesLastDay:               hashrates.H24HashRate * 86400,
+		StaleHashesRejectedLastDay:  hashrates.H24StaleHashRate * 86400,
+		Metrics: []prometheus.Metric{
+			prometheus.MustNewConstMetric(f2pool_immature_balance, prometheus.GaugeValue, balance.ImmatureBalance, currency, AccountLabel(user)),
+		},
+	}, nil
+}
+
+func (b *F2PoolV2Backend) FetchWorkers(client *http.Client, currency string, user string, token string, account *AccountInfo) ([]AccountWorker, error) {
+	workers, err := FetchWorkers(client, token, currency, user)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AccountWorker, 0, len(workers))
+	for _, worker := range workers {
+		info := worker.HashRateInfo
+		// 0 for the workers which never submitted a share, without last share like the v1 ones
+		lastShare := ""
+		if worker.LastShareAt > 0 {
+			lastShare = time.Unix(worker.LastShareAt, 0).UTC().Format(time.RFC3339)
+		}
+		result = append(result, AccountWorker{
+			Name:                        info.Name,
+			Hashrate:                    info.HashRate,
+			HashesLastHour:              info.H1HashRate * 3600,
+			StaleHashesRejectedLastHour: info.H1StaleHashRate * 3600,
+			HashesLastDay:               info.H24HashRate * 86400,
+			StaleHashesRejectedLastDay:  info.H24StaleHashRate * 86400,
+			LastShare:                   lastShare,
+		})
+	}
+	return result, nil
+}
+
+func (b *F2PoolV2Backend) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f2pool_immature_balance
+}
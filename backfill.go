@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backfill command: writes the history available from the API as an OpenMetrics file
+// to be imported with `promtool tsdb create-blocks-from openmetrics <file> <data dir>`
+
+type backfillSample struct {
+	labels    string
+	value     float64
+	timestamp int64
+}
+
+type backfillFamily struct {
+	name    string
+	help    string
+	samples []backfillSample
+}
+
+func runBackfill(e *F2PoolExporter, output string, days int) error {
+	hashrate := &backfillFamily{name: "f2pool_hashrate", help: "Current hashrate"}
+	revenue := &backfillFamily{name: "f2pool_value_last_day", help: "Revenue of last 24 hours"}
+
+	end := time.Now()
+	for _, resource := range e.resources.All() {
+		tmp := strings.Split(resource, "/")
+		currency := tmp[0]
+		account := tmp[1]
+		token := e.config.TokenFor(currency, account)
+
+		accountLabels := fmt.Sprintf("currency=%q,account=%q", currency, AccountLabel(account))
+		algorithm := e.config.AlgorithmFor(currency)
+		workerLabels := accountLabels + fmt.Sprintf(`,worker=%q,algorithm=%q`, *accountWorker, algorithm.Name)
+
+		if len(token) == 0 {
+			// Without token, only the last 24 hours hashrate of the v1 API is available
+			var infos struct {
+				HashrateHistory map[string]float64 `json:"hashrate_history"`
+			}
+			body, err := HttpGetCall(e.client, f2poolApiUrl+resource, token)
+			if err != nil {
+				return fmt.Errorf("%s: %w", resource, err)
+			}
+			if err := json.Unmarshal([]byte(body), &infos); err != nil {
+				return err
+			}
+			for date, value := range infos.HashrateHistory {
+				t, err := time.Parse(time.RFC3339, date)
+				if err == nil {
+					hashrate.samples = append(hashrate.samples, backfillSample{workerLabels, value, t.Unix()})
+				}
+			}
+			log.Println("No API token for", resource, ": only the last 24 hours hashrate is available")
+			continue
+		}
+
+		points, err := FetchHashRateHistory(e.client, token, currency, account, 3600, int64(days)*86400)
+		if err != nil {
+			return fmt.Errorf("%s: %w", resource, err)
+		}
+		for _, point := range points {
+			hashrate.samples = append(hashrate.samples, backfillSample{workerLabels, point.HashRate, point.Timestamp})
+		}
+
+		start := end.AddDate(0, 0, -days)
+		transactions, err := FetchTransactions(e.client, token, currency, account, "revenue", start.Unix(), end.Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", resource, err)
+		}
+		for _, transaction := range transactions {
+			revenue.samples = append(revenue.samples, backfillSample{accountLabels, transaction.ChangedBalance, transaction.CreatedAt})
+		}
+	}
+
+	out := os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	for _, family := range []*backfillFamily{hashrate, revenue} {
+		writeBackfillFamily(w, family)
+	}
+	fmt.Fprintln(w, "# EOF")
+	return w.Flush()
+}
+
+// Samples of a family have to be grouped by series and ordered by time
+func writeBackfillFamily(w io.Writer, family *backfillFamily) {
+	if len(family.samples) == 0 {
+		return
+	}
+	sort.SliceStable(family.samples, func(i, j int) bool {
+		a, b := family.samples[i], family.samples[j]
+		if a.labels != b.labels {
+			return a.labels < b.labels
+		}
+		return a.timestamp < b.timestamp
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", family.name, family.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", family.name)
+	for _, sample := range family.samples {
+		fmt.Fprintf(w, "%s{%s} %g %d\n", family.name, sample.labels, sample.value, sample.timestamp)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Load test: synthetic resources retrieved from the mock API, scraped a number of times to measure
+// the scrape latency, the allocations and the series count, to size the exporter before pointing
+// it at large accounts
+
+// BenchResources returns count synthetic resources, spread over the mock currencies
+func BenchResources(count int) []string {
+	currencies := []string{"bitcoin", "litecoin", "kaspa"}
+	resources := []string{}
+	for i := 0; i < count; i++ {
+		resources = append(resources, fmt.Sprintf("%s/bench%05d", currencies[i%len(currencies)], i+1))
+	}
+	return resources
+}
+
+func runBench(e *F2PoolExporter, scrapes int, out io.Writer) error {
+	if scrapes < 1 {
+		return errors.New("at least one scrape is required")
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		return err
+	}
+
+	var total, fastest, slowest time.Duration
+	var mallocs, bytes uint64
+	series := 0
+	for i := 0; i < scrapes; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+		families, err := registry.Gather()
+		if err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+
+		runtime.ReadMemStats(&after)
+		mallocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+
+		total += elapsed
+		if i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+		if elapsed > slowest {
+			slowest = elapsed
+		}
+		series = 0
+		for _, family := range families {
+			series += len(family.Metric)
+		}
+	}
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	count := uint64(scrapes)
+	fmt.Fprintf(out, "Resources:          %d\n", len(e.resources.All()))
+	fmt.Fprintf(out, "Workers:            %d\n", workersCount(e))
+	fmt.Fprintf(out, "Series:             %d\n", series)
+	fmt.Fprintf(out, "Scrapes:            %d\n", scrapes)
+	fmt.Fprintf(out, "Scrape latency:     min %s, avg %s, max %s\n", fastest.Round(time.Microsecond), (total / time.Duration(scrapes)).Round(time.Microsecond), slowest.Round(time.Microsecond))
+	fmt.Fprintf(out, "Allocations/scrape: %d (%.1f MiB)\n", mallocs/count, float64(bytes/count)/(1<<20))
+	fmt.Fprintf(out, "Heap in use:        %.1f MiB\n", float64(memory.HeapInuse)/(1<<20))
+	return nil
+}
+
+func workersCount(e *F2PoolExporter) int {
+	count := 0
+	for _, snapshot := range e.snapshots.All() {
+		count += snapshot.WorkersCount
+	}
+	return count
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Effectiveness of the TTL caches (API answers, exchange rates, pool blocks, network statistics, DNS
+// addresses, worker lists, Vault secrets): lookups served from the cache and lookups retrieving the value again, by cache, to
+// check the caching configuration actually saves the upstream calls
+
+var (
+	f2pool_exporter_cache_hits_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "cache_hits_total"),
+		"Lookups of the exporter caches served from the cache", []string{"cache"}, nil)
+	f2pool_exporter_cache_misses_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "cache_misses_total"),
+		"Lookups of the exporter caches retrieving the value (missing or expired entry)", []string{"cache"}, nil)
+)
+
+type CacheStats struct {
+	mutex  sync.Mutex
+	hits   map[string]float64
+	misses map[string]float64
+}
+
+var cacheStats = &CacheStats{hits: map[string]float64{}, misses: map[string]float64{}}
+
+// Lookup counts a lookup of a cache, hit if served from the cache
+func (s *CacheStats) Lookup(cache string, hit bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if hit {
+		s.hits[cache]++
+		s.misses[cache] += 0
+	} else {
+		s.hits[cache] += 0
+		s.misses[cache]++
+	}
+}
+
+func (s *CacheStats) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for cache, hits := range s.hits {
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_cache_hits_total, prometheus.CounterValue, hits, cache)
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_cache_misses_total, prometheus.CounterValue, s.misses[cache], cache)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Cardinality report: the series of a collection counted by metric family, by resource and by
+// worker (the top ones), like Prometheus counts them, to see what the exporter would send to Prometheus before deploying it
+//   /-/cardinality?top=10
+
+const cardinalityPath = "/-/cardinality"
+
+type CardinalityCount struct {
+	Name   string `json:"name,omitempty"`
+	Worker string `json:"worker,omitempty"`
+	Series int    `json:"series"`
+}
+
+type CardinalityReport struct {
+	Series    int                `json:"series"`
+	Families  []CardinalityCount `json:"families"`
+	Resources []CardinalityCount `json:"resources"`
+	// Workers with the most series, the name being their resource
+	TopWorkers []CardinalityCount `json:"top_workers"`
+}
+
+// Cardinality gathers the metrics and counts their series
+func Cardinality(gatherer prometheus.Gatherer, top int) (*CardinalityReport, error) {
+	families, err := gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+
+	report := &CardinalityReport{Families: []CardinalityCount{}}
+	resources := map[string]int{}
+	workers := map[[2]string]int{}
+	for _, family := range families {
+		count := CardinalityCount{Name: family.GetName()}
+		for _, metric := range family.GetMetric() {
+			series := metricSeries(metric)
+			count.Series += series
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			currency, account := labels["currency"], labels["account"]
+			if len(currency) == 0 || len(account) == 0 {
+				continue
+			}
+			resource := currency + "/" + account
+			resources[resource] += series
+			// Account-level series have the --account-worker label
+			if worker := labels["worker"]; len(worker) != 0 && worker != *accountWorker {
+				workers[[2]string{resource, worker}] += series
+			}
+		}
+		report.Families = append(report.Families, count)
+		report.Series += count.Series
+	}
+
+	for resource, series := range resources {
+		report.Resources = append(report.Resources, CardinalityCount{Name: resource, Series: series})
+	}
+	for worker, series := range workers {
+		report.TopWorkers = append(report.TopWorkers, CardinalityCount{Name: worker[0], Worker: worker[1], Series: series})
+	}
+	sortCardinality(report.Families)
+	sortCardinality(report.Resources)
+	sortCardinality(report.TopWorkers)
+	if len(report.TopWorkers) > top {
+		report.TopWorkers = report.TopWorkers[:top]
+	}
+	return report, nil
+}
+
+// Series stored by Prometheus for a metric: one per bucket (+Inf included) or quantile of
+// histograms and summaries, along with their sum and count
+func metricSeries(metric *dto.Metric) int {
+	if histogram := metric.GetHistogram(); histogram != nil {
+		buckets := len(histogram.GetBucket())
+		if buckets == 0 || !math.IsInf(histogram.GetBucket()[buckets-1].GetUpperBound(), 1) {
+			buckets++
+		}
+		return buckets + 2
+	}
+	if summary := metric.GetSummary(); summary != nil {
+		return len(summary.GetQuantile()) + 2
+	}
+	return 1
+}
+
+// Most series first, then by name
+func sortCardinality(counts []CardinalityCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Series != counts[j].Series {
+			return counts[i].Series > counts[j].Series
+		}
+		if counts[i].Name != counts[j].Name {
+			return counts[i].Name < counts[j].Name
+		}
+		return counts[i].Worker < counts[j].Worker
+	})
+}
+
+func CardinalityHandler(gatherer prometheus.Gatherer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		top := 10
+		if value := r.URL.Query().Get("top"); len(value) != 0 {
+			var err error
+			if top, err = strconv.Atoi(value); err != nil || top < 0 {
+				writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid top " + strconv.Quote(value)})
+				return
+			}
+		}
+		report, err := Cardinality(gatherer, top)
+		if err != nil {
+			writeJson(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJson(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the content of the optional JSON file given with --config-file
+type Config struct {
+	Resources   []string     `json:"resources"`
+	Credentials []Credential `json:"credentials"`
+	Power       *PowerConfig `json:"power"`
+	// Price provider of each currency, the --price-provider one is used for others
+	Prices   map[string]PriceSource `json:"prices"`
+	Hardware []HardwareGroup        `json:"hardware"`
+	Alerts   *AlertsConfig          `json:"alerts"`
+	// Algorithm of each currency, overriding or completing the built-in ones
+	Algorithms map[string]Algorithm `json:"algorithms"`
+	// Currency aliases (e.g. "tbtc": "bitcoin"), completing the built-in ones
+	CurrencyAliases map[string]string `json:"currency_aliases"`
+	// Groups the workers are aggregated in
+	WorkerGroups []WorkerGroup `json:"worker_groups"`
+	// Exported names of metrics, by metric name
+	MetricNames map[string]string `json:"metric_names"`
+	// Relabel rules of the worker label
+	Relabel []RelabelRule `json:"relabel"`
+	// Vault the credentials tokens can be read from
+	Vault *VaultConfig `json:"vault"`
+	// Backend of each resource ({currency}/{account}) or currency, the --backend one is used for others
+	Backends map[string]string `json:"backends"`
+	// Merged mined currencies of each currency, completing or overriding the built-in ones
+	MergedMining map[string][]string `json:"merged_mining"`
+	// Payout threshold of each resource ({currency}/{account}) or currency, for the resources without token
+	PayoutThresholds map[string]float64 `json:"payout_thresholds"`
+	// Hashrate (H/s) of the pool for each currency, for the pool luck
+	PoolHashrates map[string]float64 `json:"pool_hashrates"`
+	// Request limits of the F2Pool API endpoints (v1, v2 or v2/{endpoint})
+	ApiQuotas map[string]ApiQuota `json:"api_quotas"`
+	// Resources ({currency}/{account}) or currencies whose workers are not collected
+	AccountOnly []string `json:"account_only"`
+	// Resources the collection is paused for
+	Paused []PauseRule `json:"paused"`
+
+	vault *VaultClient
+	// Credentials are replaced when they are rotated
+	credentialsMutex sync.RWMutex
+	// Pause rules are replaced through the admin API
+	pausedMutex sync.RWMutex
+}
+
+// Duration is a time.Duration written as a string (e.g. "5m") in the configuration file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// Regexp is an anchored regular expression written as a string in the configuration file
+type Regexp struct {
+	*regexp.Regexp
+}
+
+func MustCompileRegexp(expr string) *Regexp {
+	return &Regexp{regexp.MustCompile("^(?:" + expr + ")$")}
+}
+
+func (r *Regexp) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	expr, err := regexp.Compile("^(?:" + value + ")$")
+	if err != nil {
+		return err
+	}
+	r.Regexp = expr
+	return nil
+}
+
+// Credential is an F2Pool API token scoped to a mining user and/or a currency,
+// an empty field matches any value
+type Credential struct {
+	Currency string `json:"currency"`
+	User     string `json:"user"`
+	Token    string `json:"token"`
+	// Vault secret the token is read from instead, and its key (token by default)
+	VaultPath string `json:"vault_path"`
+	VaultKey  string `json:"vault_key"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if err := validateRelabelRules(config.Relabel); err != nil {
+		return nil, err
+	}
+	if config.Alerts != nil {
+		if err := validateAlertRules(config.Alerts.Rules); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.canonicalizeCurrencies(); err != nil {
+		return nil, err
+	}
+	if config.Vault != nil {
+		config.vault = NewVaultClient(config.Vault)
+	}
+	return config, nil
+}
+
+// TokenFor returns the most specific token configured for the given currency and user
+func (c *Config) TokenFor(currency string, user string) string {
+	var credential *Credential
+	best := -1
+	c.credentialsMutex.RLock()
+	for i, cred := range c.Credentials {
+		score := 0
+		if cred.User != "" {
+			if cred.User != user {
+				continue
+			}
+			score += 2
+		}
+		if cred.Currency != "" {
+			if !strings.EqualFold(cred.Currency, currency) {
+				continue
+			}
+			score += 1
+		}
+		if score > best {
+			best = score
+			credential = &c.Credentials[i]
+		}
+	}
+	c.credentialsMutex.RUnlock()
+	if credential == nil {
+		return ""
+	}
+	if len(credential.VaultPath) == 0 {
+		return Secret(credential.Token)
+	}
+
+	if c.vault == nil {
+		log.Println("No vault configured for the token of", currency, "/", user)
+		return ""
+	}
+	key := credential.VaultKey
+	if len(key) == 0 {
+		key = "token"
+	}
+	token, err := c.vault.Secret(credential.VaultPath, key)
+	if err != nil {
+		// Without token, only the v1 API is used
+		log.Println("Error reading token of", currency, "/", user, "from vault :", err)
+		return ""
+	}
+	RedactSecret(token)
+	return token
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consul KV discovery: every key under the prefix is a resource, its path relative to the prefix
+// being {currency}/{account} (e.g. f2pool/resources/bitcoin/youraccountname), values are ignored.
+// Changes are watched with blocking queries
+// See: https://developer.hashicorp.com/consul/api-docs/kv
+
+// Maximum duration of a blocking query, Consul adds up to 1/16 of it
+const consulWait = 5 * time.Minute
+
+// Minimum interval between two queries when the index did not advance or is missing (an agent or
+// a proxy without blocking queries), the queries returning immediately
+const consulMinInterval = 10 * time.Second
+
+type ConsulDiscoverer struct {
+	client  *http.Client
+	address string
+	prefix  string
+	token   string
+	// Index of the last answer, the next query blocks until it changes
+	index uint64
+	// Start of the last query, and whether the next one is delayed to consulMinInterval after it
+	queriedAt time.Time
+	throttled bool
+}
+
+func NewConsulDiscoverer(address string, prefix string, token string) *ConsulDiscoverer {
+	return &ConsulDiscoverer{
+		client:  &http.Client{Timeout: consulWait + time.Minute},
+		address: strings.TrimSuffix(address, "/"),
+		prefix:  strings.Trim(prefix, "/") + "/",
+		token:   token,
+	}
+}
+
+// Discover blocks until the keys under the prefix change (or the wait expires) and returns them,
+// the first call returns immediately
+func (d *ConsulDiscoverer) Discover() ([]string, error) {
+	if wait := consulMinInterval - time.Since(d.queriedAt); d.throttled && wait > 0 {
+		time.Sleep(wait)
+	}
+	d.queriedAt = time.Now()
+
+	query := url.Values{"recurse": {"true"}, "keys": {"true"}}
+	if d.index != 0 {
+		query.Set("index", strconv.FormatUint(d.index, 10))
+		query.Set("wait", consulWait.String())
+	}
+	req, err := http.NewRequest("GET", d.address+"/v1/kv/"+d.prefix+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.token) != 0 {
+		req.Header.Set("X-Consul-Token", Secret(d.token))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, &keys); err != nil {
+			return nil, err
+		}
+	case http.StatusNotFound:
+		// No key under the prefix
+	default:
+		return nil, fmt.Errorf("consul: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if index < d.index {
+		// The index went backwards (e.g. Consul snapshot restore), the watch is restarted
+		index = 0
+	}
+	d.throttled = index == 0 || index == d.index
+	d.index = index
+
+	resources := []string{}
+	for _, key := range keys {
+		if resource := strings.TrimPrefix(key, d.prefix); len(resource) != 0 && !strings.HasSuffix(resource, "/") {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
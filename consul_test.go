@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestConsulDiscovererDiscover(t *testing.T) {
+	answers := []struct {
+		index  int
+		status int
+		body   string
+	}{
+		{10, http.StatusOK, `["f2pool/resources/", "f2pool/resources/bitcoin/a", "f2pool/resources/litecoin/", "f2pool/resources/litecoin/b"]`},
+		{12, http.StatusOK, `["f2pool/resources/bitcoin/a"]`},
+		{13, http.StatusNotFound, ``},
+		// Snapshot restore
+		{5, http.StatusOK, `["f2pool/resources/bitcoin/c"]`},
+	}
+	queries := []url.Values{}
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/f2pool/resources/" {
+			http.NotFound(w, r)
+			return
+		}
+		answer := answers[len(queries)]
+		queries = append(queries, r.URL.Query())
+		tokens = append(tokens, r.Header.Get("X-Consul-Token"))
+		w.Header().Set("X-Consul-Index", fmt.Sprint(answer.index))
+		w.WriteHeader(answer.status)
+		w.Write([]byte(answer.body))
+	}))
+	defer server.Close()
+
+	discoverer := NewConsulDiscoverer(server.URL+"/", "/f2pool/resources", "token")
+	wants := [][]string{{"bitcoin/a", "litecoin/b"}, {"bitcoin/a"}, {}, {"bitcoin/c"}}
+	for i, want := range wants {
+		got, err := discoverer.Discover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Discover %d = %v, want %v", i, got, want)
+		}
+	}
+
+	// Blocking queries from the index of the previous answer
+	for i, want := range []string{"", "10", "12", "13"} {
+		if got := queries[i].Get("index"); got != want {
+			t.Errorf("index of query %d = %q, want %q", i, got, want)
+		}
+		if got := queries[i].Get("wait") != ""; got != (want != "") {
+			t.Errorf("wait of query %d = %q", i, queries[i].Get("wait"))
+		}
+		if tokens[i] != "token" {
+			t.Errorf("token of query %d = %q, want token", i, tokens[i])
+		}
+	}
+	// The index went backwards, the watch is restarted and throttled
+	if discoverer.index != 0 || !discoverer.throttled {
+		t.Errorf("index = %d, throttled = %v, want 0, true", discoverer.index, discoverer.throttled)
+	}
+}
+
+func TestConsulDiscovererError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := NewConsulDiscoverer(server.URL, "f2pool", "").Discover(); err == nil {
+		t.Error("Discover = nil error, want the status error")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Turns cumulative values of the API (paid, total revenue) into counters which never decrease,
+// even when the API value goes back (account reset, correction).
+// With a state file, the counters state is saved after the collections and loaded at startup, so
+// that the counters do not reset when the exporter restarts. The state is the last API value and
+// offset of each counter: the counters follow the cumulative API values, not the v2 ledger, so the
+// last transaction ID of the ledger is not needed to resume them (and not stored)
+
+// Metric families of the tracked counters
+var trackedCounterFamilies = []string{"f2pool_paid_total", "f2pool_value_total"}
+
+type CounterTracker struct {
+	mutex sync.Mutex
+	// Last value seen and offset added to the API value, by key
+	last   map[string]float64
+	offset map[string]float64
+
+	// State file, no persistence if empty
+	path  string
+	dirty bool
+}
+
+type counterState struct {
+	Last   map[string]float64 `json:"last"`
+	Offset map[string]float64 `json:"offset"`
+}
+
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{last: map[string]float64{}, offset: map[string]float64{}}
+}
+
+// LoadCounterTracker returns a tracker saving its state to a file, starting from the saved state
+// if the file exists
+func LoadCounterTracker(path string) (*CounterTracker, error) {
+	t := NewCounterTracker()
+	t.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := counterState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	for key, value := range state.Last {
+		t.last[key] = value
+	}
+	for key, value := range state.Offset {
+		t.offset[key] = value
+	}
+	return t, nil
+}
+
+// Observe records the current API value of a key and returns the counter value
+func (t *CounterTracker) Observe(key string, value float64) float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last, ok := t.last[key]
+	if ok && value < last {
+		// The counter keeps its value and increases again from there
+		t.offset[key] += last - value
+	}
+	if !ok || value != last {
+		t.last[key] = value
+		t.dirty = true
+	}
+	return t.offset[key] + value
+}
+
+// Save writes the state to the state file if it changed since the last save, the file is replaced
+// atomically so that a crash never leaves a partial state
+func (t *CounterTracker) Save() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.path) == 0 || !t.dirty {
+		return nil
+	}
+	data, err := json.Marshal(counterState{Last: t.last, Offset: t.offset})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), t.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// Persistent returns whether the state is saved, the counters then keeping their values on restarts
+func (t *CounterTracker) Persistent() bool {
+	return len(t.path) != 0
+}
+
+// Len returns the number of tracked counters
+func (t *CounterTracker) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.last)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCounterTrackerObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   []float64
+	}{
+		{"increasing", []float64{1, 2, 3}, []float64{1, 2, 3}},
+		{"reset", []float64{5, 1, 2}, []float64{5, 5, 6}},
+		{"correction", []float64{5, 4.5, 6}, []float64{5, 5, 6.5}},
+		{"resets", []float64{3, 0, 2, 0}, []float64{3, 3, 5, 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counters := NewCounterTracker()
+			for i, value := range test.values {
+				if got := counters.Observe("bitcoin/test/paid", value); got != test.want[i] {
+					t.Errorf("Observe(%v) = %v, want %v", value, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCounterTrackerRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	counters, err := LoadCounterTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters.Observe("bitcoin/test/paid", 5)
+	counters.Observe("bitcoin/test/paid", 1)
+	if err := counters.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := LoadCounterTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The offset of the reset is kept, the counter does not go back
+	if got := restarted.Observe("bitcoin/test/paid", 2); got != 6 {
+		t.Errorf("Observe after restart = %v, want 6", got)
+	}
+	if got := restarted.Observe("bitcoin/test/value", 3); got != 3 {
+		t.Errorf("Observe of a new counter after restart = %v, want 3", got)
+	}
+}
+
+func TestLoadCounterTrackerLegacyState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	// State written by the versions storing the ledger transaction IDs
+	state := `{"last": {"bitcoin/test/paid": 1}, "offset": {"bitcoin/test/paid": 4}, "transactions": {"bitcoin/test": 42}}`
+	if err := os.WriteFile(path, []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+	counters, err := LoadCounterTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counters.Observe("bitcoin/test/paid", 1); got != 5 {
+		t.Errorf("Observe = %v, want 5", got)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// API token rotation without restart: the credentials are swapped atomically when the configuration
+// file changes or through the admin API, the requests made afterwards use the new tokens.
+// Tokens given as secret:// references are re-read when their file changes by themselves
+//   PUT /api/v1/admin/credentials (requires the admin token)
+
+const apiAdminCredentialsPath = "/api/v1/admin/credentials"
+
+// SetCredentials validates and replaces the credentials
+func (c *Config) SetCredentials(credentials []Credential) error {
+	for i := range credentials {
+		credential := &credentials[i]
+		if len(credential.Token) == 0 && len(credential.VaultPath) == 0 {
+			return fmt.Errorf("credential %d has no token nor vault_path", i)
+		}
+		if len(credential.Currency) != 0 {
+			credential.Currency = c.CanonicalCurrency(credential.Currency)
+		}
+		RedactSecret(Secret(credential.Token))
+	}
+
+	c.credentialsMutex.Lock()
+	defer c.credentialsMutex.Unlock()
+	c.Credentials = credentials
+	return nil
+}
+
+// WatchCredentials reloads the credentials of the configuration file when it is modified, checking
+// it every interval, it never returns
+func (c *Config) WatchCredentials(path string, interval time.Duration) {
+	modTime := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Println("Error watching configuration file", path, ":", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		reloaded, err := LoadConfig(path)
+		if err == nil {
+			err = c.SetCredentials(reloaded.Credentials)
+		}
+		if err != nil {
+			log.Println("Error reloading credentials from", path, ":", err)
+			continue
+		}
+		log.Println("Reloaded", len(reloaded.Credentials), "credentials from", path)
+	}
+}
+
+// ResolveToken returns the value of a bearer token flag, resolved once at startup: an unreadable or
+// empty secret reference is an error instead of an empty token
+func ResolveToken(name string, value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	token, err := ResolveSecret(value)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %v", name, err)
+	}
+	if len(token) == 0 {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	RedactSecret(token)
+	return token, nil
+}
+
+// Authorized checks the bearer token of a request, answering 401 otherwise. Every request is
+// rejected with an empty token (fail closed)
+func Authorized(w http.ResponseWriter, r *http.Request, token string) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return false
+	}
+	return true
+}
+
+// Replaces the credentials with the JSON list of the request body
+func (e *F2PoolExporter) serveCredentials(w http.ResponseWriter, r *http.Request) {
+	if !Authorized(w, r, e.adminToken) {
+		return
+	}
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	credentials := []Credential{}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := e.config.SetCredentials(credentials); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Println("Replaced credentials with", len(credentials), "credentials from", r.RemoteAddr)
+	writeJson(w, http.StatusOK, map[string]int{"credentials": len(credentials)})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          bool
+	}{
+		{name: "empty token, no header", token: "", authorization: "", want: false},
+		{name: "empty token, empty bearer", token: "", authorization: "Bearer ", want: false},
+		{name: "empty token, any bearer", token: "", authorization: "Bearer secret", want: false},
+		{name: "no header", token: "secret", authorization: "", want: false},
+		{name: "wrong token", token: "secret", authorization: "Bearer other", want: false},
+		{name: "token prefix", token: "secret", authorization: "Bearer secre", want: false},
+		{name: "bearer", token: "secret", authorization: "Bearer secret", want: true},
+		{name: "without bearer prefix", token: "secret", authorization: "secret", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/pause", nil)
+			if len(test.authorization) != 0 {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			if got := Authorized(w, r, test.token); got != test.want {
+				t.Errorf("Authorized = %v, want %v", got, test.want)
+			}
+			if !test.want && w.Code != http.StatusUnauthorized {
+				t.Errorf("Authorized answered %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if test.want && w.Code != http.StatusOK {
+				t.Errorf("Authorized answered %d for an authorized request", w.Code)
+			}
+		})
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "no flag", value: "", want: ""},
+		{name: "literal", value: "secret", want: "secret"},
+		{name: "secret file", value: secretPrefix + write("token", "secret\n"), want: "secret"},
+		{name: "missing secret file", value: secretPrefix + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "empty secret file", value: secretPrefix + write("empty", " \n"), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveToken("admin token", test.value)
+			if (err != nil) != test.wantErr || got != test.want {
+				t.Errorf("ResolveToken(%q) = %q, %v, want %q, error %v", test.value, got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Canonical currency identifiers: the lowercase F2Pool API names (bitcoin, litecoin, zec...), rather
+// than the symbols (btc): the API is called with these names and they are the currency label values of
+// the existing dashboards. Currencies of the resources and of every section of the configuration file
+// can be written with a symbol (btc), another common name (bitcoin-cash) or any case, they are converted
+// so that label values stay consistent and the configuration matches the resources
+
+var currencyAliases = map[string]string{
+	"btc":              "bitcoin",
+	"xbt":              "bitcoin",
+	"bch":              "bitcoincash",
+	"bitcoin-cash":     "bitcoincash",
+	"bsv":              "bitcoinsv",
+	"bitcoin-sv":       "bitcoinsv",
+	"ltc":              "litecoin",
+	"doge":             "dogecoin",
+	"eth":              "ethereum",
+	"etc":              "ethereumclassic",
+	"ethereum-classic": "ethereumclassic",
+	"zcash":            "zec",
+	"monero":           "xmr",
+	"decred":           "dcr",
+	"cfx":              "conflux",
+	"rvn":              "ravencoin",
+	"kas":              "kaspa",
+}
+
+// CanonicalCurrency returns the canonical identifier of a currency, configured aliases prevail
+// over the built-in ones, unknown currencies are only lowercased
+func (c *Config) CanonicalCurrency(currency string) string {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	for alias, canonical := range c.CurrencyAliases {
+		if strings.ToLower(alias) == currency {
+			return strings.ToLower(canonical)
+		}
+	}
+	if canonical, ok := currencyAliases[currency]; ok {
+		return canonical
+	}
+	return currency
+}
+
+// CanonicalResources converts the currencies of resources, removing the resulting duplicates
+func (c *Config) CanonicalResources(resources []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, resource := range resources {
+		if currency, account, ok := strings.Cut(resource, "/"); ok {
+			resource = c.CanonicalCurrency(currency) + "/" + account
+		}
+		if !seen[resource] {
+			seen[resource] = true
+			result = append(result, resource)
+		}
+	}
+	return result
+}
+
+// Converts the currency of a resource ({currency}/{account}) or currency key
+func (c *Config) canonicalKey(key string) string {
+	if currency, account, ok := strings.Cut(key, "/"); ok {
+		return c.CanonicalCurrency(currency) + "/" + account
+	}
+	return c.CanonicalCurrency(key)
+}
+
+// Converts the keys of a section of the configuration file, two keys converted to the same one
+// (e.g. btc and bitcoin) being an error
+func canonicalizeKeys[V any](section string, values map[string]V, canonical func(string) string) (map[string]V, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	converted := make(map[string]V, len(values))
+	originals := map[string]string{}
+	for _, key := range keys {
+		canonicalKey := canonical(key)
+		if other, ok := originals[canonicalKey]; ok {
+			return nil, fmt.Errorf("%s: %q and %q are both %q", section, other, key, canonicalKey)
+		}
+		originals[canonicalKey] = key
+		converted[canonicalKey] = values[key]
+	}
+	return converted, nil
+}
+
+// Converts the currencies written in the configuration file (empty ones still match any currency)
+func (c *Config) canonicalizeCurrencies() error {
+	canonical := func(currency *string) {
+		if len(*currency) != 0 {
+			*currency = c.CanonicalCurrency(*currency)
+		}
+	}
+
+	c.Resources = c.CanonicalResources(c.Resources)
+	for i := range c.Credentials {
+		canonical(&c.Credentials[i].Currency)
+	}
+	if c.Power != nil {
+		for i := range c.Power.Accounts {
+			canonical(&c.Power.Accounts[i].Currency)
+		}
+		for i := range c.Power.Workers {
+			canonical(&c.Power.Workers[i].Currency)
+		}
+	}
+	for i := range c.Hardware {
+		canonical(&c.Hardware[i].Currency)
+	}
+	for i := range c.WorkerGroups {
+		canonical(&c.WorkerGroups[i].Currency)
+	}
+	if c.Alerts != nil {
+		for i := range c.Alerts.Rules {
+			canonical(&c.Alerts.Rules[i].Currency)
+		}
+	}
+	for i := range c.AccountOnly {
+		c.AccountOnly[i] = c.canonicalKey(c.AccountOnly[i])
+	}
+
+	var err error
+	if c.Prices, err = canonicalizeKeys("prices", c.Prices, c.CanonicalCurrency); err != nil {
+		return err
+	}
+	if c.Algorithms, err = canonicalizeKeys("algorithms", c.Algorithms, c.CanonicalCurrency); err != nil {
+		return err
+	}
+	if c.PoolHashrates, err = canonicalizeKeys("pool_hashrates", c.PoolHashrates, c.CanonicalCurrency); err != nil {
+		return err
+	}
+	if c.Backends, err = canonicalizeKeys("backends", c.Backends, c.canonicalKey); err != nil {
+		return err
+	}
+	if c.PayoutThresholds, err = canonicalizeKeys("payout_thresholds", c.PayoutThresholds, c.canonicalKey); err != nil {
+		return err
+	}
+	if c.MergedMining, err = canonicalizeKeys("merged_mining", c.MergedMining, c.CanonicalCurrency); err != nil {
+		return err
+	}
+	for _, currencies := range c.MergedMining {
+		for i := range currencies {
+			currencies[i] = c.CanonicalCurrency(currencies[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Configuration loaded from a file of the given content
+func loadTestConfig(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+func TestCanonicalCurrency(t *testing.T) {
+	config := &Config{CurrencyAliases: map[string]string{"TBTC": "Bitcoin", "ltc": "litecoin-test"}}
+	tests := []struct {
+		currency string
+		want     string
+	}{
+		{"bitcoin", "bitcoin"},
+		{"BTC", "bitcoin"},
+		{" Bitcoin ", "bitcoin"},
+		{"bitcoin-cash", "bitcoincash"},
+		{"zcash", "zec"},
+		{"tbtc", "bitcoin"},
+		// Configured aliases prevail over the built-in ones
+		{"LTC", "litecoin-test"},
+		{"unknown", "unknown"},
+	}
+	for _, test := range tests {
+		if got := config.CanonicalCurrency(test.currency); got != test.want {
+			t.Errorf("CanonicalCurrency(%q) = %q, want %q", test.currency, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigCanonicalCurrencies(t *testing.T) {
+	config, err := loadTestConfig(t, `{
+		"resources": ["BTC/user", "bitcoin/user", "ltc/other"],
+		"backends": {"btc/user": "f2pool-v2", "LTC": "f2pool"},
+		"merged_mining": {"ltc": ["doge"]},
+		"payout_thresholds": {"btc": 0.005, "ltc/other": 0.1},
+		"pool_hashrates": {"BTC": 1e20},
+		"account_only": ["btc/user", "ltc"],
+		"prices": {"btc": {"provider": "fixed", "rates": {"usd": 1}}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bitcoin/user", "litecoin/other"}; !reflect.DeepEqual(config.Resources, want) {
+		t.Errorf("resources = %v, want %v", config.Resources, want)
+	}
+	if backend := config.BackendNameFor("bitcoin", "user"); backend != "f2pool-v2" {
+		t.Errorf("backend of bitcoin/user = %q, want f2pool-v2", backend)
+	}
+	if backend := config.BackendNameFor("litecoin", "other"); backend != "f2pool" {
+		t.Errorf("backend of litecoin/other = %q, want f2pool", backend)
+	}
+	if merged := config.MergedCurrenciesFor("litecoin"); !reflect.DeepEqual(merged, []string{"dogecoin"}) {
+		t.Errorf("merged currencies of litecoin = %v, want [dogecoin]", merged)
+	}
+	if threshold, ok := config.PayoutThresholdFor("bitcoin", "user"); !ok || threshold != 0.005 {
+		t.Errorf("payout threshold of bitcoin/user = %v, %v, want 0.005", threshold, ok)
+	}
+	if threshold, ok := config.PayoutThresholdFor("litecoin", "other"); !ok || threshold != 0.1 {
+		t.Errorf("payout threshold of litecoin/other = %v, %v, want 0.1", threshold, ok)
+	}
+	if hashrate, ok := config.PoolHashrates["bitcoin"]; !ok || hashrate != 1e20 {
+		t.Errorf("pool hashrate of bitcoin = %v, %v, want 1e20", hashrate, ok)
+	}
+	if !config.AccountOnlyFor("bitcoin", "user") || !config.AccountOnlyFor("litecoin", "any") || config.AccountOnlyFor("bitcoin", "other") {
+		t.Errorf("account only = %v, want bitcoin/user and litecoin", config.AccountOnly)
+	}
+	if _, ok := config.Prices["bitcoin"]; !ok {
+		t.Errorf("prices = %v, want bitcoin", config.Prices)
+	}
+}
+
+func TestLoadConfigDuplicateCurrencies(t *testing.T) {
+	tests := []string{
+		`{"backends": {"btc": "f2pool", "bitcoin": "f2pool-v2"}}`,
+		`{"backends": {"btc/user": "f2pool", "bitcoin/user": "f2pool-v2"}}`,
+		`{"payout_thresholds": {"BTC": 1, "btc": 2}}`,
+		`{"pool_hashrates": {"ltc": 1, "litecoin": 2}}`,
+		`{"merged_mining": {"ltc": ["doge"], "litecoin": ["dogecoin"]}}`,
+		`{"algorithms": {"kas": {"name": "kheavyhash"}, "kaspa": {"name": "kheavyhash"}}}`,
+	}
+	for _, content := range tests {
+		if _, err := loadTestConfig(t, content); err == nil {
+			t.Errorf("LoadConfig(%s) = nil error, want an error", content)
+		}
+	}
+}
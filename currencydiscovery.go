@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// Currency discovery: finds the currencies mined by a user (or address). With an API token the
+// wallets of the mining user (v2 API) are listed, otherwise every known currency is probed on
+// the v1 API and the ones with activity (revenue, balance or hashrate) are kept
+
+type CurrencyDiscoverer struct {
+	client *http.Client
+	config *Config
+	users  []string
+}
+
+func NewCurrencyDiscoverer(client *http.Client, config *Config, users []string) *CurrencyDiscoverer {
+	return &CurrencyDiscoverer{client: client, config: config, users: users}
+}
+
+func (d *CurrencyDiscoverer) Discover() ([]string, error) {
+	resources := []string{}
+	for _, user := range d.users {
+		currencies, err := d.currencies(user)
+		if err != nil {
+			return nil, err
+		}
+		for _, currency := range currencies {
+			resources = append(resources, currency+"/"+user)
+		}
+	}
+	return resources, nil
+}
+
+func (d *CurrencyDiscoverer) currencies(user string) ([]string, error) {
+	if token := d.config.TokenFor("", user); len(token) != 0 {
+		miningUser, err := FetchMiningUser(d.client, token, user)
+		if err != nil {
+			return nil, err
+		}
+		currencies := []string{}
+		for _, wallet := range miningUser.Wallets {
+			currencies = append(currencies, d.config.CanonicalCurrency(wallet.Currency))
+		}
+		return currencies, nil
+	}
+
+	known := []string{}
+	for currency := range currencyAlgorithms {
+		known = append(known, currency)
+	}
+	sort.Strings(known)
+
+	currencies := []string{}
+	for _, currency := range known {
+		body, err := HttpGetCall(d.client, f2poolApiUrl+currency+"/"+user, "")
+		if err != nil {
+			log.Println("Error probing", currency, "of", user, ":", err)
+			continue
+		}
+		var infos struct {
+			Value    float64 `json:"value"`
+			Balance  float64 `json:"balance"`
+			Hashrate float64 `json:"hashrate"`
+		}
+		if err := json.Unmarshal([]byte(body), &infos); err != nil {
+			continue
+		}
+		if infos.Value > 0 || infos.Balance > 0 || infos.Hashrate > 0 {
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies, nil
+}
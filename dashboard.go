@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Dashboard command: writes a Grafana dashboard (to be imported) for the configured currencies,
+// with a row of panels per currency
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefId        string `json:"refId"`
+}
+
+type grafanaPanel struct {
+	Id          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	GridPos     map[string]int         `json:"gridPos"`
+	Datasource  map[string]string      `json:"datasource,omitempty"`
+	Targets     []grafanaTarget        `json:"targets,omitempty"`
+	FieldConfig map[string]interface{} `json:"fieldConfig,omitempty"`
+	Collapsed   bool                   `json:"collapsed,omitempty"`
+}
+
+var grafanaDatasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+
+func runDashboard(resources []string, out io.Writer) error {
+	currencies := []string{}
+	accounts := map[string][]string{}
+	for _, resource := range resources {
+		tmp := strings.Split(resource, "/")
+		if _, ok := accounts[tmp[0]]; !ok {
+			currencies = append(currencies, tmp[0])
+		}
+		accounts[tmp[0]] = append(accounts[tmp[0]], AccountLabel(tmp[1]))
+	}
+	sort.Strings(currencies)
+
+	panels := []grafanaPanel{}
+	y := 0
+	add := func(panel grafanaPanel, w int, h int, x int) {
+		panel.Id = len(panels) + 1
+		panel.GridPos = map[string]int{"h": h, "w": w, "x": x, "y": y}
+		if panel.Type != "row" {
+			panel.Datasource = grafanaDatasource
+		}
+		panels = append(panels, panel)
+	}
+
+	for _, currency := range currencies {
+		selector := fmt.Sprintf(`currency="%s",account=~"$account"`, currency)
+		workers := fmt.Sprintf(`,worker!=%q`, *accountWorker)
+		unit := map[string]interface{}{"defaults": map[string]string{"unit": currency}}
+
+		add(grafanaPanel{Type: "row", Title: currency}, 24, 1, 0)
+		y++
+		add(grafanaPanel{Type: "stat", Title: "Balance", FieldConfig: unit,
+			Targets: []grafanaTarget{{Expr: "f2pool_balance{" + selector + "}", LegendFormat: "{{account}}", RefId: "A"}}}, 6, 4, 0)
+		add(grafanaPanel{Type: "stat", Title: "Revenue of last 24 hours", FieldConfig: unit,
+			Targets: []grafanaTarget{{Expr: "f2pool_value_last_day{" + selector + "}", LegendFormat: "{{account}}", RefId: "A"}}}, 6, 4, 6)
+		add(grafanaPanel{Type: "stat", Title: "Paid", FieldConfig: unit,
+			Targets: []grafanaTarget{{Expr: "f2pool_paid{" + selector + "}", LegendFormat: "{{account}}", RefId: "A"}}}, 6, 4, 12)
+		add(grafanaPanel{Type: "stat", Title: "Hashing workers",
+			Targets: []grafanaTarget{{Expr: "count by (account) (f2pool_hashrate{" + selector + workers + "} > 0)", LegendFormat: "{{account}}", RefId: "A"}}}, 6, 4, 18)
+		y += 4
+		add(grafanaPanel{Type: "timeseries", Title: "Hashrate",
+			FieldConfig: map[string]interface{}{"defaults": map[string]string{"unit": "H/s"}},
+			Targets:     []grafanaTarget{{Expr: "f2pool_hashrate{" + selector + workers + "}", LegendFormat: "{{account}} {{worker}}", RefId: "A"}}}, 12, 8, 0)
+		add(grafanaPanel{Type: "timeseries", Title: "Stale rejected ratio of last hour",
+			FieldConfig: map[string]interface{}{"defaults": map[string]string{"unit": "percentunit"}},
+			Targets: []grafanaTarget{{Expr: "f2pool_stale_hashes_rejected_last_hour{" + selector + "} / (f2pool_hashes_last_hour{" + selector + "} > 0)",
+				LegendFormat: "{{account}} {{worker}}", RefId: "A"}}}, 12, 8, 12)
+		y += 8
+		add(grafanaPanel{Type: "table", Title: "Time since last share",
+			FieldConfig: map[string]interface{}{"defaults": map[string]string{"unit": "s"}},
+			Targets:     []grafanaTarget{{Expr: "f2pool_worker_idle_seconds{" + selector + "}", LegendFormat: "{{account}} {{worker}}", RefId: "A"}}}, 24, 8, 0)
+		y += 8
+	}
+
+	allAccounts := []string{}
+	for _, currency := range currencies {
+		allAccounts = append(allAccounts, accounts[currency]...)
+	}
+
+	dashboard := map[string]interface{}{
+		"title":         "F2Pool",
+		"uid":           "f2pool-exporter",
+		"tags":          []string{"f2pool", "mining"},
+		"timezone":      "browser",
+		"schemaVersion": 36,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"panels":        panels,
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"name": "datasource", "type": "datasource", "query": "prometheus", "label": "Data source"},
+				map[string]interface{}{
+					"name":       "account",
+					"type":       "custom",
+					"label":      "Account",
+					"query":      strings.Join(allAccounts, ","),
+					"multi":      true,
+					"includeAll": true,
+					"allValue":   ".*",
+					"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+				},
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dashboard)
+}
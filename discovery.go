@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource discovery: resources retrieved from external sources, in addition to the static ones
+// (--resources and configuration file), and refreshed periodically
+
+type Discoverer interface {
+	Discover() ([]string, error)
+}
+
+type DiscoveryConfig struct {
+	Name       string
+	Discoverer Discoverer
+	// Interval between two discoveries, 0 for discoverers watching changes (Discover blocks until a change)
+	Interval time.Duration
+}
+
+// Minimum interval between two discoveries of the discoverers watching changes
+const minWatchInterval = time.Second
+
+// ResourceSet is the current list of resources: static ones and the last ones of each discovery
+type ResourceSet struct {
+	mutex      sync.RWMutex
+	config     *Config
+	static     []string
+	discovered map[string][]string
+	// Only the resources of the shard are retrieved (index from 1 to count), no sharding if count is 0
+	shardIndex int
+	shardCount int
+}
+
+func NewResourceSet(config *Config, static []string) *ResourceSet {
+	return &ResourceSet{config: config, static: static, discovered: map[string][]string{}}
+}
+
+// All returns the static resources followed by the discovered ones, without duplicates
+func (s *ResourceSet) All() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := make([]string, 0, len(s.discovered))
+	for name := range s.discovered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resources := append([]string{}, s.static...)
+	for _, name := range names {
+		resources = append(resources, s.discovered[name]...)
+	}
+	resources = s.config.CanonicalResources(resources)
+
+	if s.shardCount == 0 {
+		return resources
+	}
+	sharded := []string{}
+	for _, resource := range resources {
+		if ResourceShard(resource, s.shardCount) == s.shardIndex {
+			sharded = append(sharded, resource)
+		}
+	}
+	return sharded
+}
+
+// SetShard restricts the resources to a shard, given as {index}/{count} (e.g. 2/5)
+func (s *ResourceSet) SetShard(shard string) error {
+	index, count := 0, 0
+	if _, err := fmt.Sscanf(shard, "%d/%d", &index, &count); err != nil || count < 1 || index < 1 || index > count {
+		return fmt.Errorf("invalid shard %q, expected {index}/{count} with index from 1 to count", shard)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.shardIndex = index
+	s.shardCount = count
+	return nil
+}
+
+// ResourceShard returns the shard (from 1 to count) of a resource, from a hash of the resource
+func ResourceShard(resource string, count int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(resource))
+	return int(hash.Sum32()%uint32(count)) + 1
+}
+
+// Set replaces the resources of a discovery
+func (s *ResourceSet) Set(name string, resources []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.discovered[name] = resources
+}
+
+// Refresh runs a discovery, the previous resources of the discovery are kept on error
+func (s *ResourceSet) Refresh(discovery *DiscoveryConfig) error {
+	discovered, err := discovery.Discoverer.Discover()
+	if err != nil {
+		return err
+	}
+	resources := []string{}
+	for _, resource := range discovered {
+		if currency, account, ok := strings.Cut(resource, "/"); !ok || len(currency) == 0 || len(account) == 0 {
+			log.Println("Invalid resource", resource, "discovered from", discovery.Name)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	s.Set(discovery.Name, resources)
+	return nil
+}
+
+// RunDiscovery refreshes the resources of a discovery every interval (continuously for watching
+// discoverers), it never returns
+func (s *ResourceSet) RunDiscovery(discovery *DiscoveryConfig) {
+	if discovery.Interval == 0 {
+		for {
+			start := time.Now()
+			if err := s.Refresh(discovery); err != nil {
+				log.Println("Error discovering resources from", discovery.Name, ":", err)
+				time.Sleep(10 * time.Second)
+			}
+			// A watch answering immediately (e.g. without blocking support) is not polled in a loop
+			if wait := minWatchInterval - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(discovery.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Refresh(discovery); err != nil {
+			log.Println("Error discovering resources from", discovery.Name, ":", err)
+		}
+	}
+}
+
+// HttpDiscoverer retrieves the resources from an URL returning JSON, either a list of resources,
+// an object with a resources list or Prometheus HTTP service discovery target groups
+type HttpDiscoverer struct {
+	client *http.Client
+	url    string
+	// ETag and resources of the last answer, returned when the list is not modified
+	etag      string
+	resources []string
+}
+
+func NewHttpDiscoverer(client *http.Client, url string) *HttpDiscoverer {
+	return &HttpDiscoverer{client: client, url: url}
+}
+
+func (d *HttpDiscoverer) Discover() ([]string, error) {
+	req, err := http.NewRequest("GET", d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(d.etag) != 0 {
+		req.Header.Set("If-None-Match", d.etag)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return d.resources, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	resources, err := parseDiscoveredResources(body)
+	if err != nil {
+		return nil, err
+	}
+	d.etag = resp.Header.Get("ETag")
+	d.resources = resources
+	return resources, nil
+}
+
+func parseDiscoveredResources(body []byte) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal(body, &list); err == nil {
+		return list, nil
+	}
+
+	var object struct {
+		Resources []string `json:"resources"`
+	}
+	if err := json.Unmarshal(body, &object); err == nil {
+		return object.Resources, nil
+	}
+
+	var groups []struct {
+		Targets []string `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &groups); err != nil {
+		return nil, fmt.Errorf("unexpected resources format: %w", err)
+	}
+	resources := []string{}
+	for _, group := range groups {
+		resources = append(resources, group.Targets...)
+	}
+	return resources, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHttpDiscovererDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "list", body: `["bitcoin/a", "litecoin/b"]`, want: []string{"bitcoin/a", "litecoin/b"}},
+		{name: "object", body: `{"resources": ["bitcoin/a"]}`, want: []string{"bitcoin/a"}},
+		{
+			name: "target groups",
+			body: `[{"targets": ["bitcoin/a"], "labels": {"site": "1"}}, {"targets": ["litecoin/b"]}]`,
+			want: []string{"bitcoin/a", "litecoin/b"},
+		},
+		{name: "invalid", body: `"bitcoin/a"`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			got, err := NewHttpDiscoverer(server.Client(), server.URL).Discover()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Discover = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Discover = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHttpDiscovererNotModified(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`["bitcoin/a"]`))
+	}))
+	defer server.Close()
+
+	discoverer := NewHttpDiscoverer(server.Client(), server.URL)
+	for i := 0; i < 2; i++ {
+		got, err := discoverer.Discover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, []string{"bitcoin/a"}) {
+			t.Errorf("Discover %d = %v, want [bitcoin/a]", i, got)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestResourceSetRefresh(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`["bitcoin/a", "invalid", "/b", "litecoin/c"]`))
+	}))
+	defer server.Close()
+
+	resources := NewResourceSet(&Config{}, []string{"bitcoin/static"})
+	discovery := &DiscoveryConfig{Name: "http", Discoverer: NewHttpDiscoverer(server.Client(), server.URL)}
+	if err := resources.Refresh(discovery); err != nil {
+		t.Fatal(err)
+	}
+	// Invalid resources are dropped
+	want := []string{"bitcoin/static", "bitcoin/a", "litecoin/c"}
+	if got := resources.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("All = %v, want %v", got, want)
+	}
+
+	// The previous resources are kept on error
+	status = http.StatusInternalServerError
+	if err := resources.Refresh(discovery); err == nil {
+		t.Error("Refresh = nil error, want the status error")
+	}
+	if got := resources.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("All after an error = %v, want %v", got, want)
+	}
+}
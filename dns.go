@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS resolution of the F2Pool API: lookups are cached for --dns-cache-ttl (the last addresses
+// being used when a lookup fails, for networks with flaky DNS), and hosts can be resolved to static
+// addresses with --resolve (e.g. api.f2pool.com=1.2.3.4 to pin an API POP). TLS still uses the
+// host name of the URL
+
+type cachedAddresses struct {
+	addresses []string
+	resolved  time.Time
+}
+
+type DnsCache struct {
+	ttl       time.Duration
+	overrides map[string][]string
+	dialer    *net.Dialer
+
+	mutex   sync.Mutex
+	entries map[string]cachedAddresses
+}
+
+func NewDnsCache(ttl time.Duration, overrides map[string][]string) *DnsCache {
+	return &DnsCache{
+		ttl:       ttl,
+		overrides: overrides,
+		dialer:    &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries:   map[string]cachedAddresses{},
+	}
+}
+
+// ParseResolve parses the static addresses, host=address separated by commas, a host given several
+// times having several addresses
+func ParseResolve(value string) (map[string][]string, error) {
+	overrides := map[string][]string{}
+	for _, entry := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+		host, address, ok := strings.Cut(entry, "=")
+		host, address = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(address)
+		if !ok || len(host) == 0 || net.ParseIP(address) == nil {
+			return nil, fmt.Errorf("invalid resolve %q, expected {host}={IP address}", entry)
+		}
+		overrides[host] = append(overrides[host], address)
+	}
+	return overrides, nil
+}
+
+// Len returns the number of cached hosts
+func (c *DnsCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Lookup returns the addresses of a host
+func (c *DnsCache) Lookup(ctx context.Context, host string) ([]string, error) {
+	if addresses, ok := c.overrides[strings.ToLower(host)]; ok {
+		return addresses, nil
+	}
+
+	c.mutex.Lock()
+	entry, ok := c.entries[host]
+	c.mutex.Unlock()
+	fresh := ok && time.Since(entry.resolved) < c.ttl
+	cacheStats.Lookup("dns_addresses", fresh)
+	if fresh {
+		return entry.addresses, nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		if ok {
+			log.Println("Error resolving", host, ", using last addresses:", err)
+			return entry.addresses, nil
+		}
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.entries[host] = cachedAddresses{addresses: addresses, resolved: time.Now()}
+	c.mutex.Unlock()
+	return addresses, nil
+}
+
+// DialContext connects to the first reachable address of the host, as the transport dialer
+func (c *DnsCache) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, address)
+	}
+
+	addresses, err := c.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	err = errors.New("no address for " + host)
+	for _, ip := range addresses {
+		var conn net.Conn
+		if conn, err = c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
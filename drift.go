@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Drift detection of the F2Pool API: fields of the answers the exporter does not know about are
+// counted by endpoint, and logged once, so that new data worth exporting is noticed early
+
+// Fields of the v1 account answers not used by the exporter, but known
+var accountPayloadIgnoredFields = []string{"worker_length", "worker_length_online", "local_hash", "fixed_value"}
+
+var f2pool_api_unknown_fields_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "api", "unknown_fields_total"),
+	"Fields of the F2Pool API answers unknown to the exporter", []string{"endpoint"}, nil)
+
+type FieldDrift struct {
+	mutex  sync.Mutex
+	counts map[string]float64
+	// Unknown fields already logged, by endpoint and field path
+	logged map[string]bool
+}
+
+var apiDrift = &FieldDrift{counts: map[string]float64{}, logged: map[string]bool{}}
+
+// Observe counts the unknown fields of an answer, logging the new ones
+func (d *FieldDrift) Observe(endpoint string, fields []string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.counts[endpoint]; !ok {
+		d.counts[endpoint] = 0
+	}
+	for _, field := range fields {
+		d.counts[endpoint]++
+		if key := endpoint + " " + field; !d.logged[key] {
+			d.logged[key] = true
+			log.Println("Unknown field", field, "in F2Pool API answers of", endpoint)
+		}
+	}
+}
+
+func (d *FieldDrift) Collect(ch chan<- prometheus.Metric) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for endpoint, count := range d.counts {
+		ch <- prometheus.MustNewConstMetric(f2pool_api_unknown_fields_total, prometheus.CounterValue, count, endpoint)
+	}
+}
+
+// unknownFields returns the paths of the JSON fields (e.g. mining_user.wallets.extra) which are not
+// decoded in the target structure
+func unknownFields(data []byte, target interface{}) []string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	unknown := map[string]bool{}
+	collectUnknownFields(value, reflect.TypeOf(target), "", unknown)
+	fields := []string{}
+	for field := range unknown {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func collectUnknownFields(value interface{}, t reflect.Type, path string, unknown map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, item := range v {
+				collectUnknownFields(item, t.Elem(), path, unknown)
+			}
+		}
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if len(name) == 0 {
+				name = field.Name
+			}
+			fields[name] = field.Type
+		}
+		for name, item := range v {
+			fieldType, ok := fields[name]
+			if !ok {
+				unknown[strings.TrimPrefix(path+"."+name, ".")] = true
+				continue
+			}
+			collectUnknownFields(item, fieldType, path+"."+name, unknown)
+		}
+	}
+}
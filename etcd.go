@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etcd discovery: every key under the prefix is a resource, its path relative to the prefix
+// being {currency}/{account} (e.g. /f2pool/resources/bitcoin/youraccountname), values are ignored.
+// The etcd v3 JSON gateway is used, changes are watched with its watch stream
+// See: https://etcd.io/docs/latest/dev-guide/api_grpc_gateway/
+
+// Maximum duration of a watch, the resources are then retrieved again
+const etcdWatchTimeout = 10 * time.Minute
+
+type EtcdDiscoverer struct {
+	client   *http.Client
+	endpoint string
+	prefix   string
+	username string
+	password string
+	// Authentication token, retrieved with the username and password
+	token string
+	// Revision of the last retrieval, the next discovery watches the changes after it
+	revision int64
+}
+
+func NewEtcdDiscoverer(endpoint string, prefix string, username string, password string) *EtcdDiscoverer {
+	return &EtcdDiscoverer{
+		client:   &http.Client{},
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		prefix:   strings.TrimSuffix(prefix, "/") + "/",
+		username: username,
+		password: password,
+	}
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+// Discover blocks until a key under the prefix changes (or the watch times out) and returns the
+// resources, the first call returns immediately
+func (d *EtcdDiscoverer) Discover() ([]string, error) {
+	if d.revision != 0 {
+		if err := d.watch(); err != nil {
+			return nil, err
+		}
+	}
+
+	var result struct {
+		Header etcdHeader `json:"header"`
+		Kvs    []struct {
+			Key string `json:"key"`
+		} `json:"kvs"`
+	}
+	request := map[string]interface{}{
+		"key":       base64.StdEncoding.EncodeToString([]byte(d.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(etcdPrefixEnd(d.prefix)),
+		"keys_only": true,
+	}
+	if err := d.call(context.Background(), "/v3/kv/range", request, &result); err != nil {
+		return nil, err
+	}
+	d.revision, _ = strconv.ParseInt(result.Header.Revision, 10, 64)
+
+	resources := []string{}
+	for _, kv := range result.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if resource := strings.TrimPrefix(string(key), d.prefix); len(resource) != 0 {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+// Waits for the first change under the prefix after the last retrieval
+func (d *EtcdDiscoverer) watch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdWatchTimeout)
+	defer cancel()
+
+	request := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            base64.StdEncoding.EncodeToString([]byte(d.prefix)),
+			"range_end":      base64.StdEncoding.EncodeToString(etcdPrefixEnd(d.prefix)),
+			"start_revision": strconv.FormatInt(d.revision+1, 10),
+		},
+	}
+	resp, err := d.post(ctx, "/v3/watch", request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Events          []json.RawMessage `json:"events"`
+				Canceled        bool              `json:"canceled"`
+				CompactRevision string            `json:"compact_revision"`
+				CancelReason    string            `json:"cancel_reason"`
+			} `json:"result"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if ctx.Err() != nil {
+				// No change during the watch
+				return nil
+			}
+			return err
+		}
+		if message.Result.Canceled {
+			if len(message.Result.CompactRevision) != 0 {
+				// The revision was compacted, the resources are retrieved again
+				return nil
+			}
+			return fmt.Errorf("etcd: watch canceled: %s", message.Result.CancelReason)
+		}
+		if len(message.Result.Events) != 0 {
+			return nil
+		}
+	}
+}
+
+func (d *EtcdDiscoverer) call(ctx context.Context, path string, request interface{}, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := d.post(ctx, path, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Posts a request to the gateway, authenticating first if needed
+func (d *EtcdDiscoverer) post(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	if len(d.username) != 0 && len(d.token) == 0 {
+		if err := d.authenticate(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := d.postRequest(ctx, path, request)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && len(d.username) != 0 {
+		// Expired token
+		resp.Body.Close()
+		if err := d.authenticate(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = d.postRequest(ctx, path, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("etcd: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func (d *EtcdDiscoverer) postRequest(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(d.token) != 0 {
+		req.Header.Set("Authorization", d.token)
+	}
+	return d.client.Do(req)
+}
+
+func (d *EtcdDiscoverer) authenticate(ctx context.Context) error {
+	d.token = ""
+	resp, err := d.postRequest(ctx, "/v3/auth/authenticate", map[string]string{"name": d.username, "password": Secret(d.password)})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd: authentication failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	d.token = result.Token
+	return nil
+}
+
+// End of the key range of a prefix: the prefix with its last byte incremented
+func etcdPrefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every key
+	return []byte{0}
+}
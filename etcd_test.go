@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []byte
+	}{
+		{"/f2pool/", []byte("/f2pool0")},
+		{"a\xff", []byte("b")},
+		{"\xff\xff", []byte{0}},
+	}
+	for _, test := range tests {
+		if got := etcdPrefixEnd(test.prefix); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("etcdPrefixEnd(%q) = %q, want %q", test.prefix, got, test.want)
+		}
+	}
+}
+
+// Fake etcd JSON gateway, the tokens expire after each range and the watch answers are consumed in order
+type fakeEtcd struct {
+	mutex    sync.Mutex
+	tokens   int
+	valid    string
+	revision int
+	keys     []string
+	watches  []string
+	// Start revisions of the watches
+	starts []string
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var request map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	if r.URL.Path == "/v3/auth/authenticate" {
+		if request["name"] != "user" || request["password"] != "secret" {
+			http.Error(w, `{"error": "authentication failed"}`, http.StatusBadRequest)
+			return
+		}
+		e.tokens++
+		e.valid = fmt.Sprint("token-", e.tokens)
+		json.NewEncoder(w).Encode(map[string]string{"token": e.valid})
+		return
+	}
+	if r.Header.Get("Authorization") != e.valid {
+		http.Error(w, `{"error": "invalid auth token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		if want := base64.StdEncoding.EncodeToString([]byte("/f2pool/")); request["key"] != want {
+			http.Error(w, "unexpected key", http.StatusBadRequest)
+			return
+		}
+		kvs := []map[string]string{}
+		for _, key := range e.keys {
+			kvs = append(kvs, map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(key))})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"header": etcdHeader{Revision: fmt.Sprint(e.revision)}, "kvs": kvs})
+		e.valid = ""
+	case "/v3/watch":
+		e.starts = append(e.starts, request["create_request"].(map[string]interface{})["start_revision"].(string))
+		// The watch is created first, the change is streamed afterwards
+		w.Write([]byte(`{"result": {"created": true}}` + "\n" + e.watches[0]))
+		e.watches = e.watches[1:]
+	}
+}
+
+func TestEtcdDiscovererDiscover(t *testing.T) {
+	etcd := &fakeEtcd{
+		revision: 5,
+		keys:     []string{"/f2pool/bitcoin/a", "/f2pool/litecoin/b"},
+		watches: []string{
+			`{"result": {"events": [{"type": "PUT"}]}}`,
+			`{"result": {"canceled": true, "compact_revision": "7"}}`,
+			`{"result": {"canceled": true, "cancel_reason": "permission denied"}}`,
+		},
+	}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	discoverer := NewEtcdDiscoverer(server.URL+"/", "/f2pool", "user", "secret")
+	for i, want := range [][]string{{"bitcoin/a", "litecoin/b"}, {"bitcoin/a"}, {"bitcoin/a"}} {
+		got, err := discoverer.Discover()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Discover %d = %v, want %v", i, got, want)
+		}
+		etcd.mutex.Lock()
+		etcd.revision++
+		etcd.keys = etcd.keys[:1]
+		etcd.mutex.Unlock()
+	}
+	if _, err := discoverer.Discover(); err == nil {
+		t.Error("Discover after a canceled watch = nil error, want an error")
+	}
+
+	// Changes are watched after the revision of the last retrieval
+	if want := []string{"6", "7", "8"}; !reflect.DeepEqual(etcd.starts, want) {
+		t.Errorf("watch start revisions = %v, want %v", etcd.starts, want)
+	}
+	if etcd.tokens < 4 {
+		t.Errorf("%d authentications, want the expired tokens renewed", etcd.tokens)
+	}
+}
+
+func TestEtcdDiscovererAuthenticationFailed(t *testing.T) {
+	server := httptest.NewServer(&fakeEtcd{})
+	defer server.Close()
+
+	if _, err := NewEtcdDiscoverer(server.URL, "/f2pool", "user", "wrong").Discover(); err == nil {
+		t.Error("Discover with a wrong password = nil error, want an error")
+	}
+}
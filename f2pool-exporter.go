@@ -1,16 +1,21 @@
 package main
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
-	"encoding/json"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"time"
 	"strings"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -18,45 +23,391 @@ import (
 var (
 	listenAddress = flag.String("listen-address", ":5896", "Address to listen on for web interface and telemetry")
 	metricsPath   = flag.String("telemetry-path", "/metrics", "Path to expose metrics of the exporter")
+	webTlsCertFile = flag.String("web-tls-cert-file", "", "Certificate file of the web server, served over HTTPS if set (with --web-tls-key-file)")
+	webTlsKeyFile = flag.String("web-tls-key-file", "", "Private key file of the web server certificate")
+	webTlsMinVersion = flag.String("web-tls-min-version", "TLS1.2", "Minimum TLS version of the web server (TLS1.2 or TLS1.3)")
+	webTlsCipherSuites = flag.String("web-tls-cipher-suites", "", "TLS 1.2 cipher suites of the web server, separated by commas, Go defaults if empty")
+	webTlsClientCaFile = flag.String("web-tls-client-ca-file", "", "CA certificates file verifying the client certificates required by the web server, disabled if empty")
+	webTlsClientAuthPaths = flag.String("web-tls-client-auth-paths", "", "Paths (prefixes, e.g. /metrics,/api/v1/admin) requiring a client certificate, separated by commas, every path if empty")
+	webCompression = flag.Bool("web-compression", true, "Compress the answers of the web server (metrics, JSON API) with gzip for the clients accepting it")
+	webMaxRequests = flag.Int("web-max-requests", 40, "Maximum concurrent scrapes, the next ones are answered with the 503 status, no limit if 0")
+	webUi = flag.Bool("web-ui", true, "Serve the web dashboard of the accounts and workers at /ui/")
+	backendArg = flag.String("backend", "f2pool", "Pool backend of the resources without configured backend (f2pool or f2pool-v2, the latter requiring a token)")
 	resourcesArg = flag.String("resources", "", "Resources ({currency}/{user or address}) to retrieve, separated by commas")
+	constLabels = flag.String("const-labels", "", "Constant labels (name=value) added to every exported series, separated by commas")
+	workerSanitize = flag.String("worker-sanitize", "none", "Handling of the worker names with characters other than letters, digits, '_', '-', '.' and ':' (none, replace, hash or drop)")
+	accountWorker = flag.String("account-worker", "all", "Worker label value of the account-level series, empty to omit the worker label on them")
+	hashrateBaselineWindow = flag.Duration("hashrate-baseline-window", 24*time.Hour, "Window of the moving average of the hashrates f2pool_hashrate_deviation_ratio is computed from, disabled if 0")
+	workerFlapWindow = flag.Duration("worker-flap-window", time.Hour, "Window of the online / offline transitions of the workers counted by f2pool_worker_flaps_recent, disabled if 0")
+	workerShareTimeLayouts = flag.String("worker-share-time-layouts", "2006-01-02T15:04:05Z07:00,2006-01-02T15:04:05,2006-01-02 15:04:05,unix", "Go time layouts (or unix and unixmilli for epoch times) the last share times of the workers are parsed with, tried in order and separated by commas")
+	workerShareTimezone = flag.String("worker-share-timezone", "UTC", "Time zone of the worker last share times without time zone")
+	workerIdleAfter = flag.Duration("worker-idle-after", 15 * time.Minute, "Time without share after which a worker is idle, in the f2pool_workers states")
+	workerDeadAfter = flag.Duration("worker-dead-after", 24 * time.Hour, "Time without share after which a worker is dead, in the f2pool_workers states")
+	workerDegradedRatio = flag.Float64("worker-degraded-ratio", 0.8, "Ratio of its hashrate of the last 24 hours under which a hashing worker is degraded, in the f2pool_workers states")
+	rejectRateThreshold = flag.Float64("reject-rate-threshold", 0.05, "Stale rejected ratio of the last hour over which the reject rate of a worker is high (f2pool_worker_reject_rate_high, reject_rate_high alert rule)")
+	apiTimestamps = flag.Bool("api-timestamps", false, "Stamp account and worker samples with the last update time of the API data instead of the scrape time")
+	openMetricsCreated = flag.Bool("openmetrics-created-timestamps", false, "Add created timestamps of counters to the OpenMetrics exposition")
+	resourcesUrl = flag.String("resources-url", "", "URL returning the resources to retrieve as JSON, added to the static ones, disabled if empty")
+	resourcesUrlInterval = flag.Duration("resources-url-interval", 5 * time.Minute, "Interval between two retrievals of the resources URL")
+	discoverCurrencies = flag.String("discover-currencies", "", "Users (or addresses) whose mined currencies are discovered and retrieved, separated by commas")
+	discoverCurrenciesInterval = flag.Duration("discover-currencies-interval", time.Hour, "Interval between two currency discoveries")
+	shard = flag.String("shard", "", "Shard ({index}/{count}, e.g. 2/5) of the resources retrieved by this instance, resources are distributed by hash, all resources if empty")
+	leaseName = flag.String("k8s-lease-name", "", "Kubernetes Lease used to elect the replica retrieving the data (active/standby mode), disabled if empty")
+	leaseNamespace = flag.String("k8s-lease-namespace", "", "Namespace of the Kubernetes Lease, the one of the pod if empty")
+	leaseIdentity = flag.String("k8s-lease-identity", "", "Identity of this replica in the Kubernetes Lease, the hostname (pod name) if empty")
+	leaseDuration = flag.Duration("k8s-lease-duration", 15 * time.Second, "Duration of the Kubernetes Lease, a standby takes over when the leader did not renew it for this duration")
+	consulAddress = flag.String("consul-address", "http://127.0.0.1:8500", "Consul HTTP API address")
+	consulKvPrefix = flag.String("consul-kv-prefix", "", "Consul KV prefix whose keys ({prefix}/{currency}/{account}) are resources to retrieve, disabled if empty")
+	consulToken = flag.String("consul-token", "", "Consul ACL token")
+	etcdEndpoint = flag.String("etcd-endpoint", "http://127.0.0.1:2379", "etcd endpoint (v3 JSON gateway)")
+	etcdPrefix = flag.String("etcd-prefix", "", "etcd key prefix whose keys ({prefix}/{currency}/{account}) are resources to retrieve, disabled if empty")
+	etcdUsername = flag.String("etcd-username", "", "etcd username, authentication is disabled if empty")
+	etcdPassword = flag.String("etcd-password", "", "etcd password")
+	logRedact = flag.Bool("log-redact", false, "Mask wallet addresses, API tokens, passwords and authentication headers in the log output")
+	configFile = flag.String("config-file", "", "Path to the JSON configuration file (resources and API credentials)")
+	credentialsReloadInterval = flag.Duration("credentials-reload-interval", 30 * time.Second, "Interval between two checks of the configuration file, whose credentials are reloaded when it changes, 0 to disable")
+	auditLog = flag.String("audit-log", "", "File the audit entries of the administrative and sensitive requests are appended to (- for standard output), disabled if empty")
+	adminToken = flag.String("admin-token", "", "Bearer token of the admin API (credentials replacement, pause rules), the admin API is disabled if empty")
+	backfillOutput = flag.String("backfill-output", "-", "File the backfill command writes OpenMetrics data to (- for standard output)")
+	backfillDays = flag.Int("backfill-days", 30, "Number of days of history the backfill command retrieves")
+	benchResources = flag.Int("bench-resources", 100, "Number of synthetic resources of the bench command")
+	benchWorkers = flag.Int("bench-workers", 10, "Number of workers of each synthetic resource of the bench command")
+	benchScrapes = flag.Int("bench-scrapes", 5, "Number of scrapes measured by the bench command")
+	rulesOfflineMinutes = flag.Float64("rules-offline-minutes", 15, "Minutes without share before a worker is offline, in the rules generated by the rules command")
+	rulesStaleRatio = flag.Float64("rules-stale-ratio", 0.05, "Stale rejected ratio of the last hour over which an alert fires, in the rules generated by the rules command")
+	rulesHashrateDeviation = flag.Float64("rules-hashrate-deviation", 0.3, "Ratio of the hashrate below its moving average over which an alert fires, in the rules generated by the rules command")
+	rulesRevenueDrop = flag.Float64("rules-revenue-drop", 30, "Percent the revenue of the last 24 hours is under its trailing average before an alert fires, in the rules generated by the rules command")
+	rulesPayoutDays = flag.Int("rules-payout-days", 7, "Days without payout before an alert fires, in the rules generated by the rules command")
+	userAgent = flag.String("user-agent", "", "User-Agent of the F2Pool API requests, f2pool-exporter/{version} if empty")
+	apiHeaders = flag.String("api-headers", "", "Headers (name=value) added to F2Pool API requests, separated by commas")
+	apiMaxIdleConns = flag.Int("api-max-idle-conns", 100, "Maximum idle (keep-alive) connections to the F2Pool API kept for the next requests, 0 for no limit")
+	apiMaxConnsPerHost = flag.Int("api-max-conns-per-host", 0, "Maximum connections to the F2Pool API, requests wait for a connection over it, 0 for no limit")
+	apiIdleConnTimeout = flag.Duration("api-idle-conn-timeout", 90 * time.Second, "Duration idle connections to the F2Pool API are kept, should be over the scrape interval for connections to be reused across scrapes, 0 for no limit")
+	apiHttp2 = flag.Bool("api-http2", true, "Use HTTP/2 to the F2Pool API when supported")
+	apiGzip = flag.Bool("api-gzip", true, "Request gzip-compressed F2Pool API answers")
+	dnsCacheTTL = flag.Duration("dns-cache-ttl", time.Minute, "Duration the F2Pool API addresses are cached for, the last ones being used when a lookup fails, disabled if 0")
+	resolve = flag.String("resolve", "", "Static addresses of F2Pool API hosts (host=IP, e.g. api.f2pool.com=1.2.3.4), separated by commas")
+	apiUrls = flag.String("api-urls", "", "Fallback F2Pool API base URLs (e.g. a regional endpoint), separated by commas, the requests being sent to the first reachable one, the default API first")
+	apiHealthCheckInterval = flag.Duration("api-health-check-interval", 30*time.Second, "Interval of the health checks of the F2Pool API endpoints, with --api-urls")
+	workerShareAgeBuckets = flag.String("worker-share-age-buckets", "1m,5m,10m,30m,1h,6h,24h", "Upper bounds of the buckets of the f2pool_worker_last_share_age_seconds histogram, durations separated by commas")
+	workerListTTL = flag.Duration("worker-list-ttl", 0, "Duration the worker list of a resource is reused for before being retrieved again, the account values being retrieved on every collection, disabled if 0")
+	apiCacheTTL = flag.Duration("api-cache-ttl", time.Minute, "Duration successful F2Pool API answers are reused for, so that scrapes within it do not call the API again, disabled if 0")
+	hashAccounts = flag.Bool("hash-accounts", false, "Export a short SHA-256 hash of the accounts in the account label instead of the accounts themselves")
+	hashAccountsLookupToken = flag.String("hash-accounts-lookup-token", "", "Bearer token of the endpoint returning the account of a hash, the endpoint is disabled if empty")
+	hashWalletAddress = flag.Bool("hash-wallet-address", false, "Export a SHA-256 hash of the payout wallet address instead of the address itself")
+	fiatArg = flag.String("fiat", "", "Fiat currencies (e.g. usd,eur) to convert balances and revenue to, separated by commas, conversion is disabled if empty")
+	priceProviderArg = flag.String("price-provider", "coingecko", "Default exchange rates provider used for fiat conversion (coingecko, kraken or binance)")
+	priceCacheTTL = flag.Duration("price-cache-ttl", 5 * time.Minute, "Duration exchange rates are cached, the last known rate is used when the provider fails")
+	networkStats = flag.Bool("network-stats", false, "Retrieve network difficulty and block reward of the configured currencies")
+	apiQuotaWarningRatio = flag.Float64("api-quota-warning-ratio", 0.8, "Usage of an API quota (api_quotas of the configuration file) a warning is logged at")
+	poolBlocksCacheTTL = flag.Duration("pool-blocks-cache-ttl", 10 * time.Minute, "Duration the blocks found by the pool, for the pool luck, are cached")
+	networkStatsCacheTTL = flag.Duration("network-stats-cache-ttl", 10 * time.Minute, "Duration the network statistics of --network-stats are cached, the last ones being used when the retrieval fails")
+	otlpEndpoint = flag.String("otlp-endpoint", "", "OTLP/HTTP metrics endpoint (e.g. http://collector:4318/v1/metrics) metrics are pushed to, disabled if empty")
+	otlpInterval = flag.Duration("otlp-interval", time.Minute, "Interval between two OTLP pushes")
+	otlpTracesEndpoint = flag.String("otlp-traces-endpoint", "", "OTLP/HTTP traces endpoint (e.g. http://collector:4318/v1/traces) the traces of the collections are exported to, disabled if empty")
+	otlpHeaders = flag.String("otlp-headers", "", "Headers (name=value) added to OTLP requests, separated by commas")
+	remoteWriteUrl = flag.String("remote-write-url", "", "Prometheus remote_write endpoint metrics are pushed to, disabled if empty")
+	remoteWriteInterval = flag.Duration("remote-write-interval", time.Minute, "Interval between two remote_write pushes")
+	remoteWriteUsername = flag.String("remote-write-username", "", "Basic authentication username of the remote_write endpoint")
+	remoteWritePassword = flag.String("remote-write-password", "", "Basic authentication password of the remote_write endpoint")
+	remoteWriteBearerToken = flag.String("remote-write-bearer-token", "", "Bearer token of the remote_write endpoint (instead of basic authentication)")
+	pushgatewayUrl = flag.String("pushgateway-url", "", "Pushgateway metrics are pushed to, disabled if empty")
+	pushgatewayJob = flag.String("pushgateway-job", "f2pool_exporter", "Job name of the metrics pushed to the Pushgateway")
+	pushgatewayGrouping = flag.String("pushgateway-grouping", "", "Grouping labels (name=value) of the metrics pushed to the Pushgateway, separated by commas")
+	pushgatewayInterval = flag.Duration("pushgateway-interval", time.Minute, "Interval between two Pushgateway pushes")
+	graphiteAddress = flag.String("graphite-address", "", "Graphite/Carbon address (host:port) metrics are pushed to, disabled if empty")
+	graphiteProtocol = flag.String("graphite-protocol", "plaintext", "Graphite protocol (plaintext or pickle)")
+	graphitePrefix = flag.String("graphite-prefix", "", "Prefix of the Graphite metric paths")
+	graphiteInterval = flag.Duration("graphite-interval", time.Minute, "Interval between two Graphite pushes")
+	statsdAddress = flag.String("statsd-address", "", "StatsD address (host:port) metrics are sent to over UDP, disabled if empty")
+	statsdPrefix = flag.String("statsd-prefix", "", "Prefix of the StatsD metric names")
+	statsdTags = flag.Bool("statsd-tags", true, "Send labels as DogStatsD tags, instead of appending them to the metric names")
+	statsdInterval = flag.Duration("statsd-interval", time.Minute, "Interval between two StatsD pushes")
+	mqttBroker = flag.String("mqtt-broker", "", "MQTT broker URL (tcp://host:1883 or ssl://host:8883) collected data is published to, disabled if empty")
+	mqttClientId = flag.String("mqtt-client-id", "f2pool-exporter", "MQTT client identifier")
+	mqttUsername = flag.String("mqtt-username", "", "MQTT username")
+	mqttPassword = flag.String("mqtt-password", "", "MQTT password")
+	mqttCaFile = flag.String("mqtt-ca-file", "", "CA certificates file used to verify the MQTT broker (system ones if empty)")
+	mqttInsecure = flag.Bool("mqtt-insecure-skip-verify", false, "Do not verify the MQTT broker certificate")
+	mqttTopicPrefix = flag.String("mqtt-topic-prefix", "f2pool", "Prefix of the published MQTT topics")
+	mqttRetain = flag.Bool("mqtt-retain", true, "Publish retained MQTT messages")
+	mqttDiscovery = flag.Bool("mqtt-ha-discovery", false, "Publish Home Assistant MQTT discovery configs")
+	mqttDiscoveryPrefix = flag.String("mqtt-ha-discovery-prefix", "homeassistant", "Home Assistant MQTT discovery prefix")
+	mqttInterval = flag.Duration("mqtt-interval", time.Minute, "Interval between two MQTT publications")
+	mock = flag.Bool("mock", false, "Retrieve fake data from a built-in mock F2Pool API instead of the real one, for development and demos")
+	recordDir = flag.String("record-dir", "", "Directory the F2Pool API answers are recorded to, as fixtures to be replayed, disabled if empty")
+	replayDir = flag.String("replay-dir", "", "Directory of recorded F2Pool API answers replayed instead of calling the API, disabled if empty")
+	debugPayloads = flag.Bool("debug-payloads", false, "Log the F2Pool API payloads which could not be parsed (sampled, size-limited and redacted)")
+	debugPayloadsSampling = flag.Float64("debug-payloads-sampling", 1, "Ratio (0 to 1) of the parsing anomalies whose payload is logged")
+	debugPayloadsMaxBytes = flag.Int("debug-payloads-max-bytes", 4096, "Maximum size of the logged payloads, longer payloads are truncated")
+	injectLatency = flag.Duration("debug.inject-latency", 0, "Latency added to the F2Pool API calls (resilience testing)")
+	injectErrorRate = flag.Float64("debug.inject-error-rate", 0, "Ratio (0 to 1) of the F2Pool API calls failed on purpose (resilience testing)")
+	startupLint = flag.Bool("startup-lint", false, "Check the metrics of a collection at startup (naming conventions, duplicate series, labels) and log the problems")
+	historyDir = flag.String("history-dir", "", "Directory the account-level values of the collections are recorded in, served by /api/v1/history, disabled if empty")
+	dailyRollupsDays = flag.Int("daily-rollups-days", 31, "Number of past days whose rollups are exported, with --history-dir")
+	historyInterval = flag.Duration("history-interval", 5 * time.Minute, "Minimum interval between two recorded values of a resource")
+	revenueAverageRange = flag.String("revenue-average-range", "7d", "Range of the trailing average of the revenue f2pool_value_last_day_drop_percent is computed from, with --history-dir")
+	historyRetention = flag.String("history-retention", "14d", "Duration the recorded values are kept (e.g. 14d), forever if 0")
+	historyRollupsRetention = flag.String("history-rollups-retention", "730d", "Duration the daily rollups and exchange rates are kept (e.g. 730d), forever if 0")
+	historyCompactionInterval = flag.Duration("history-compaction-interval", time.Hour, "Interval between two removals of the expired entries of the history store")
+	countersFile = flag.String("counters-file", "", "File the counters state is saved to, so that the counters do not reset on restarts (default: counters.json of --history-dir, disabled without it)")
+	once = flag.Bool("once", false, "Collect once, push the metrics to the configured sinks (or print them if none) and exit")
+	pushOnly = flag.Bool("push-only", false, "Only push metrics to the configured sinks, without listening for scrapes")
 	version string
 	build   string
 
+	f2pool_exporter_leader = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "leader"), "Whether this instance holds the lease and retrieves the data (active/standby mode)", nil, nil)
+	f2pool_api_throttled_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "api", "throttled_total"), "Answers of the F2Pool API asking to slow down (429 and 503 statuses)", nil, nil)
+	f2pool_api_backoff_seconds = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "api", "backoff_seconds"), "Remaining time the F2Pool API requests are backed off for, as requested by the API", nil, nil)
+	f2pool_up = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "up"), "Whether the last retrieval of the resource succeeded", []string {"currency", "account"} , nil)
 	f2pool_balance = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "balance"), "Unpaid balance", []string {"currency", "account"} , nil)
 	f2pool_paid = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "paid"), "Paid balance", []string {"currency", "account"} , nil)
 	f2pool_value = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "value"), "Total revenue", []string {"currency", "account"} , nil)
 	f2pool_value_last_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "value_last_day"),
 		"Revenue of last 24 hours", []string {"currency", "account"} , nil)
 	f2pool_stale_hashes_rejected_last_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "stale_hashes_rejected_last_day"),
-		"Stale rejected hashes of last 24 hours", []string {"currency", "account", "worker"} , nil)
+		"Stale rejected hashes of last 24 hours", []string {"currency", "account", "worker", "algorithm"} , nil)
 	f2pool_stale_hashes_rejected_last_hour = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "stale_hashes_rejected_last_hour"),
-		"Stale rejected hashes of last hour", []string {"currency", "account", "worker"} , nil)
+		"Stale rejected hashes of last hour", []string {"currency", "account", "worker", "algorithm"} , nil)
 	f2pool_hashes_last_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hashes_last_day"), "Hashes of last 24 hours",
-		[]string {"currency", "account", "worker"}, nil)
+		[]string {"currency", "account", "worker", "algorithm"}, nil)
 	f2pool_hashes_last_hour = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hashes_last_hour"), "Hashes of last hour",
-		[]string {"currency", "account", "worker"}, nil)
+		[]string {"currency", "account", "worker", "algorithm"}, nil)
 	f2pool_hashrate = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hashrate"), "Current hashrate",
-		[]string {"currency", "account", "worker"}, nil)
+		[]string {"currency", "account", "worker", "algorithm"}, nil)
+	f2pool_worker_local_hashrate = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_local_hashrate"), "Hashrate reported by the mining software of the worker",
+		[]string {"currency", "account", "worker", "algorithm"}, nil)
 	f2pool_worker_shares_time = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_shares_time"),
 		"Recently submitted shares time (in seconds)", []string {"currency", "account", "worker"}, nil)
+	f2pool_worker_idle_seconds = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_idle_seconds"),
+		"Time since the last accepted share of the worker, at collection time", []string {"currency", "account", "worker"}, nil)
+	f2pool_paid_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "paid_total"), "Total paid, as a counter never decreasing", []string {"currency", "account"} , nil)
+	f2pool_value_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "value_total"), "Total revenue, as a counter never decreasing", []string {"currency", "account"} , nil)
+	f2pool_group_hashrate = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_hashrate"), "Current hashrate of the workers of a group",
+		[]string {"currency", "account", "group", "algorithm"}, nil)
+	f2pool_group_hashes_last_hour = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_hashes_last_hour"), "Hashes of last hour of the workers of a group",
+		[]string {"currency", "account", "group", "algorithm"}, nil)
+	f2pool_group_hashes_last_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_hashes_last_day"), "Hashes of last 24 hours of the workers of a group",
+		[]string {"currency", "account", "group", "algorithm"}, nil)
+	f2pool_group_stale_hashes_rejected_last_hour = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_stale_hashes_rejected_last_hour"),
+		"Stale rejected hashes of last hour of the workers of a group", []string {"currency", "account", "group", "algorithm"}, nil)
+	f2pool_group_stale_hashes_rejected_last_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_stale_hashes_rejected_last_day"),
+		"Stale rejected hashes of last 24 hours of the workers of a group", []string {"currency", "account", "group", "algorithm"}, nil)
+	f2pool_group_workers = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_workers"), "Workers of a group",
+		[]string {"currency", "account", "group"}, nil)
+	f2pool_group_hashing_workers = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "group_hashing_workers"), "Workers of a group having a hashrate",
+		[]string {"currency", "account", "group"}, nil)
+	f2pool_daily_revenue = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "daily_revenue"), "Revenue of a past day (UTC)",
+		[]string {"currency", "account", "date"}, nil)
+	f2pool_daily_paid = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "daily_paid"), "Payouts of a past day (UTC)",
+		[]string {"currency", "account", "date"}, nil)
+	f2pool_daily_hashrate = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "daily_hashrate"), "Average hashrate of a past day (UTC)",
+		[]string {"currency", "account", "algorithm", "date"}, nil)
+	f2pool_settlement_mode_info = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "settlement_mode_info"),
+		"Current payment method of the account (v2 API)", []string {"currency", "account", "mode"}, nil)
+	f2pool_settlement_mode_last_change = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "settlement_mode_last_change_timestamp_seconds"),
+		"Time the current payment method was first observed", []string {"currency", "account"}, nil)
+	f2pool_settlement_mode_changes = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "settlement_mode_changes_total"),
+		"Payment method changes observed since the exporter started", []string {"currency", "account"}, nil)
+	f2pool_wallet_address_info = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "wallet_address_info"),
+		"Payout wallet address configured on the pool (v2 API)", []string {"currency", "account", "address"}, nil)
+	f2pool_exchange_rate = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "exchange_rate"),
+		"Value of one currency unit in fiat", []string {"currency", "fiat"}, nil)
+	f2pool_exchange_rate_age = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "exchange_rate_age_seconds"),
+		"Time since the exchange rate was retrieved from the provider", []string {"currency", "fiat"}, nil)
+	f2pool_balance_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "balance_fiat"),
+		"Unpaid balance in fiat", []string {"currency", "account", "fiat"}, nil)
+	f2pool_value_last_day_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "value_last_day_fiat"),
+		"Revenue of last 24 hours in fiat", []string {"currency", "account", "fiat"}, nil)
+	f2pool_power_cost_last_day_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "power_cost_last_day_fiat"),
+		"Electricity cost of 24 hours at the current power draw in fiat", []string {"currency", "account", "fiat"}, nil)
+	f2pool_profit_last_day_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "profit_last_day_fiat"),
+		"Revenue of last 24 hours minus electricity cost in fiat", []string {"currency", "account", "fiat"}, nil)
+	f2pool_network_difficulty = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "network_difficulty"),
+		"Current network difficulty", []string {"currency"}, nil)
+	f2pool_network_block_height = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "network_block_height"),
+		"Current network block height", []string {"currency"}, nil)
+	f2pool_network_block_reward = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "network_block_reward"),
+		"Current block subsidy (without transaction fees)", []string {"currency"}, nil)
+	f2pool_breakeven_price_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "breakeven_price_fiat"),
+		"Currency price under which the expected revenue at the current hashrate does not cover the electricity cost",
+		[]string {"currency", "account", "fiat"}, nil)
+	f2pool_hashprice_fiat_per_ths_day = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hashprice_fiat_per_ths_day"),
+		"Expected revenue of 1 TH/s during 24 hours at the current difficulty, block subsidy and price", []string {"currency", "fiat"}, nil)
+	f2pool_hardware_cost_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hardware_cost_fiat"),
+		"Purchase cost of a hardware group", []string {"currency", "account", "group", "fiat"}, nil)
+	f2pool_hardware_revenue = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hardware_revenue"),
+		"Revenue of a hardware group since its purchase (v2 API)", []string {"currency", "account", "group"}, nil)
+	f2pool_hardware_revenue_fiat = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hardware_revenue_fiat"),
+		"Revenue of a hardware group since its purchase at the current price (v2 API)", []string {"currency", "account", "group", "fiat"}, nil)
+	f2pool_hardware_payback_ratio = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "hardware_payback_ratio"),
+		"Revenue of a hardware group since its purchase at the current price divided by its cost (v2 API)", []string {"currency", "account", "group"}, nil)
 )
 
 
 type F2PoolExporter struct {
 	client *http.Client
-	resources []string
+	// Client of the other APIs (prices, Blockchair), without the F2Pool transports
+	external *http.Client
+	resources *ResourceSet
+	config *Config
+	settlement *SettlementTracker
+	counters *CounterTracker
+	prices *PriceCache
+	fiats []string
+	revenues *RevenueTracker
+	snapshots *SnapshotStore
+	statuses *StatusTracker
+	history *HistoryStore
+	// Range of the trailing average of the revenue, with the history store
+	revenueAverageRange time.Duration
+	// Hashrate baselines, nil if disabled
+	baselines *BaselineTracker
+	// Online / offline transitions of the workers, nil if disabled
+	flaps *FlapTracker
+	// Blocks found by the pool, for the pool luck
+	poolBlocks *PoolBlocksCache
+	networks *NetworkStatsCache
+	// Tracer of the collections, nil if disabled
+	tracer *Tracer
+	shareTimes *ShareTimeParser
+	// DNS cache of the API addresses, nil if disabled
+	dns *DnsCache
+	// Worker lists reused for --worker-list-ttl, nil if disabled
+	workerLists *WorkerListCache
+	shareAgeBuckets []float64
+	// Token of the admin API resolved at startup, the admin API is disabled if empty
+	adminToken string
+	// Token of the account lookup endpoint resolved at startup, the endpoint is disabled if empty
+	lookupToken string
+	// Leader election, and metrics of the last collection served while standing by
+	leader *LeaderElector
+	cacheMutex sync.Mutex
+	cached []prometheus.Metric
 }
 
-func NewF2PoolExporter(resources []string) (*F2PoolExporter, error) {
+func NewF2PoolExporter(resources *ResourceSet, config *Config) (*F2PoolExporter, error) {
+	// Connections are kept alive and shared by the requests of every resource and scrape, saving
+	// a TLS handshake per request
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify : true},
+		MaxIdleConns: *apiMaxIdleConns,
+		MaxIdleConnsPerHost: *apiMaxIdleConns,
+		MaxConnsPerHost: *apiMaxConnsPerHost,
+		IdleConnTimeout: *apiIdleConnTimeout,
+		// Not attempted by default with a custom TLS configuration
+		ForceAttemptHTTP2: *apiHttp2,
+	}
+	if *apiMaxIdleConns == 0 {
+		// 0 is the default limit (2) for a host
+		tr.MaxIdleConnsPerHost = math.MaxInt32
+	}
+	var dns *DnsCache
+	if *dnsCacheTTL > 0 || len(*resolve) != 0 {
+		overrides, err := ParseResolve(*resolve)
+		if err != nil {
+			return nil, err
+		}
+		dns = NewDnsCache(*dnsCacheTTL, overrides)
+		tr.DialContext = dns.DialContext
+	}
+	if !*apiHttp2 {
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	// Requests are traced and their traffic counted under the decompression and the failover, as
+	// sent to the network
+	upstream := NewTracingTransport(NewTrafficTransport(tr))
+	h := &http.Client{ Timeout: 10 * time.Second, Transport: upstream }
+	if len(*apiUrls) != 0 {
+		apiEndpoints = NewApiEndpoints(append([]string{f2poolApiUrl}, strings.Split(*apiUrls, ",")...), tr)
+		h.Transport = NewFailoverTransport(upstream, apiEndpoints)
+	}
+	if *apiGzip {
+		h.Transport = NewGzipTransport(h.Transport)
+	} else {
+		tr.DisableCompression = true
 	}
-	h := &http.Client{ Timeout: 10 * time.Second, Transport: tr }
 
-	return &F2PoolExporter{ client: h, resources: resources }, nil
+	if err := validateWorkerSanitize(*workerSanitize); err != nil {
+		return nil, err
+	}
+	if err := validateBackends(config); err != nil {
+		return nil, err
+	}
+	if err := config.SetPaused(config.Paused); err != nil {
+		return nil, err
+	}
+	shareTimes, err := NewShareTimeParser(*workerShareTimeLayouts, *workerShareTimezone)
+	if err != nil {
+		return nil, err
+	}
+	shareAgeBuckets, err := ParseShareAgeBuckets(*workerShareAgeBuckets)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := ResolveToken("admin token", *adminToken)
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := ResolveToken("hash accounts lookup token", *hashAccountsLookupToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.ApiQuotas) != 0 {
+		quotas, err := NewQuotaTracker(config.ApiQuotas)
+		if err != nil {
+			return nil, err
+		}
+		apiQuotas = quotas
+	}
+
+	// The requests of the other APIs skip the F2Pool transports (failover, DNS overrides, tracing,
+	// traffic and quota accounting)
+	settings := &F2PoolExporter{ client: h, external: &http.Client{ Timeout: 10 * time.Second }, config: config, poolBlocks: NewPoolBlocksCache(*poolBlocksCacheTTL), networks: NewNetworkStatsCache(*networkStatsCacheTTL), shareTimes: shareTimes, dns: dns, shareAgeBuckets: shareAgeBuckets, adminToken: admin, lookupToken: lookup }
+	if len(*otlpTracesEndpoint) != 0 {
+		settings.tracer = NewTracer(&http.Client{ Timeout: 30 * time.Second }, *otlpTracesEndpoint, ParseHeaders(*otlpHeaders))
+	}
+
+	if len(*fiatArg) != 0 {
+		prices, err := NewPriceRouter(*priceProviderArg, config.Prices, settings.external)
+		if err != nil {
+			return nil, err
+		}
+		settings.prices = NewPriceCache(prices, *priceCacheTTL)
+		settings.fiats = strings.Split(*fiatArg, ",")
+	}
+
+	return newF2PoolExporter(settings, resources), nil
+}
+
+// newF2PoolExporter returns an exporter of the resources with new trackers, the client, settings and
+// caches being the ones of settings: every exporter (the self-test one included) is built here, so
+// that no tracker is left nil
+func newF2PoolExporter(settings *F2PoolExporter, resources *ResourceSet) *F2PoolExporter {
+	exporter := &F2PoolExporter{ client: settings.client, external: settings.external, resources: resources, config: settings.config, settlement: NewSettlementTracker(), counters: NewCounterTracker(), revenues: NewRevenueTracker(), snapshots: NewSnapshotStore(), statuses: NewStatusTracker(), prices: settings.prices, fiats: settings.fiats, poolBlocks: settings.poolBlocks, networks: settings.networks, tracer: settings.tracer, shareTimes: settings.shareTimes, dns: settings.dns, shareAgeBuckets: settings.shareAgeBuckets, adminToken: settings.adminToken, lookupToken: settings.lookupToken }
+
+	if *hashrateBaselineWindow > 0 {
+		exporter.baselines = NewBaselineTracker(*hashrateBaselineWindow)
+	}
+	if *workerFlapWindow > 0 {
+		exporter.flaps = NewFlapTracker(*workerFlapWindow)
+	}
+	if *workerListTTL > 0 {
+		exporter.workerLists = NewWorkerListCache(*workerListTTL)
+	}
+	return exporter
 }
 
 func (e *F2PoolExporter) Describe(ch chan<- *prometheus.Desc) {
+	describeRuntime(ch)
+	ch <- f2pool_exporter_leader
+	ch <- f2pool_api_throttled_total
+	ch <- f2pool_api_backoff_seconds
+	ch <- f2pool_api_quota_used_ratio
+	ch <- f2pool_api_bytes_total
+	ch <- f2pool_api_unknown_fields_total
+	ch <- f2pool_up
+	ch <- f2pool_paused
 	ch <- f2pool_balance
 	ch <- f2pool_paid
 	ch <- f2pool_value
@@ -66,106 +417,967 @@ func (e *F2PoolExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- f2pool_hashes_last_day
 	ch <- f2pool_hashes_last_hour
 	ch <- f2pool_hashrate
+	ch <- f2pool_hashrate_deviation_ratio
 	ch <- f2pool_worker_shares_time
+	ch <- f2pool_worker_local_hashrate
+	ch <- f2pool_worker_last_share_age_seconds
+	ch <- f2pool_workers
+	ch <- f2pool_worker_idle_seconds
+	ch <- f2pool_worker_flaps_total
+	ch <- f2pool_worker_flaps_recent
+	ch <- f2pool_worker_reject_rate_high
+	ch <- f2pool_paid_total
+	ch <- f2pool_value_total
+	ch <- f2pool_group_hashrate
+	ch <- f2pool_group_hashes_last_hour
+	ch <- f2pool_group_hashes_last_day
+	ch <- f2pool_group_stale_hashes_rejected_last_hour
+	ch <- f2pool_group_stale_hashes_rejected_last_day
+	ch <- f2pool_group_workers
+	ch <- f2pool_group_hashing_workers
+	ch <- f2pool_value_last_day_drop_percent
+	ch <- f2pool_daily_revenue
+	ch <- f2pool_daily_paid
+	ch <- f2pool_daily_hashrate
+	ch <- f2pool_settlement_mode_info
+	ch <- f2pool_settlement_mode_last_change
+	ch <- f2pool_settlement_mode_changes
+	ch <- f2pool_wallet_address_info
+	ch <- f2pool_payout_threshold
+	ch <- f2pool_estimated_seconds_to_payout
+	ch <- f2pool_exchange_rate
+	ch <- f2pool_exchange_rate_age
+	ch <- f2pool_balance_fiat
+	ch <- f2pool_value_last_day_fiat
+	ch <- f2pool_power_cost_last_day_fiat
+	ch <- f2pool_profit_last_day_fiat
+	ch <- f2pool_network_difficulty
+	ch <- f2pool_network_block_height
+	ch <- f2pool_network_block_reward
+	ch <- f2pool_breakeven_price_fiat
+	ch <- f2pool_hashprice_fiat_per_ths_day
+	ch <- f2pool_pool_blocks_found
+	ch <- f2pool_pool_luck_ratio
+	ch <- f2pool_hardware_cost_fiat
+	ch <- f2pool_hardware_revenue
+	ch <- f2pool_hardware_revenue_fiat
+	ch <- f2pool_hardware_payback_ratio
+	for _, backend := range poolBackends {
+		backend.Describe(ch)
+	}
 }
 
 func (e *F2PoolExporter) Collect(ch chan<- prometheus.Metric) {
-	for _, resource := range e.resources {
+	atomic.AddInt64(&collectionsInFlight, 1)
+	defer atomic.AddInt64(&collectionsInFlight, -1)
+	e.collectRuntime(ch)
+
+	if e.leader == nil {
+		e.collect(ch)
+		return
+	}
+
+	// Standbys serve the metrics of their last collection as leader
+	e.cacheMutex.Lock()
+	defer e.cacheMutex.Unlock()
+	if e.leader.IsLeader() {
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_leader, prometheus.GaugeValue, 1)
+		metrics := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		cached := []prometheus.Metric{}
+		go func() {
+			for metric := range metrics {
+				cached = append(cached, metric)
+				ch <- metric
+			}
+			close(done)
+		}()
+		e.collect(metrics)
+		close(metrics)
+		<-done
+		e.cached = cached
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_leader, prometheus.GaugeValue, 0)
+	for _, metric := range e.cached {
+		ch <- metric
+	}
+}
+
+func (e *F2PoolExporter) collect(ch chan<- prometheus.Metric) {
+	// Ended last, once the metrics of the collection are sent
+	collection := e.tracer.StartTrace("collect")
+	defer collection.End()
+
+	rates := e.collectExchangeRates(ch)
+	networks := e.collectNetworkStats(ch)
+
+	for currency, network := range networks {
+		if network == nil {
+			continue
+		}
+		if reward := network.ExpectedDailyReward(1e12); reward > 0 {
+			for fiat, rate := range rates[currency] {
+				ch <- prometheus.MustNewConstMetric(f2pool_hashprice_fiat_per_ths_day, prometheus.GaugeValue, reward * rate, currency, fiat)
+			}
+		}
+	}
+	e.collectPoolLuck(ch, networks)
+
+	defer func() {
+		throttled, backoff := apiThrottle.State()
+		ch <- prometheus.MustNewConstMetric(f2pool_api_throttled_total, prometheus.CounterValue, throttled)
+		ch <- prometheus.MustNewConstMetric(f2pool_api_backoff_seconds, prometheus.GaugeValue, backoff.Seconds())
+		apiDrift.Collect(ch)
+		apiTraffic.Collect(ch)
+		// Once the lookups of the collection are counted
+		cacheStats.Collect(ch)
+		if apiQuotas != nil {
+			apiQuotas.Collect(ch, time.Now())
+		}
+		if err := e.counters.Save(); err != nil {
+			log.Println("Error saving counters state:", err)
+		}
+		if e.baselines != nil {
+			e.baselines.Expire(time.Now())
+		}
+		if e.flaps != nil {
+			e.flaps.Expire(time.Now())
+		}
+	}()
+
+	resources := e.resources.All()
+	e.snapshots.Retain(resources)
+	if e.workerLists != nil {
+		e.workerLists.Retain(resources)
+	}
+	// Resources whose balance and revenue are exported, merged mined currencies included
+	exported := make(map[string]bool, len(resources))
+	for _, resource := range resources {
+		exported[resource] = true
+	}
+	// Span of the resource being collected, ended when the next one starts
+	var span *Span
+	defer func() { span.End() }()
+	for _, resource := range resources {
 		tmp := strings.Split(resource, "/")
 		currency := tmp[0]
-		account := tmp[1]
+		user := tmp[1]
+		// Label value of the account, the mining user (or address) is used for the API and the configuration matching
+		account := AccountLabel(user)
+
+		span.End()
+		span = collection.Child("collect " + ResourceLabel(resource), spanKindInternal)
+		span.RedactAccount(user)
+		span.SetAttribute("f2pool.currency", currency)
+		span.SetAttribute("f2pool.account", account)
+		span.SetAttribute("f2pool.backend", e.config.BackendNameFor(currency, user))
 
+		if e.config.PausedFor(currency, user, time.Now()) != nil {
+			e.statuses.ObservePaused(resource, e.config.BackendNameFor(currency, user))
+			ch <- prometheus.MustNewConstMetric(f2pool_paused, prometheus.GaugeValue, 1, currency, account)
+			e.snapshots.Delete(resource)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(f2pool_paused, prometheus.GaugeValue, 0, currency, account)
 
-		var infos map[string]interface{}
-		infosBody := HttpGetCall(e.client, "https://api.f2pool.com/" + resource)
-		err := json.Unmarshal([]byte(infosBody), &infos)
+		token := e.config.TokenFor(currency, user)
+		algorithm := e.config.AlgorithmFor(currency)
+
+		backend := e.config.BackendFor(currency, user)
+		client := ResourceClient(e.client, resource, span)
+		accountOnly := e.config.AccountOnlyFor(currency, user)
+		// Workers retrieved within --worker-list-ttl are reused
+		var workers []AccountWorker
+		reused := false
+		if e.workerLists != nil && !accountOnly {
+			workers, reused = e.workerLists.Get(resource, time.Now())
+		}
+		infos, err := backend.FetchAccount(client, currency, user, token, !accountOnly && !reused)
+		if err == nil && reused {
+			infos.Workers = workers
+		} else if err == nil && !accountOnly {
+			infos.Workers, err = backend.FetchWorkers(client, currency, user, token, infos)
+			if err == nil && e.workerLists != nil {
+				e.workerLists.Set(resource, infos.Workers, time.Now())
+			}
+		}
+		e.statuses.Observe(resource, e.config.BackendNameFor(currency, user), err, time.Now())
 		if err != nil {
-			log.Fatal(err)
+			log.Println("Error retrieving", resource, ":", err)
+			span.SetError(err)
+			ch <- prometheus.MustNewConstMetric(f2pool_up, prometheus.GaugeValue, 0, currency, account)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(f2pool_up, prometheus.GaugeValue, 1, currency, account)
+		for _, metric := range infos.Metrics {
+			ch <- metric
+		}
+
+		// Last update time of the data: the most recent point of the hashrate history
+		var updatedAt *time.Time
+		if *apiTimestamps {
+			updatedAt = infos.LastUpdate
+		}
+
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_balance, prometheus.GaugeValue, infos.Balance, currency, account))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_paid, prometheus.GaugeValue, infos.Paid, currency, account))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_value, prometheus.GaugeValue, infos.Value, currency, account))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_value_last_day, prometheus.GaugeValue, infos.ValueLastDay, currency, account))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_day, prometheus.GaugeValue, infos.StaleHashesRejectedLastDay, currency, account, *accountWorker, algorithm.Name))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_hour, prometheus.GaugeValue, infos.StaleHashesRejectedLastHour, currency, account, *accountWorker, algorithm.Name))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashes_last_day, prometheus.GaugeValue, infos.HashesLastDay, currency, account, *accountWorker, algorithm.Name))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashes_last_hour, prometheus.GaugeValue, infos.HashesLastHour, currency, account, *accountWorker, algorithm.Name))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashrate, prometheus.GaugeValue, infos.Hashrate, currency, account, *accountWorker, algorithm.Name))
+		if e.baselines != nil {
+			if deviation, ok := e.baselines.Observe(resource, infos.Hashrate, time.Now()); ok {
+				ch <- prometheus.MustNewConstMetric(f2pool_hashrate_deviation_ratio, prometheus.GaugeValue, deviation, currency, account, *accountWorker)
+			}
+		}
+
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_paid_total, prometheus.CounterValue, e.counters.Observe(resource + "/paid", infos.Paid), currency, account))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_value_total, prometheus.CounterValue, e.counters.Observe(resource + "/value", infos.Value), currency, account))
+
+		snapshot := &AccountSnapshot{
+			Currency: currency,
+			Account: account,
+			Balance: infos.Balance,
+			Paid: infos.Paid,
+			Value: infos.Value,
+			ValueLastDay: infos.ValueLastDay,
+			Algorithm: algorithm.Name,
+			HashrateUnit: algorithm.Unit,
+			Hashrate: infos.Hashrate,
+			HashesLastHour: infos.HashesLastHour,
+			HashesLastDay: infos.HashesLastDay,
+			StaleHashesRejectedLastHour: infos.StaleHashesRejectedLastHour,
+			StaleHashesRejectedLastDay: infos.StaleHashesRejectedLastDay,
+			UpdatedAt: time.Now(),
+		}
+
+		for fiat, rate := range rates[currency] {
+			ch <- prometheus.MustNewConstMetric(f2pool_balance_fiat, prometheus.GaugeValue, infos.Balance * rate, currency, account, fiat)
+			ch <- prometheus.MustNewConstMetric(f2pool_value_last_day_fiat, prometheus.GaugeValue, infos.ValueLastDay * rate, currency, account, fiat)
+		}
+		e.collectMerged(ch, span, backend, currency, user, exported, rates)
+
+		groups := NewWorkerGroupTotals(e.config.WorkerGroups)
+		hashingWorkers := make([]string, 0, len(infos.Workers))
+		workerHashes := make(map[string]float64, len(infos.Workers))
+		snapshot.Workers = make([]WorkerSnapshot, 0, len(infos.Workers))
+		shareAges := NewShareAgeHistogram(e.shareAgeBuckets)
+		states := NewWorkerStateCounts()
+		labeled := make([]LabeledWorker, 0, len(infos.Workers))
+		for i := range infos.Workers {
+			worker := &infos.Workers[i]
+			if worker.Hashrate > 0 {
+				hashingWorkers = append(hashingWorkers, worker.Name)
+			}
+			workerHashes[worker.Name] = worker.HashesLastDay
+
+			// Workers are relabeled after the power and hardware matching, done on their pool names
+			if label, keep := e.config.RelabelWorker(currency, user, worker.Name); keep {
+				labeled = append(labeled, LabeledWorker{Worker: worker, Label: label})
+			}
+		}
+		// Workers given the same label are exported as one
+		lastShare := func(value string) (time.Time, bool) { return e.shareTimes.Parse(currency, value) }
+		for _, labeledWorker := range MergeWorkers(SanitizeWorkers(resource, labeled, *workerSanitize, *accountWorker), lastShare) {
+			worker, label := labeledWorker.Worker, labeledWorker.Label
+
+			workerSnapshot := WorkerSnapshot{
+				Name: label,
+				Hashrate: worker.Hashrate,
+				HashesLastHour: worker.HashesLastHour,
+				HashesLastDay: worker.HashesLastDay,
+				StaleHashesRejectedLastHour: worker.StaleHashesRejectedLastHour,
+				StaleHashesRejectedLastDay: worker.StaleHashesRejectedLastDay,
+			}
+			if t, ok := e.shareTimes.Parse(currency, worker.LastShare); ok {
+				workerSnapshot.LastShareAt = &t
+				shareAges.Observe(math.Max(time.Since(t).Seconds(), 0))
+			}
+			snapshot.Workers = append(snapshot.Workers, workerSnapshot)
+			states[WorkerState(&workerSnapshot, time.Now())]++
+
+			// Workers of a suppressing group are only exported through the group aggregates
+			if group := groups.Add(currency, user, &workerSnapshot); group != nil && group.Suppress {
+				continue
+			}
+			ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashrate, prometheus.GaugeValue, workerSnapshot.Hashrate, currency, account, label, algorithm.Name))
+			if worker.HasLocalHashrate {
+				ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_worker_local_hashrate, prometheus.GaugeValue, worker.LocalHashrate, currency, account, label, algorithm.Name))
+			}
+			if e.baselines != nil {
+				if deviation, ok := e.baselines.Observe(resource + "/" + label, worker.Hashrate, time.Now()); ok {
+					ch <- prometheus.MustNewConstMetric(f2pool_hashrate_deviation_ratio, prometheus.GaugeValue, deviation, currency, account, label)
+				}
+			}
+			rejectRateHigh := 0.0
+			if RejectRateHigh(&workerSnapshot) {
+				rejectRateHigh = 1
+			}
+			ch <- prometheus.MustNewConstMetric(f2pool_worker_reject_rate_high, prometheus.GaugeValue, rejectRateHigh, currency, account, label)
+			if e.flaps != nil {
+				total, recent := e.flaps.Observe(resource + "/" + label, worker.Hashrate > 0, time.Now())
+				ch <- prometheus.MustNewConstMetric(f2pool_worker_flaps_total, prometheus.CounterValue, total, currency, account, label)
+				ch <- prometheus.MustNewConstMetric(f2pool_worker_flaps_recent, prometheus.GaugeValue, float64(recent), currency, account, label)
+			}
+			ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashes_last_hour, prometheus.GaugeValue, workerSnapshot.HashesLastHour, currency, account, label, algorithm.Name))
+			ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_hashes_last_day, prometheus.GaugeValue, workerSnapshot.HashesLastDay, currency, account, label, algorithm.Name))
+			ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_hour, prometheus.GaugeValue, workerSnapshot.StaleHashesRejectedLastHour, currency, account, label, algorithm.Name))
+			ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_day, prometheus.GaugeValue, workerSnapshot.StaleHashesRejectedLastDay, currency, account, label, algorithm.Name))
+			if workerSnapshot.LastShareAt != nil {
+				ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_worker_shares_time, prometheus.GaugeValue, float64(workerSnapshot.LastShareAt.Unix()), currency, account, label))
+				// Relative to the collection time, never stamped with the API data time
+				idle := math.Max(time.Since(*workerSnapshot.LastShareAt).Seconds(), 0)
+				ch <- prometheus.MustNewConstMetric(f2pool_worker_idle_seconds, prometheus.GaugeValue, idle, currency, account, label)
+			}
+		}
+		if !accountOnly {
+			groups.Collect(ch, currency, account, algorithm.Name, updatedAt)
+			ch <- shareAges.Metric(currency, account)
+			states.Collect(ch, currency, account)
+		}
+		snapshot.WorkersCount = len(snapshot.Workers)
+		e.snapshots.Set(resource, snapshot)
+		if e.history != nil {
+			// The history is served by the JSON API, it is keyed by the label value of the account
+			label := ResourceLabel(resource)
+			if err := e.history.Record(label, snapshot); err != nil {
+				log.Println("Error recording history of", resource, ":", err)
+			}
+			if average, ok := e.history.AverageValueLastDay(label, time.Now().Add(-e.revenueAverageRange)); ok {
+				if drop, ok := revenueDropPercent(infos.ValueLastDay, average); ok {
+					ch <- prometheus.MustNewConstMetric(f2pool_value_last_day_drop_percent, prometheus.GaugeValue, drop, currency, account)
+				}
+			}
+			since := time.Now().UTC().AddDate(0, 0, -*dailyRollupsDays).Format("2006-01-02")
+			for _, rollup := range e.history.Rollups(label, since) {
+				ch <- prometheus.MustNewConstMetric(f2pool_daily_revenue, prometheus.GaugeValue, rollup.Revenue, currency, account, rollup.Date)
+				ch <- prometheus.MustNewConstMetric(f2pool_daily_paid, prometheus.GaugeValue, rollup.Paid, currency, account, rollup.Date)
+				ch <- prometheus.MustNewConstMetric(f2pool_daily_hashrate, prometheus.GaugeValue, rollup.Hashrate, currency, account, algorithm.Name, rollup.Date)
+			}
+		}
+
+		if e.config.Power != nil {
+			if watts, ok := e.config.Power.Watts(currency, user, hashingWorkers); ok {
+				fiat := e.config.Power.Fiat
+				cost := e.config.Power.DailyCost(watts)
+				ch <- prometheus.MustNewConstMetric(f2pool_power_cost_last_day_fiat, prometheus.GaugeValue, cost, currency, account, fiat)
+				if rate, ok := rates[currency][fiat]; ok {
+					ch <- prometheus.MustNewConstMetric(f2pool_profit_last_day_fiat, prometheus.GaugeValue, infos.ValueLastDay * rate - cost, currency, account, fiat)
+				}
+				if network := networks[currency]; network != nil {
+					if reward := network.ExpectedDailyReward(infos.Hashrate); reward > 0 {
+						ch <- prometheus.MustNewConstMetric(f2pool_breakeven_price_fiat, prometheus.GaugeValue, cost / reward, currency, account, fiat)
+					}
+				}
+			}
+		}
+
+		for _, group := range e.config.Hardware {
+			if group.Matches(currency, user) {
+				share := group.Share(workerHashes, infos.HashesLastDay)
+				e.collectHardware(ch, &group, token, share, rates[currency][group.Fiat])
+			}
+		}
+
+		threshold, known := e.config.PayoutThresholdFor(currency, user)
+		if len(token) != 0 {
+			if wallet := e.collectMiningUser(ch, client, resource, currency, user, token); wallet != nil && wallet.Threshold > 0 {
+				threshold, known = wallet.Threshold, true
+			}
+		}
+		if known {
+			ch <- prometheus.MustNewConstMetric(f2pool_payout_threshold, prometheus.GaugeValue, threshold, currency, account)
+			if seconds, ok := SecondsToPayout(infos.Balance, threshold, infos.ValueLastDay); ok {
+				ch <- prometheus.MustNewConstMetric(f2pool_estimated_seconds_to_payout, prometheus.GaugeValue, seconds, currency, account)
+			}
+		}
+	}
+}
+
+func (e *F2PoolExporter) collectHardware(ch chan<- prometheus.Metric, group *HardwareGroup, token string, share float64, rate float64) {
+	account := AccountLabel(group.Account)
+	ch <- prometheus.MustNewConstMetric(f2pool_hardware_cost_fiat, prometheus.GaugeValue, group.Cost, group.Currency, account, group.Name, group.Fiat)
+	if len(token) == 0 {
+		return
+	}
+
+	purchased, err := time.Parse("2006-01-02", group.Purchased)
+	if err != nil {
+		log.Println("Invalid purchase date of hardware group", group.Name, ":", err)
+		return
+	}
+	revenue, err := e.revenues.AccountRevenueSince(e.client, token, group.Currency, group.Account, purchased)
+	if err != nil {
+		log.Println("Error retrieving revenue of hardware group", group.Name, ":", err)
+		return
+	}
+	revenue *= share
+
+	ch <- prometheus.MustNewConstMetric(f2pool_hardware_revenue, prometheus.GaugeValue, revenue, group.Currency, account, group.Name)
+	if rate != 0 {
+		ch <- prometheus.MustNewConstMetric(f2pool_hardware_revenue_fiat, prometheus.GaugeValue, revenue * rate, group.Currency, account, group.Name, group.Fiat)
+		if group.Cost != 0 {
+			ch <- prometheus.MustNewConstMetric(f2pool_hardware_payback_ratio, prometheus.GaugeValue, revenue * rate / group.Cost, group.Currency, account, group.Name)
 		}
-		
-		ch <- prometheus.MustNewConstMetric(f2pool_balance, prometheus.GaugeValue, infos["balance"].(float64), currency, account)
-		ch <- prometheus.MustNewConstMetric(f2pool_paid, prometheus.GaugeValue, infos["paid"].(float64), currency, account)
-		ch <- prometheus.MustNewConstMetric(f2pool_value, prometheus.GaugeValue, infos["value"].(float64), currency, account)
-		ch <- prometheus.MustNewConstMetric(f2pool_value_last_day, prometheus.GaugeValue, infos["value_last_day"].(float64), currency, account)
-		ch <- prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_day, prometheus.GaugeValue, infos["stale_hashes_rejected_last_day"].(float64), currency, account, "all")
-		ch <- prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_hour, prometheus.GaugeValue, infos["stale_hashes_rejected_last_hour"].(float64), currency, account, "all")
-		ch <- prometheus.MustNewConstMetric(f2pool_hashes_last_day, prometheus.GaugeValue, infos["hashes_last_day"].(float64), currency, account, "all")
-		ch <- prometheus.MustNewConstMetric(f2pool_hashes_last_hour, prometheus.GaugeValue, infos["hashes_last_hour"].(float64), currency, account, "all")
-		ch <- prometheus.MustNewConstMetric(f2pool_hashrate, prometheus.GaugeValue, infos["hashrate"].(float64), currency, account, "all")
+	}
+}
 
-		for _, w := range infos["workers"].([]interface{}) {
-			worker := w.([]interface{})
-			label := worker[0].(string)
+// Retrieves the exchange rates of every configured currency to every fiat, by currency then fiat,
+// failed ones are left out
+func (e *F2PoolExporter) collectExchangeRates(ch chan<- prometheus.Metric) map[string]map[string]float64 {
+	rates := map[string]map[string]float64{}
+	if e.prices == nil {
+		return rates
+	}
 
-			ch <- prometheus.MustNewConstMetric(f2pool_hashrate, prometheus.GaugeValue, worker[1].(float64), currency, account, label)
-			ch <- prometheus.MustNewConstMetric(f2pool_hashes_last_hour, prometheus.GaugeValue, worker[2].(float64), currency, account, label)
-			ch <- prometheus.MustNewConstMetric(f2pool_hashes_last_day, prometheus.GaugeValue, worker[4].(float64), currency, account, label)
-			ch <- prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_hour, prometheus.GaugeValue, worker[3].(float64), currency, account, label)
-			ch <- prometheus.MustNewConstMetric(f2pool_stale_hashes_rejected_last_day, prometheus.GaugeValue, worker[5].(float64), currency, account, label)
-			t, e := time.Parse(time.RFC3339, worker[6].(string))
-			if e == nil {
-				ch <- prometheus.MustNewConstMetric(f2pool_worker_shares_time, prometheus.GaugeValue, float64(t.Unix()), currency, account, label)
+	currencies := []string{}
+	for _, resource := range e.resources.All() {
+		currency := strings.Split(resource, "/")[0]
+		currencies = append(currencies, currency)
+		for _, merged := range e.config.MergedCurrenciesFor(currency) {
+			currencies = append(currencies, e.config.CanonicalCurrency(merged))
+		}
+	}
+	for _, currency := range currencies {
+		if _, ok := rates[currency]; ok {
+			continue
+		}
+		rates[currency] = map[string]float64{}
+		for _, fiat := range e.fiats {
+			rate, age, err := e.prices.Price(currency, fiat)
+			if err != nil {
+				log.Println("Error retrieving", currency, "to", fiat, "exchange rate:", err)
+				continue
 			}
+			rates[currency][fiat] = rate
+			// Rates are recorded when retrieved from the provider, not when served from the cache
+			if e.history != nil && age == 0 {
+				if err := e.history.RecordPrice(currency, fiat, rate, time.Now()); err != nil {
+					log.Println("Error recording", currency, "to", fiat, "exchange rate:", err)
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(f2pool_exchange_rate, prometheus.GaugeValue, rate, currency, fiat)
+			ch <- prometheus.MustNewConstMetric(f2pool_exchange_rate_age, prometheus.GaugeValue, age.Seconds(), currency, fiat)
 		}
 	}
+	return rates
+}
+
+// Retrieves the network statistics of every configured currency, by currency, failed ones are left out
+func (e *F2PoolExporter) collectNetworkStats(ch chan<- prometheus.Metric) map[string]*NetworkStats {
+	networks := map[string]*NetworkStats{}
+	if !*networkStats {
+		return networks
+	}
+
+	for _, resource := range e.resources.All() {
+		currency := strings.Split(resource, "/")[0]
+		if _, ok := networks[currency]; ok {
+			continue
+		}
+		network, err := e.networks.Stats(e.external, currency, time.Now())
+		if err != nil {
+			log.Println("Error retrieving", currency, "network statistics:", err)
+			networks[currency] = nil
+			continue
+		}
+		networks[currency] = network
+		ch <- prometheus.MustNewConstMetric(f2pool_network_difficulty, prometheus.GaugeValue, network.Difficulty, currency)
+		ch <- prometheus.MustNewConstMetric(f2pool_network_block_height, prometheus.GaugeValue, float64(network.Height), currency)
+		if network.HasBlockReward {
+			ch <- prometheus.MustNewConstMetric(f2pool_network_block_reward, prometheus.GaugeValue, network.BlockReward, currency)
+		}
+	}
+	return networks
+}
+
+// Exports the wallet and settlement mode of a resource and returns its wallet, nil if unknown
+func (e *F2PoolExporter) collectMiningUser(ch chan<- prometheus.Metric, client *http.Client, resource string, currency string, username string, token string) *V2Wallet {
+	account := AccountLabel(username)
+	user, err := FetchMiningUser(client, token, username)
+	if err != nil {
+		log.Println("Error retrieving mining user of", resource, ":", err)
+		return nil
+	}
+	wallet := user.Wallet(currency)
+	if wallet == nil {
+		return nil
+	}
+
+	if len(wallet.Address) != 0 {
+		RedactSecret(wallet.Address)
+		address := wallet.Address
+		if *hashWalletAddress {
+			address = HashValue(address)
+		}
+		ch <- prometheus.MustNewConstMetric(f2pool_wallet_address_info, prometheus.GaugeValue, 1, currency, account, address)
+	}
+
+	if len(wallet.PaymentMethod) == 0 {
+		return wallet
+	}
+
+	state := e.settlement.Observe(resource, wallet.PaymentMethod, time.Now())
+	ch <- prometheus.MustNewConstMetric(f2pool_settlement_mode_info, prometheus.GaugeValue, 1, currency, account, state.Mode)
+	ch <- prometheus.MustNewConstMetric(f2pool_settlement_mode_last_change, prometheus.GaugeValue, float64(state.Since.Unix()), currency, account)
+	ch <- prometheus.MustNewConstMetric(f2pool_settlement_mode_changes, prometheus.CounterValue, state.Changes, currency, account)
+	return wallet
 }
 
 func main() {
-	flag.Parse()
+	// An optional command can be given before the flags, the exporter is started without it
+	command := ""
+	args := os.Args[1:]
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	// The health check only needs the listen address
+	if command == "healthcheck" {
+		os.Exit(runHealthcheck(*listenAddress, len(*webTlsCertFile) != 0))
+	}
+	if *logRedact {
+		EnableLogRedaction()
+	}
 
-	resources := strings.Split(*resourcesArg, ",")
+	config := &Config{}
+	if len(*configFile) != 0 {
+		c, err := LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal("Error loading configuration file: ", err)
+		}
+		config = c
+	}
+	if *logRedact {
+		for _, credential := range config.Credentials {
+			RedactSecret(Secret(credential.Token))
+		}
+		for _, secret := range []string{*remoteWritePassword, *remoteWriteBearerToken, *mqttPassword, *consulToken, *etcdPassword, *hashAccountsLookupToken, *adminToken} {
+			RedactSecret(Secret(secret))
+		}
+		for _, header := range ParseHeaders(*otlpHeaders) {
+			RedactSecret(header)
+		}
+	}
 
-	if len(*resourcesArg) == 0 {
+	resources := config.Resources
+	if len(*resourcesArg) != 0 {
+		resources = append(resources, strings.Split(*resourcesArg, ",")...)
+	}
+	// The bench command retrieves synthetic resources from the mock API
+	if command == "bench" {
+		*mock = true
+		resources = BenchResources(*benchResources)
+		mockWorkersPerResource = *benchWorkers
+	}
+	if *mock {
+		url, err := StartMockServer()
+		if err != nil {
+			log.Fatal("Error starting mock API: ", err)
+		}
+		f2poolApiUrl = url
+		if len(resources) == 0 && len(*resourcesUrl) == 0 && len(*discoverCurrencies) == 0 {
+			resources = mockResources
+		}
+		// Any token enables the v2 API calls
+		if len(config.Credentials) == 0 {
+			config.Credentials = []Credential{{Token: "mock"}}
+		}
+		fmt.Fprintln(stdout, "Retrieving fake data from the mock F2Pool API at", url)
+	}
+	if len(*recordDir) != 0 && len(*replayDir) != 0 {
+		log.Fatal("--record-dir and --replay-dir cannot be used together")
+	}
+	if len(*recordDir) != 0 || len(*replayDir) != 0 {
+		store, err := NewFixtureStore(*recordDir + *replayDir, len(*replayDir) != 0)
+		if err != nil {
+			log.Fatal("Error opening fixtures directory: ", err)
+		}
+		fixtures = store
+	}
+	// The bench command measures the API calls
+	if *apiCacheTTL > 0 && command != "bench" {
+		apiCache = NewApiCache(*apiCacheTTL)
+	}
+	resources = config.CanonicalResources(resources)
+
+	discoveryClient := &http.Client{ Timeout: 30 * time.Second }
+	discoveries := []*DiscoveryConfig{}
+	if len(*resourcesUrl) != 0 {
+		discoveries = append(discoveries, &DiscoveryConfig{"HTTP", NewHttpDiscoverer(discoveryClient, *resourcesUrl), *resourcesUrlInterval})
+	}
+	if len(*discoverCurrencies) != 0 {
+		discoverer := NewCurrencyDiscoverer(discoveryClient, config, strings.Split(*discoverCurrencies, ","))
+		discoveries = append(discoveries, &DiscoveryConfig{"currency discovery", discoverer, *discoverCurrenciesInterval})
+	}
+	if len(*consulKvPrefix) != 0 {
+		discoveries = append(discoveries, &DiscoveryConfig{"Consul", NewConsulDiscoverer(*consulAddress, *consulKvPrefix, *consulToken), 0})
+	}
+	if len(*etcdPrefix) != 0 {
+		discoveries = append(discoveries, &DiscoveryConfig{"etcd", NewEtcdDiscoverer(*etcdEndpoint, *etcdPrefix, *etcdUsername, *etcdPassword), 0})
+	}
+
+	resourceSet := NewResourceSet(config, resources)
+	if len(*shard) != 0 {
+		if err := resourceSet.SetShard(*shard); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, discovery := range discoveries {
+		if err := resourceSet.Refresh(discovery); err != nil {
+			log.Println("Error discovering resources from", discovery.Name, ":", err)
+		}
+	}
+
+	if len(resources) == 0 && len(discoveries) == 0 {
 		log.Fatal("Resources required")
 		os.Exit(1)
 	}
 
-	fmt.Println("Version:", version)
-	fmt.Println("Build Time:", build)
-	fmt.Println("Resources:", resources)
-	fmt.Println("Metrics Path:", *metricsPath)
-
-	exporter, err := NewF2PoolExporter(resources)
+	exporter, err := NewF2PoolExporter(resourceSet, config)
 	if err != nil {
-		log.Fatal("Error initializing exporter")
+		log.Fatal("Error initializing exporter: ", err)
 		os.Exit(1)
 	}
 
-	prometheus.MustRegister(exporter)
+	if len(*historyDir) != 0 {
+		if exporter.revenueAverageRange, err = ParseRange(*revenueAverageRange); err != nil {
+			log.Fatal("Invalid revenue average range: ", err)
+		}
+		history, err := OpenHistoryStore(*historyDir, *historyInterval, exporter.revenueAverageRange)
+		if err != nil {
+			log.Fatal("Error opening history store: ", err)
+		}
+		samplesRetention, err := ParseRange(*historyRetention)
+		if err != nil {
+			log.Fatal("Invalid history retention: ", err)
+		}
+		rollupsRetention, err := ParseRange(*historyRollupsRetention)
+		if err != nil {
+			log.Fatal("Invalid history rollups retention: ", err)
+		}
+		history.SetRetention(samplesRetention, rollupsRetention)
+		exporter.history = history
+		if !*once && command == "" {
+			go history.RunCompaction(*historyCompactionInterval)
+		}
+	}
+
+	if path := *countersFile; len(path) != 0 || len(*historyDir) != 0 {
+		if len(path) == 0 {
+			path = filepath.Join(*historyDir, "counters.json")
+		}
+		counters, err := LoadCounterTracker(path)
+		if err != nil {
+			log.Fatal("Error loading counters state: ", err)
+		}
+		exporter.counters = counters
+	}
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	if apiEndpoints != nil && command == "" && !*once {
+		go apiEndpoints.RunHealthChecks(*apiHealthCheckInterval)
+	}
+
+	if len(*leaseName) != 0 && command == "" && !*once {
+		leader, err := NewLeaderElector(*leaseNamespace, *leaseName, *leaseIdentity, *leaseDuration)
+		if err != nil {
+			log.Fatal("Error initializing leader election: ", err)
+		}
+		exporter.leader = leader
+		go leader.Run()
+	}
+
+	switch command {
+	case "", "check":
+	case "backfill":
+		if err := runBackfill(exporter, *backfillOutput, *backfillDays); err != nil {
+			log.Fatal("Error during backfill: ", err)
+		}
+		return
+	case "dashboard":
+		if err := runDashboard(resourceSet.All(), os.Stdout); err != nil {
+			log.Fatal("Error generating dashboard: ", err)
+		}
+		return
+	case "rules":
+		thresholds := RulesThresholds{OfflineMinutes: *rulesOfflineMinutes, StaleRatio: *rulesStaleRatio, HashrateDeviation: *rulesHashrateDeviation, RevenueDrop: *rulesRevenueDrop, PayoutDays: *rulesPayoutDays}
+		if err := runRules(thresholds, os.Stdout); err != nil {
+			log.Fatal("Error generating rules: ", err)
+		}
+		return
+	case "bench":
+		if err := runBench(exporter, *benchScrapes, os.Stdout); err != nil {
+			log.Fatal("Error during bench: ", err)
+		}
+		return
+	default:
+		log.Fatal("Unknown command: ", command)
+	}
+
+	if !*once && command != "check" {
+		fmt.Fprintln(stdout, "Version:", version)
+		fmt.Fprintln(stdout, "Build Time:", build)
+		fmt.Fprintln(stdout, "Resources:", resourceSet.All())
+		fmt.Fprintln(stdout, "Metrics Path:", *metricsPath)
+	}
+
+	// Constant labels are added to the series of the exporter, not to the ones of the Go runtime and process collectors
+	registerer := prometheus.DefaultRegisterer
+	if len(*constLabels) != 0 {
+		registerer = prometheus.WrapRegistererWith(ParseHeaders(*constLabels), registerer)
+	}
+	if err := registerer.Register(exporter); err != nil {
+		log.Fatal("Error registering exporter: ", err)
+	}
+
+	gatherer := prometheus.Gatherer(prometheus.DefaultGatherer)
+	if len(config.MetricNames) != 0 {
+		renaming, err := NewRenamingGatherer(gatherer, config.MetricNames)
+		if err != nil {
+			log.Fatal("Error configuring metric names: ", err)
+		}
+		gatherer = renaming
+	}
+
+	if command == "check" {
+		if count := RunLint(gatherer); count != 0 {
+			log.Fatal(count, " metrics lint problems")
+		}
+		fmt.Fprintln(stdout, "No metrics lint problem")
+		return
+	}
+	if *startupLint {
+		if count := RunLint(gatherer); count != 0 {
+			log.Println(count, "metrics lint problems")
+		}
+	}
+
+	sinkClient := &http.Client{ Timeout: 30 * time.Second }
+	sinks := []SinkConfig{}
+	if len(*otlpEndpoint) != 0 {
+		sinks = append(sinks, SinkConfig{"OTLP", NewOtlpSink(sinkClient, *otlpEndpoint, ParseHeaders(*otlpHeaders)), *otlpInterval})
+	}
+	if len(*remoteWriteUrl) != 0 {
+		sink := NewRemoteWriteSink(sinkClient, *remoteWriteUrl, *remoteWriteUsername, *remoteWritePassword, *remoteWriteBearerToken)
+		sinks = append(sinks, SinkConfig{"remote_write", sink, *remoteWriteInterval})
+	}
+	if len(*pushgatewayUrl) != 0 {
+		sink := NewPushgatewaySink(*pushgatewayUrl, *pushgatewayJob, ParseHeaders(*pushgatewayGrouping))
+		sinks = append(sinks, SinkConfig{"Pushgateway", sink, *pushgatewayInterval})
+	}
+
+	if len(*graphiteAddress) != 0 {
+		sink, err := NewGraphiteSink(*graphiteAddress, *graphiteProtocol, *graphitePrefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, SinkConfig{"Graphite", sink, *graphiteInterval})
+	}
+
+	if len(*statsdAddress) != 0 {
+		sinks = append(sinks, SinkConfig{"StatsD", NewStatsdSink(*statsdAddress, *statsdPrefix, *statsdTags), *statsdInterval})
+	}
+
+	if *once {
+		if err := RunOnce(sinks, gatherer); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, discovery := range discoveries {
+		if discovery.Interval != 0 {
+			fmt.Fprintln(stdout, "Discovering resources from", discovery.Name, "every", discovery.Interval)
+		} else {
+			fmt.Fprintln(stdout, "Watching resources from", discovery.Name)
+		}
+		go resourceSet.RunDiscovery(discovery)
+	}
+
+	for _, sink := range sinks {
+		fmt.Fprintln(stdout, "Pushing metrics to", sink.Name, "every", sink.Interval)
+		go RunSink(sink.Name, sink.Sink, gatherer, sink.Interval)
+	}
+
+	if len(*mqttBroker) != 0 {
+		options := &MqttOptions{
+			Broker: *mqttBroker,
+			ClientId: *mqttClientId,
+			Username: *mqttUsername,
+			Password: *mqttPassword,
+			CaFile: *mqttCaFile,
+			InsecureTls: *mqttInsecure,
+			Retain: *mqttRetain,
+			TopicPrefix: *mqttTopicPrefix,
+		}
+		if *mqttDiscovery {
+			options.DiscoveryPrefix = *mqttDiscoveryPrefix
+		}
+		fmt.Fprintln(stdout, "Publishing to MQTT broker", *mqttBroker, "every", *mqttInterval)
+		go NewMqttPublisher(exporter, options).Run(*mqttInterval)
+	}
+
+	if len(*configFile) != 0 && *credentialsReloadInterval != 0 {
+		go config.WatchCredentials(*configFile, *credentialsReloadInterval)
+	}
+
+	if config.Alerts != nil {
+		fmt.Fprintln(stdout, "Evaluating", len(config.Alerts.Rules), "alert rules")
+		go NewAlerter(exporter, config.Alerts, sinkClient).Run()
+	}
+
+	if *pushOnly {
+		select {}
+	}
+
+	if len(*auditLog) != 0 {
+		logger, err := OpenAuditLog(*auditLog)
+		if err != nil {
+			log.Fatal("Error opening audit log: ", err)
+		}
+		auditLogger = logger
+	}
+
+	// Counters restored from the state file were not created at the exporter start
+	persisted := []string {}
+	if exporter.counters.Persistent() {
+		for _, name := range trackedCounterFamilies {
+			persisted = append(persisted, name)
+			if renamed, ok := config.MetricNames[name]; ok {
+				persisted = append(persisted, renamed)
+			}
+		}
+	}
+	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, LimitRequests(NewOpenMetricsHandler(gatherer, *openMetricsCreated, persisted), *webMaxRequests)))
+	exporter.RegisterApi(http.DefaultServeMux)
+	http.Handle(cardinalityPath, CardinalityHandler(gatherer))
+	if *webUi {
+		RegisterUi(http.DefaultServeMux)
+	}
+	http.HandleFunc(healthzPath, serveHealthz)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, *metricsPath, http.StatusMovedPermanently)
 	})
+	handler := http.Handler(http.DefaultServeMux)
+	if *webCompression {
+		handler = CompressHandler(handler)
+	}
 	
-	fmt.Println("Listening on", *listenAddress)
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	if len(*webTlsCertFile) != 0 || len(*webTlsKeyFile) != 0 {
+		clientAuthPaths := []string{}
+		if len(*webTlsClientCaFile) != 0 && len(*webTlsClientAuthPaths) != 0 {
+			clientAuthPaths = strings.Split(*webTlsClientAuthPaths, ",")
+		}
+		tlsConfig, err := WebTlsConfig(*webTlsMinVersion, *webTlsCipherSuites, *webTlsClientCaFile, clientAuthPaths)
+		if err != nil {
+			log.Fatal("Invalid web server TLS configuration: ", err)
+		}
+		server := &http.Server{Addr: *listenAddress, TLSConfig: tlsConfig, Handler: handler}
+		if len(clientAuthPaths) != 0 {
+			server.Handler = RequireClientCertificate(handler, clientAuthPaths)
+		}
+		fmt.Fprintln(stdout, "Listening on", *listenAddress, "(HTTPS)")
+		log.Fatal(server.ListenAndServeTLS(*webTlsCertFile, *webTlsKeyFile))
+	}
+	fmt.Fprintln(stdout, "Listening on", *listenAddress)
+	log.Fatal(http.ListenAndServe(*listenAddress, handler))
+}
+
+
+
+// Hash utility methods, used to avoid exposing sensitive label values
+
+func HashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Label value of an account, a short hash of it with --hash-accounts
+func AccountLabel(account string) string {
+	if !*hashAccounts {
+		return account
+	}
+	return HashValue(account)[:16]
+}
+
+// Resource with the label value of its account, as exposed by the JSON API and the integrations
+func ResourceLabel(resource string) string {
+	currency, account, ok := strings.Cut(resource, "/")
+	if !ok {
+		return resource
+	}
+	return currency + "/" + AccountLabel(account)
+}
+
+
+
+// API timestamps utility methods
+
+// Metric with an explicit timestamp, unchanged (scrape time) if no timestamp is given
+func WithTimestamp(t *time.Time, metric prometheus.Metric) prometheus.Metric {
+	if t == nil {
+		return metric
+	}
+	return prometheus.NewMetricWithTimestamp(*t, metric)
 }
 
 
 
-// HTTP call utility method
+// HTTP call utility methods
+
+// Base URL of the F2Pool API, the one of the mock server with --mock
+var f2poolApiUrl = "https://api.f2pool.com/"
+
+// SetApiHeaders identifies the exporter in an F2Pool API request, with the configured extra headers
+func SetApiHeaders(req *http.Request) {
+	agent := *userAgent
+	if len(agent) == 0 {
+		agent = "f2pool-exporter/" + version
+	}
+	req.Header.Set("User-Agent", agent)
+	for name, value := range ParseHeaders(*apiHeaders) {
+		req.Header.Set(name, value)
+	}
+}
 
-func HttpGetCall(client *http.Client, uri string) (string) {
+func HttpGetCall(client *http.Client, uri string, token string) (string, error) {
+	if err := apiThrottle.Check(); err != nil {
+		return "", err
+	}
 	req, err := http.NewRequest("GET", uri, nil)
 
 	if err != nil {
-        log.Fatal(err)
-    }
+		return "", err
+	}
 
-	resp, err := client.Do(req)
+	SetApiHeaders(req)
+	if len(token) != 0 {
+		req.Header.Set("F2P-API-SECRET", token)
+	}
+
+	resp, err := ApiDo(client, req)
 
 	if err != nil {
-        log.Fatal(err)
-    }
+		return "", err
+	}
 
-    defer resp.Body.Close()
+	defer resp.Body.Close()
+	apiThrottle.Observe(resp)
 
-    body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 
-    if err != nil {
-        log.Fatal(err)
-    }
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
 
-    return string(body)
+	return string(body), nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Exporter of resources retrieved from the mock API, with the default flags
+func newMockExporter(t *testing.T, config *Config, resources ...string) *F2PoolExporter {
+	t.Helper()
+	url, err := StartMockServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, &f2poolApiUrl, url)
+	exporter, err := NewF2PoolExporter(NewResourceSet(config, resources), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exporter
+}
+
+// Sets a flag (or another global) for the duration of a test
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	previous := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = previous })
+}
+
+// Families of a counter, a gauge with labels and a histogram, for the sinks
+func testFamilies(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_paid_total", Help: "Paid"})
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_hashrate", Help: "Hashrate"}, []string{"currency", "worker"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds", Help: "Duration", Buckets: []float64{1, 2}})
+	registry.MustRegister(counter, gauge, histogram)
+	counter.Add(3)
+	gauge.WithLabelValues("bitcoin", "rig 1").Set(100)
+	for _, value := range []float64{0.5, 1.5, 1.5, 5} {
+		histogram.Observe(value)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families
+}
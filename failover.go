@@ -0,0 +1,181 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// F2Pool API endpoint failover: with --api-urls, the API requests are sent to the first reachable
+// endpoint (the default API first, then the fallback ones in order), an endpoint being marked down
+// when a request fails to reach it, and up again by the health checks (any HTTP answer of its base
+// URL), for sites where the API host is intermittently unreachable
+
+var (
+	f2pool_exporter_api_endpoint_up = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "api_endpoint_up"),
+		"Whether the F2Pool API endpoint is reachable", []string{"endpoint"}, nil)
+	f2pool_exporter_api_endpoint_active = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "api_endpoint_active"),
+		"Whether the F2Pool API endpoint is the one the requests are sent to", []string{"endpoint"}, nil)
+	f2pool_exporter_api_failovers_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "api_failovers_total"),
+		"Changes of the F2Pool API endpoint the requests are sent to", nil, nil)
+)
+
+// API endpoints, nil without fallback endpoint
+var apiEndpoints *ApiEndpoints
+
+type ApiEndpoints struct {
+	// Base URLs, the default API first
+	urls   []string
+	client *http.Client
+
+	mutex     sync.Mutex
+	up        []bool
+	active    int
+	failovers float64
+}
+
+func NewApiEndpoints(urls []string, transport http.RoundTripper) *ApiEndpoints {
+	endpoints := &ApiEndpoints{client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+	for _, u := range urls {
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+		endpoints.urls = append(endpoints.urls, u)
+		endpoints.up = append(endpoints.up, true)
+	}
+	return endpoints
+}
+
+// Endpoints in the order they are tried: the reachable ones, then the others
+func (e *ApiEndpoints) order() []int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	up, down := []int{}, []int{}
+	for i := range e.urls {
+		if e.up[i] {
+			up = append(up, i)
+		} else {
+			down = append(down, i)
+		}
+	}
+	return append(up, down...)
+}
+
+func (e *ApiEndpoints) setUp(index int, up bool, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.up[index] != up {
+		if up {
+			log.Println("F2Pool API endpoint", e.urls[index], "reachable again")
+		} else {
+			log.Println("Error reaching F2Pool API endpoint", e.urls[index], ":", err)
+		}
+	}
+	e.up[index] = up
+}
+
+func (e *ApiEndpoints) setActive(index int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.up[index] = true
+	if e.active != index {
+		log.Println("Sending F2Pool API requests to", e.urls[index])
+		e.active = index
+		e.failovers++
+	}
+}
+
+// Check probes every endpoint, no answer (not even an error status) marking it down
+func (e *ApiEndpoints) Check() {
+	for i, u := range e.urls {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			e.setUp(i, false, err)
+			continue
+		}
+		SetApiHeaders(req)
+		resp, err := e.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		e.setUp(i, err == nil, err)
+	}
+}
+
+// RunHealthChecks checks the endpoints every interval, it never returns
+func (e *ApiEndpoints) RunHealthChecks(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		e.Check()
+	}
+}
+
+func (e *ApiEndpoints) Collect(ch chan<- prometheus.Metric) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for i, u := range e.urls {
+		up, active := 0.0, 0.0
+		if e.up[i] {
+			up = 1
+		}
+		if i == e.active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_api_endpoint_up, prometheus.GaugeValue, up, u)
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_api_endpoint_active, prometheus.GaugeValue, active, u)
+	}
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_api_failovers_total, prometheus.CounterValue, e.failovers)
+}
+
+// FailoverTransport sends the requests made to the default API to the first reachable endpoint
+type FailoverTransport struct {
+	next      http.RoundTripper
+	endpoints *ApiEndpoints
+}
+
+func NewFailoverTransport(next http.RoundTripper, endpoints *ApiEndpoints) *FailoverTransport {
+	return &FailoverTransport{next: next, endpoints: endpoints}
+}
+
+func (t *FailoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.String(), t.endpoints.urls[0])
+	if path == req.URL.String() {
+		return t.next.RoundTrip(req)
+	}
+
+	var err error
+	for attempt, index := range t.endpoints.order() {
+		// Requests must not be modified by round trippers
+		retry := req.Clone(req.Context())
+		if retry.URL, err = url.Parse(t.endpoints.urls[index] + path); err != nil {
+			return nil, err
+		}
+		retry.Host = ""
+		if attempt != 0 && req.Body != nil && req.Body != http.NoBody {
+			// The body was consumed by the previous attempt
+			if req.GetBody == nil {
+				break
+			}
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		var resp *http.Response
+		resp, err = t.next.RoundTrip(retry)
+		if err == nil {
+			t.endpoints.setActive(index)
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			break
+		}
+		t.endpoints.setUp(index, false, err)
+	}
+	return nil, err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// Fault injection for resilience testing: latency and errors added to the F2Pool API calls with the
+// hidden --debug.inject-latency and --debug.inject-error-rate flags, so alerting pipelines and the
+// cache behavior can be exercised in staging. Flags named debug.* are not listed in the usage
+
+var errInjectedFault = errors.New("injected fault (--debug.inject-error-rate)")
+
+// Delays the API call and fails it at the configured rate
+func injectFault() error {
+	if *injectLatency > 0 {
+		time.Sleep(*injectLatency)
+	}
+	if *injectErrorRate > 0 && rand.Float64() < *injectErrorRate {
+		return errInjectedFault
+	}
+	return nil
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.VisitAll(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, "debug.") {
+				return
+			}
+			fmt.Fprintf(flag.CommandLine.Output(), "  -%s\n    \t%s", f.Name, f.Usage)
+			if len(f.DefValue) != 0 && f.DefValue != "false" {
+				fmt.Fprintf(flag.CommandLine.Output(), " (default %q)", f.DefValue)
+			}
+			fmt.Fprintln(flag.CommandLine.Output())
+		})
+	}
+}
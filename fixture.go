@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fixtures record and replay: the F2Pool API answers (and the request errors) are recorded to a
+// directory with --record-dir, and replayed from it with --replay-dir, for reproducible integration
+// tests and offline demos. The answers of a request are replayed in their recorded order, the last
+// one being repeated. Request headers (API tokens) are not recorded
+
+type fixtureExchange struct {
+	Method string              `json:"method"`
+	Url    string              `json:"url"`
+	Status int                 `json:"status,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   string              `json:"body,omitempty"`
+	// Error of the request (timeout, connection refused...)
+	Error string `json:"error,omitempty"`
+}
+
+type FixtureStore struct {
+	dir    string
+	replay bool
+
+	mutex sync.Mutex
+	// Recorded or replayed exchanges, and index of the next one to replay, by request key
+	exchanges map[string][]fixtureExchange
+	next      map[string]int
+}
+
+// fixtures is set when recording or replaying
+var fixtures *FixtureStore
+
+func NewFixtureStore(dir string, replay bool) (*FixtureStore, error) {
+	if !replay {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &FixtureStore{dir: dir, replay: replay, exchanges: map[string][]fixtureExchange{}, next: map[string]int{}}, nil
+}
+
+// Key of a request: its method, URL (relative to the API one, the mock API port changing) and body,
+// without the times of the v2 payloads (relative to now)
+func fixtureKey(req *http.Request, body []byte) string {
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) == nil {
+		delete(payload, "start_time")
+		delete(payload, "end_time")
+		body, _ = json.Marshal(payload)
+	}
+	hash := sha256.Sum256([]byte(req.Method + " " + strings.TrimPrefix(req.URL.String(), f2poolApiUrl) + "\n" + string(body)))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Do makes the request, recording its answer, or replays the recorded answer
+func (f *FixtureStore) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	body := []byte{}
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	key := fixtureKey(req, body)
+
+	if f.replay {
+		exchange, err := f.nextExchange(key)
+		if err != nil {
+			return nil, fmt.Errorf("replay of %s %s: %w", req.Method, req.URL, err)
+		}
+		if len(exchange.Error) != 0 {
+			return nil, errors.New(exchange.Error)
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+			StatusCode: exchange.Status,
+			Header:     http.Header(exchange.Header),
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(exchange.Body))),
+			Request:    req,
+		}, nil
+	}
+
+	exchange := fixtureExchange{Method: req.Method, Url: req.URL.String()}
+	resp, err := client.Do(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		f.record(key, exchange)
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	exchange.Status = resp.StatusCode
+	exchange.Header = resp.Header
+	exchange.Body = string(data)
+	f.record(key, exchange)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+func (f *FixtureStore) nextExchange(key string) (*fixtureExchange, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	exchanges, ok := f.exchanges[key]
+	if !ok {
+		data, err := ioutil.ReadFile(filepath.Join(f.dir, key+".json"))
+		if err != nil {
+			return nil, errors.New("no recorded answer")
+		}
+		if err := json.Unmarshal(data, &exchanges); err != nil {
+			return nil, err
+		}
+		if len(exchanges) == 0 {
+			return nil, errors.New("no recorded answer")
+		}
+		f.exchanges[key] = exchanges
+	}
+
+	index := f.next[key]
+	if index < len(exchanges)-1 {
+		f.next[key] = index + 1
+	}
+	return &exchanges[index], nil
+}
+
+// Appends an exchange to the file of the request
+func (f *FixtureStore) record(key string, exchange fixtureExchange) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.exchanges[key] = append(f.exchanges[key], exchange)
+	data, err := json.MarshalIndent(f.exchanges[key], "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(f.dir, key+".json"), data, 0644)
+	}
+	if err != nil {
+		log.Println("Error recording fixture of", exchange.Url, ":", err)
+	}
+}
+
+// ApiDo makes an F2Pool API request, through the response cache and through the fixtures when
+// recording or replaying
+func ApiDo(client *http.Client, req *http.Request) (*http.Response, error) {
+	if apiCache != nil {
+		return apiCache.Do(req, func(req *http.Request) (*http.Response, error) {
+			return apiDo(client, req)
+		})
+	}
+	return apiDo(client, req)
+}
+
+func apiDo(client *http.Client, req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&apiRequestsInFlight, 1)
+	defer atomic.AddInt64(&apiRequestsInFlight, -1)
+	if err := injectFault(); err != nil {
+		return nil, err
+	}
+	if apiQuotas != nil {
+		apiQuotas.Observe(apiEndpointName(req), time.Now())
+	}
+	if fixtures != nil {
+		return fixtures.Do(client, req)
+	}
+	return client.Do(req)
+}
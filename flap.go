@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Flapping workers: the online (hashing) / offline transitions of each worker are counted, in total
+// and over the last --worker-flap-window, to tell the rigs with an unstable network or power from
+// the ones with hard failures
+
+var (
+	f2pool_worker_flaps_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_flaps_total"),
+		"Online / offline transitions of the worker since the exporter started", []string{"currency", "account", "worker"}, nil)
+	f2pool_worker_flaps_recent = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_flaps_recent"),
+		"Online / offline transitions of the worker over the last --worker-flap-window", []string{"currency", "account", "worker"}, nil)
+)
+
+type workerFlaps struct {
+	online bool
+	total  float64
+	// Times of the transitions of the window
+	transitions []time.Time
+	seen        time.Time
+}
+
+type FlapTracker struct {
+	window time.Duration
+
+	mutex   sync.Mutex
+	workers map[string]*workerFlaps
+}
+
+func NewFlapTracker(window time.Duration) *FlapTracker {
+	return &FlapTracker{window: window, workers: map[string]*workerFlaps{}}
+}
+
+// Observe records the current state of a worker and returns its transitions, in total and over the
+// window
+func (t *FlapTracker) Observe(key string, online bool, now time.Time) (float64, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	flaps, ok := t.workers[key]
+	if !ok {
+		flaps = &workerFlaps{online: online}
+		t.workers[key] = flaps
+	}
+	flaps.seen = now
+	if flaps.online != online {
+		flaps.online = online
+		flaps.total++
+		flaps.transitions = append(flaps.transitions, now)
+	}
+	for len(flaps.transitions) != 0 && now.Sub(flaps.transitions[0]) > t.window {
+		flaps.transitions = flaps.transitions[1:]
+	}
+	return flaps.total, len(flaps.transitions)
+}
+
+// Expire removes the workers not observed for a window
+func (t *FlapTracker) Expire(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for key, flaps := range t.workers {
+		if now.Sub(flaps.seen) > t.window {
+			delete(t.workers, key)
+		}
+	}
+}
+
+func (t *FlapTracker) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.workers)
+}
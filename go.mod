@@ -2,6 +2,9 @@ module github.com/jacqueslorentz/f2pool-exporter
 
 require (
     github.com/prometheus/client_golang v1.12.2
+    github.com/prometheus/client_model v0.2.0
+    github.com/prometheus/common v0.32.1
+    google.golang.org/protobuf v1.26.0
 )
 
 go 1.18
\ No newline at end of file
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Graphite/Carbon sink, using the plaintext (port 2003) or pickle (port 2004) protocol
+// Paths are {prefix}.{metric name}.{label name}.{label value}... with sorted label names
+
+type GraphiteSink struct {
+	address  string
+	protocol string
+	prefix   string
+}
+
+func NewGraphiteSink(address string, protocol string, prefix string) (*GraphiteSink, error) {
+	if protocol != "plaintext" && protocol != "pickle" {
+		return nil, fmt.Errorf("unknown Graphite protocol %q", protocol)
+	}
+	return &GraphiteSink{address: address, protocol: protocol, prefix: prefix}, nil
+}
+
+func (s *GraphiteSink) Push(families []*dto.MetricFamily) error {
+	samples := FlattenFamilies(families, time.Now())
+
+	conn, err := net.DialTimeout("tcp", s.address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	w := bufio.NewWriter(conn)
+	if s.protocol == "pickle" {
+		payload := graphitePickle(s, samples)
+		binary.Write(w, binary.BigEndian, uint32(len(payload)))
+		w.Write(payload)
+	} else {
+		for _, sample := range samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			fmt.Fprintf(w, "%s %g %d\n", s.path(sample), sample.Value, sample.Time.Unix())
+		}
+	}
+	return w.Flush()
+}
+
+func (s *GraphiteSink) path(sample FlatSample) string {
+	var b strings.Builder
+	if len(s.prefix) != 0 {
+		b.WriteString(s.prefix)
+		b.WriteByte('.')
+	}
+	b.WriteString(graphiteSanitize(sample.Name))
+
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteByte('.')
+		b.WriteString(graphiteSanitize(name))
+		b.WriteByte('.')
+		b.WriteString(graphiteSanitize(sample.Labels[name]))
+	}
+	return b.String()
+}
+
+// Replaces the characters which have a meaning in Graphite paths
+func graphiteSanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == ' ' || r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// Pickle protocol 2 encoding of [(path, (timestamp, value)), ...]
+func graphitePickle(s *GraphiteSink, samples []FlatSample) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x80, 2}) // PROTO 2
+	b.WriteByte(']')         // EMPTY_LIST
+	b.WriteByte('(')         // MARK
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		path := s.path(sample)
+		b.WriteByte('X') // BINUNICODE
+		binary.Write(&b, binary.LittleEndian, uint32(len(path)))
+		b.WriteString(path)
+		b.WriteByte('J') // BININT
+		binary.Write(&b, binary.LittleEndian, int32(sample.Time.Unix()))
+		b.WriteByte('G') // BINFLOAT
+		binary.Write(&b, binary.BigEndian, sample.Value)
+		b.WriteByte(0x86) // TUPLE2 (timestamp, value)
+		b.WriteByte(0x86) // TUPLE2 (path, (timestamp, value))
+	}
+	b.WriteByte('e') // APPENDS
+	b.WriteByte('.') // STOP
+	return b.Bytes()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Carbon listener returning the data received by each connection
+func startCarbon(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			received <- data
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestGraphiteSinkPushPlaintext(t *testing.T) {
+	address, received := startCarbon(t)
+	sink, err := NewGraphiteSink(address, "plaintext", "mining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Push(testFamilies(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(<-received)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("line %q, want path value timestamp", line)
+		}
+		paths[fields[0]] = fields[1]
+	}
+	tests := []struct {
+		path  string
+		value string
+	}{
+		{"mining.test_paid_total", "3"},
+		// Label values with a space are sanitized
+		{"mining.test_hashrate.currency.bitcoin.worker.rig_1", "100"},
+		{"mining.test_duration_seconds_bucket.le.2", "3"},
+		{"mining.test_duration_seconds_bucket.le.+Inf", "4"},
+		{"mining.test_duration_seconds_count", "4"},
+	}
+	for _, test := range tests {
+		if got := paths[test.path]; got != test.value {
+			t.Errorf("value of %s = %q, want %q", test.path, got, test.value)
+		}
+	}
+}
+
+func TestGraphiteSinkPushPickle(t *testing.T) {
+	address, received := startCarbon(t)
+	sink, err := NewGraphiteSink(address, "pickle", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Push(testFamilies(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-received
+	if len(data) < 4 || int(binary.BigEndian.Uint32(data)) != len(data)-4 {
+		t.Fatalf("payload of %d bytes, want the length header", len(data))
+	}
+	payload := data[4:]
+	if !bytes.HasPrefix(payload, []byte{0x80, 2, ']', '('}) || !bytes.HasSuffix(payload, []byte("e.")) {
+		t.Errorf("payload %q, want a protocol 2 list", payload)
+	}
+	path := "test_hashrate.currency.bitcoin.worker.rig_1"
+	var prefix [5]byte
+	prefix[0] = 'X'
+	binary.LittleEndian.PutUint32(prefix[1:], uint32(len(path)))
+	if !bytes.Contains(payload, append(prefix[:], path...)) {
+		t.Errorf("payload %q does not contain the unicode path %s", payload, path)
+	}
+}
+
+func TestNewGraphiteSinkInvalidProtocol(t *testing.T) {
+	if _, err := NewGraphiteSink("localhost:2003", "udp", ""); err == nil {
+		t.Error("NewGraphiteSink with an unknown protocol = nil error, want an error")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Compressed F2Pool API answers: gzip is requested and the answers are decompressed before being
+// read, even when --api-headers sets Accept-Encoding (the HTTP client only decompresses the
+// answers of the requests it added the header to), the worker lists being much smaller compressed
+
+type GzipTransport struct {
+	next http.RoundTripper
+}
+
+func NewGzipTransport(next http.RoundTripper) *GzipTransport {
+	return &GzipTransport{next: next}
+}
+
+func (t *GzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("Accept-Encoding")) == 0 {
+		// Requests must not be modified by round trippers
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp, err
+	}
+
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &gzipBody{reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type gzipBody struct {
+	reader *gzip.Reader
+	body   io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+// CompressHandler compresses the answers of a handler for the clients accepting gzip (the metrics
+// of large farms being several megabytes)
+func CompressHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		defer writer.Close()
+		handler.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, writer: writer}, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) == "gzip" || strings.TrimSpace(name) == "*" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	// The length of the handler is the uncompressed one
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
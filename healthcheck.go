@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Health check: /healthz answers ok while the web server runs, the healthcheck command checks it
+// on the local listen address (for Docker HEALTHCHECK, without curl nor wget in the image)
+
+const healthzPath = "/healthz"
+
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// runHealthcheck calls /healthz on the listen address and returns the exit code of the command
+func runHealthcheck(listenAddress string, tlsEnabled bool) int {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid listen address:", err)
+		return 1
+	}
+	// Listening on every interface
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	transport := &http.Transport{}
+	if tlsEnabled {
+		// The certificate is issued for the public name of the exporter, not for the local address
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Timeout: 5 * time.Second, Transport: transport}
+
+	resp, err := client.Get(scheme + "://" + net.JoinHostPort(host, port) + healthzPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unhealthy:", err)
+		return 1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, "Unhealthy: unexpected status", resp.Status)
+		return 1
+	}
+	return 0
+}
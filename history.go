@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History store: the account-level values of the collections are recorded (at most once per
+// --history-interval for each resource) in a directory, and served by the JSON API, so that users
+// without Prometheus still get a short-term history:
+//   /api/v1/history?resource={currency}/{account}&range=7d
+// The store is a set of JSON lines files in the directory, not the SQLite database first asked
+// for: the exporter only depends on the Prometheus libraries, and a pure Go SQLite driver (e.g.
+// modernc.org/sqlite) would add a large dependency for a few append-only tables. The samples and
+// exchange rates are read from the files on query, so the memory does not grow with the retention:
+// only the samples of the revenue average range and the daily rollups are kept in memory
+
+const historySamplesFile = "samples.jsonl"
+
+// Daily rollups: the aggregates of each day (UTC) of a resource are computed from its samples and
+// recorded at the end of the day, the samples of the current day rebuilding them after a restart
+const historyRollupsFile = "rollups.jsonl"
+
+type DailyRollup struct {
+	Date     string `json:"date"`
+	Resource string `json:"resource"`
+	// Revenue and payouts of the day: increases of the value and paid totals
+	Revenue float64 `json:"revenue"`
+	Paid    float64 `json:"paid"`
+	// Average of the hashrate samples of the day
+	Hashrate float64 `json:"hashrate"`
+	Samples  int     `json:"samples"`
+}
+
+// Aggregates of the current day of a resource
+type rollupAccumulator struct {
+	rollup DailyRollup
+	// Totals at the end of the previous day (or at the first sample), and the last ones
+	baseValue, basePaid float64
+	lastValue, lastPaid float64
+	hashrateSum         float64
+}
+
+type HistorySample struct {
+	Time                       time.Time `json:"time"`
+	Resource                   string    `json:"resource"`
+	Balance                    float64   `json:"balance"`
+	Paid                       float64   `json:"paid"`
+	Value                      float64   `json:"value"`
+	ValueLastDay               float64   `json:"value_last_day"`
+	Hashrate                   float64   `json:"hashrate"`
+	HashesLastDay              float64   `json:"hashes_last_day"`
+	StaleHashesRejectedLastDay float64   `json:"stale_hashes_rejected_last_day"`
+	WorkersCount               int       `json:"workers_count"`
+}
+
+type HistoryStore struct {
+	dir      string
+	interval time.Duration
+
+	mutex sync.RWMutex
+	// Time of the last sample of each resource, and its samples of the last recentRange (for the
+	// revenue average) in time order
+	last         map[string]time.Time
+	recent       map[string][]HistorySample
+	recentRange  time.Duration
+	samplesCount int
+	file         *os.File
+
+	rollups      []DailyRollup
+	accumulators map[string]*rollupAccumulator
+	rollupsFile  *os.File
+	// Rollups ended while loading, written once the file is opened
+	pendingRollups []DailyRollup
+
+	// Exchange rates retrieved with --fiat
+	pricesCount int
+	pricesFile  *os.File
+
+	// Retention of the samples, and of the rollups and exchange rates, 0 to keep them forever
+	samplesRetention time.Duration
+	rollupsRetention time.Duration
+	lastCompaction   time.Time
+}
+
+// OpenHistoryStore opens the store of the directory, created if needed, keeping the samples of the
+// last recentRange of each resource in memory
+func OpenHistoryStore(dir string, interval time.Duration, recentRange time.Duration) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &HistoryStore{dir: dir, interval: interval, last: map[string]time.Time{}, recent: map[string][]HistorySample{}, recentRange: recentRange, accumulators: map[string]*rollupAccumulator{}}
+	rolledUp := map[string]string{}
+	if err := readJsonLines(filepath.Join(dir, historyRollupsFile), func(line []byte) error {
+		rollup := DailyRollup{}
+		if err := json.Unmarshal(line, &rollup); err != nil {
+			return err
+		}
+		s.rollups = append(s.rollups, rollup)
+		rolledUp[rollup.Resource] = rollup.Date
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readJsonLines(filepath.Join(dir, historySamplesFile), func(line []byte) error {
+		sample := HistorySample{}
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		s.samplesCount++
+		s.last[sample.Resource] = sample.Time
+		s.keepRecent(sample)
+		// Days already rolled up only give the totals of their end
+		if sample.Time.Format("2006-01-02") <= rolledUp[sample.Resource] {
+			s.accumulate(sample, false)
+		} else if _, err := s.accumulate(sample, true); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.file, err = os.OpenFile(filepath.Join(dir, historySamplesFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		return nil, err
+	}
+	if s.rollupsFile, err = os.OpenFile(filepath.Join(dir, historyRollupsFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		return nil, err
+	}
+	// Rollups of the days which ended while loading the samples
+	for _, rollup := range s.pendingRollups {
+		if err := s.writeRollup(rollup); err != nil {
+			return nil, err
+		}
+	}
+	s.pendingRollups = nil
+	if err := s.openPrices(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Adds a sample to the aggregates of its day, returning the rollup of the previous day when the
+// sample starts a new day. Only the totals are updated if the day is not rolled up
+func (s *HistoryStore) accumulate(sample HistorySample, rollUp bool) (*DailyRollup, error) {
+	date := sample.Time.Format("2006-01-02")
+	accumulator := s.accumulators[sample.Resource]
+	var ended *DailyRollup
+	if accumulator == nil || accumulator.rollup.Date != date {
+		next := &rollupAccumulator{rollup: DailyRollup{Date: date, Resource: sample.Resource}, baseValue: sample.Value, basePaid: sample.Paid}
+		if accumulator != nil {
+			if accumulator.rollup.Samples != 0 {
+				rollup := accumulator.finish()
+				ended = &rollup
+			}
+			next.baseValue, next.basePaid = accumulator.lastValue, accumulator.lastPaid
+		}
+		accumulator = next
+		s.accumulators[sample.Resource] = accumulator
+	}
+	accumulator.lastValue, accumulator.lastPaid = sample.Value, sample.Paid
+	if rollUp {
+		accumulator.hashrateSum += sample.Hashrate
+		accumulator.rollup.Samples++
+	}
+
+	if ended != nil {
+		s.rollups = append(s.rollups, *ended)
+		if s.rollupsFile == nil {
+			s.pendingRollups = append(s.pendingRollups, *ended)
+			return ended, nil
+		}
+		return ended, s.writeRollup(*ended)
+	}
+	return nil, nil
+}
+
+func (a *rollupAccumulator) finish() DailyRollup {
+	rollup := a.rollup
+	// Decreasing totals (account reset) count as no revenue
+	rollup.Revenue = math.Max(a.lastValue-a.baseValue, 0)
+	rollup.Paid = math.Max(a.lastPaid-a.basePaid, 0)
+	rollup.Hashrate = a.hashrateSum / float64(rollup.Samples)
+	return rollup
+}
+
+func (s *HistoryStore) writeRollup(rollup DailyRollup) error {
+	data, err := json.Marshal(rollup)
+	if err != nil {
+		return err
+	}
+	_, err = s.rollupsFile.Write(append(data, '\n'))
+	return err
+}
+
+// Rollups returns the daily rollups of a resource since the given date (YYYY-MM-DD)
+func (s *HistoryStore) Rollups(resource string, since string) []DailyRollup {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rollups := []DailyRollup{}
+	for _, rollup := range s.rollups {
+		if rollup.Resource == resource && rollup.Date >= since {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups
+}
+
+// Reads a JSON lines file, a missing file having no line
+func readJsonLines(path string, read func(line []byte) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := read(scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Record stores the values of a snapshot, unless the resource was recorded less than an interval ago
+func (s *HistoryStore) Record(resource string, snapshot *AccountSnapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if last, ok := s.last[resource]; ok && snapshot.UpdatedAt.Sub(last) < s.interval {
+		return nil
+	}
+	sample := HistorySample{
+		Time:                       snapshot.UpdatedAt.UTC(),
+		Resource:                   resource,
+		Balance:                    snapshot.Balance,
+		Paid:                       snapshot.Paid,
+		Value:                      snapshot.Value,
+		ValueLastDay:               snapshot.ValueLastDay,
+		Hashrate:                   snapshot.Hashrate,
+		HashesLastDay:              snapshot.HashesLastDay,
+		StaleHashesRejectedLastDay: snapshot.StaleHashesRejectedLastDay,
+		WorkersCount:               snapshot.WorkersCount,
+	}
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.samplesCount++
+	s.last[resource] = sample.Time
+	s.keepRecent(sample)
+	_, err = s.accumulate(sample, true)
+	return err
+}
+
+// Adds a sample to the recent ones of its resource, dropping the ones out of the recent range
+func (s *HistoryStore) keepRecent(sample HistorySample) {
+	recent := append(s.recent[sample.Resource], sample)
+	since := sample.Time.Add(-s.recentRange)
+	i := 0
+	for i < len(recent) && recent[i].Time.Before(since) {
+		i++
+	}
+	s.recent[sample.Resource] = recent[i:]
+}
+
+// Samples returns the samples of a resource recorded since the given time, read from the file
+func (s *HistoryStore) Samples(resource string, since time.Time) ([]HistorySample, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	samples := []HistorySample{}
+	err := readJsonLines(filepath.Join(s.dir, historySamplesFile), func(line []byte) error {
+		sample := HistorySample{}
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		if sample.Resource == resource && !sample.Time.Before(since) {
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// ParseRange parses a duration, also accepting days (e.g. 7d)
+func ParseRange(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		count, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid range %q", value)
+		}
+		return time.Duration(count * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func (e *F2PoolExporter) serveHistory(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	if currency, account, ok := strings.Cut(resource, "/"); !ok || len(currency) == 0 || len(account) == 0 {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid resource, expected {currency}/{account}"})
+		return
+	}
+	length := 24 * time.Hour
+	if value := r.URL.Query().Get("range"); len(value) != 0 {
+		var err error
+		if length, err = ParseRange(value); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	resource, ok := e.resourceOf(resource)
+	if !ok {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "unknown resource"})
+		return
+	}
+	samples, err := e.history.Samples(ResourceLabel(resource), time.Now().Add(-length))
+	if err != nil {
+		log.Println("Error reading history of", resource, ":", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "history unavailable"})
+		return
+	}
+	writeJson(w, http.StatusOK, samples)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryHashAccounts(t *testing.T) {
+	const address = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	setFlag(t, hashAccounts, true)
+	exporter := newMockExporter(t, &Config{}, "bitcoin/"+address)
+	dir := t.TempDir()
+	history, err := OpenHistoryStore(dir, 0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter.history = history
+	exporter.Refresh()
+
+	data, err := os.ReadFile(filepath.Join(dir, historySamplesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := "bitcoin/" + AccountLabel(address)
+	if strings.Contains(string(data), address) || !strings.Contains(string(data), label) {
+		t.Errorf("history file = %s, want samples of %s only", data, label)
+	}
+
+	tests := []struct {
+		resource string
+		status   int
+	}{
+		{label, http.StatusOK},
+		{"btc/" + AccountLabel(address), http.StatusOK},
+		{"bitcoin/" + address, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		exporter.serveHistory(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?resource="+test.resource, nil))
+		if w.Code != test.status {
+			t.Errorf("history of %s answered %d, want %d", test.resource, w.Code, test.status)
+			continue
+		}
+		if strings.Contains(w.Body.String(), address) {
+			t.Errorf("history of %s = %s, contains the account", test.resource, w.Body.String())
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		samples := []HistorySample{}
+		if err := json.Unmarshal(w.Body.Bytes(), &samples); err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 1 || samples[0].Resource != label {
+			t.Errorf("history of %s = %+v, want a sample of %s", test.resource, samples, label)
+		}
+	}
+}
+
+func TestHistoryStoreRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenHistoryStore(dir, 5*time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	records := []struct {
+		resource string
+		at       time.Duration
+		value    float64
+	}{
+		{"bitcoin/a", 0, 1},
+		// Within the interval, not recorded
+		{"bitcoin/a", time.Minute, 2},
+		{"bitcoin/b", time.Minute, 10},
+		{"bitcoin/a", 5 * time.Minute, 3},
+		{"bitcoin/a", 2 * time.Hour, 4},
+	}
+	for _, record := range records {
+		snapshot := &AccountSnapshot{UpdatedAt: start.Add(record.at), Value: record.value, ValueLastDay: record.value}
+		if err := store.Record(record.resource, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		resource string
+		since    time.Duration
+		values   []float64
+	}{
+		{"bitcoin/a", 0, []float64{1, 3, 4}},
+		{"bitcoin/a", time.Hour, []float64{4}},
+		{"bitcoin/b", 0, []float64{10}},
+		{"bitcoin/c", 0, nil},
+	}
+	check := func(store *HistoryStore) {
+		for _, test := range tests {
+			samples, err := store.Samples(test.resource, start.Add(test.since))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := []float64{}
+			for _, sample := range samples {
+				values = append(values, sample.Value)
+			}
+			if len(values) != len(test.values) || (len(values) != 0 && !reflect.DeepEqual(values, test.values)) {
+				t.Errorf("Samples(%s, +%v) = %v, want %v", test.resource, test.since, values, test.values)
+			}
+		}
+	}
+	check(store)
+
+	// Only the samples of the recent range are averaged
+	if average, ok := store.AverageValueLastDay("bitcoin/a", start); !ok || average != 4 {
+		t.Errorf("AverageValueLastDay = %v, %v, want 4", average, ok)
+	}
+
+	// The samples are read from the files after a restart
+	reopened, err := OpenHistoryStore(dir, 5*time.Minute, 3*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+	if average, ok := reopened.AverageValueLastDay("bitcoin/a", start); !ok || average != 8.0/3 {
+		t.Errorf("AverageValueLastDay after restart = %v, %v, want %v", average, ok, 8.0/3)
+	}
+	if err := reopened.Record("bitcoin/a", &AccountSnapshot{UpdatedAt: start.Add(2*time.Hour + time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if samples, _ := reopened.Samples("bitcoin/a", start); len(samples) != 3 {
+		t.Errorf("Samples after restart = %v, want the interval of the recorded ones kept", samples)
+	}
+}
+
+func TestHistoryStoreRollups(t *testing.T) {
+	store, err := OpenHistoryStore(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	snapshots := []AccountSnapshot{
+		{UpdatedAt: day, Value: 1, Paid: 0, Hashrate: 100},
+		{UpdatedAt: day.Add(12 * time.Hour), Value: 1.5, Paid: 0, Hashrate: 200},
+		{UpdatedAt: day.Add(24 * time.Hour), Value: 2, Paid: 1, Hashrate: 300},
+		// Account reset, no negative revenue
+		{UpdatedAt: day.Add(48 * time.Hour), Value: 0.5, Paid: 1, Hashrate: 400},
+		{UpdatedAt: day.Add(72 * time.Hour), Value: 0.7, Paid: 1, Hashrate: 400},
+	}
+	for i := range snapshots {
+		if err := store.Record("bitcoin/a", &snapshots[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The revenue of a day is the increase from the last value of the previous day
+	want := []DailyRollup{
+		{Date: "2024-01-02", Resource: "bitcoin/a", Revenue: 0.5, Paid: 0, Hashrate: 150, Samples: 2},
+		{Date: "2024-01-03", Resource: "bitcoin/a", Revenue: 0.5, Paid: 1, Hashrate: 300, Samples: 1},
+		{Date: "2024-01-04", Resource: "bitcoin/a", Revenue: 0, Paid: 0, Hashrate: 400, Samples: 1},
+	}
+	if rollups := store.Rollups("bitcoin/a", "2024-01-01"); !reflect.DeepEqual(rollups, want) {
+		t.Errorf("Rollups = %+v, want %+v", rollups, want)
+	}
+	if rollups := store.Rollups("bitcoin/a", "2024-01-04"); !reflect.DeepEqual(rollups, want[2:]) {
+		t.Errorf("Rollups since 2024-01-04 = %+v, want %+v", rollups, want[2:])
+	}
+}
+
+func TestHistoryStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenHistoryStore(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for days := 5; days >= 0; days-- {
+		at := now.AddDate(0, 0, -days)
+		if err := store.Record("bitcoin/a", &AccountSnapshot{UpdatedAt: at, Value: float64(days)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RecordPrice("bitcoin", "usd", float64(days), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.SetRetention(48*time.Hour, 72*time.Hour)
+	if err := store.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := store.Samples("bitcoin/a", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 || store.samplesCount != 3 {
+		t.Errorf("samples after compaction = %+v (count %d), want the last 3", samples, store.samplesCount)
+	}
+	prices, err := store.Prices("bitcoin", "USD", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 4 || store.pricesCount != 4 {
+		t.Errorf("prices after compaction = %+v (count %d), want the last 4", prices, store.pricesCount)
+	}
+
+	// The next entries are appended to the rewritten files
+	if err := store.Record("bitcoin/a", &AccountSnapshot{UpdatedAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if samples, _ := store.Samples("bitcoin/a", time.Time{}); len(samples) != 4 {
+		t.Errorf("samples after a new record = %d, want 4", len(samples))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
+
+func TestHistoryStoreDailyPrices(t *testing.T) {
+	store, err := OpenHistoryStore(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i, price := range []float64{100, 200, 300} {
+		if err := store.RecordPrice("bitcoin", "usd", price, day.Add(time.Duration(i)*12*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []DailyPrice{
+		{Date: "2024-01-02", Currency: "bitcoin", Fiat: "usd", Price: 150, Samples: 2},
+		{Date: "2024-01-03", Currency: "bitcoin", Fiat: "usd", Price: 300, Samples: 1},
+	}
+	days, err := store.DailyPrices("bitcoin", "usd", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("DailyPrices = %+v, want %+v", days, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Retention of the history store: the samples older than --history-retention, and the rollups and
+// exchange rates older than --history-rollups-retention, are removed by a background compaction
+// which rewrites the files, so that the store can run unattended on small disks
+
+var (
+	f2pool_exporter_history_disk_bytes = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "history_disk_bytes"),
+		"Size of the files of the history store", []string{"file"}, nil)
+	f2pool_exporter_history_entries = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "history_entries"),
+		"Entries of the history store", []string{"kind"}, nil)
+	f2pool_exporter_history_last_compaction_timestamp_seconds = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "history_last_compaction_timestamp_seconds"),
+		"Time of the last compaction of the history store", nil, nil)
+)
+
+// SetRetention sets the retention durations of the samples and of the rollups and exchange rates,
+// 0 keeps them forever
+func (s *HistoryStore) SetRetention(samples time.Duration, rollups time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samplesRetention = samples
+	s.rollupsRetention = rollups
+}
+
+// Compact removes the entries older than their retention and rewrites the files which had some
+func (s *HistoryStore) Compact(now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.samplesRetention != 0 {
+		since := now.Add(-s.samplesRetention)
+		kept, err := s.compactFile(historySamplesFile, &s.file, func(line []byte) (bool, error) {
+			sample := HistorySample{}
+			err := json.Unmarshal(line, &sample)
+			return !sample.Time.Before(since), err
+		})
+		if err != nil {
+			return err
+		}
+		s.samplesCount = kept
+	}
+
+	if s.rollupsRetention != 0 {
+		since := now.Add(-s.rollupsRetention)
+		date := since.UTC().Format("2006-01-02")
+		if _, err := s.compactFile(historyRollupsFile, &s.rollupsFile, func(line []byte) (bool, error) {
+			rollup := DailyRollup{}
+			err := json.Unmarshal(line, &rollup)
+			return rollup.Date >= date, err
+		}); err != nil {
+			return err
+		}
+		rollups := make([]DailyRollup, 0, len(s.rollups))
+		for _, rollup := range s.rollups {
+			if rollup.Date >= date {
+				rollups = append(rollups, rollup)
+			}
+		}
+		s.rollups = rollups
+
+		kept, err := s.compactFile(historyPricesFile, &s.pricesFile, func(line []byte) (bool, error) {
+			sample := PriceSample{}
+			err := json.Unmarshal(line, &sample)
+			return !sample.Time.Before(since), err
+		})
+		if err != nil {
+			return err
+		}
+		s.pricesCount = kept
+	}
+
+	s.lastCompaction = now
+	return nil
+}
+
+// Replaces a file with the lines kept by keep when some are removed (atomically, a crash leaves
+// either file), the file is read line by line, and reopens it for the next entries. Returns the
+// number of lines kept
+func (s *HistoryStore) compactFile(name string, file **os.File, keep func(line []byte) (bool, error)) (int, error) {
+	path := filepath.Join(s.dir, name)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(tmp)
+	kept, removed := 0, 0
+	err = readJsonLines(path, func(line []byte) error {
+		ok, err := keep(line)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			removed++
+			return nil
+		}
+		kept++
+		if _, err := writer.Write(line); err != nil {
+			return err
+		}
+		return writer.WriteByte('\n')
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || removed == 0 {
+		os.Remove(tmp.Name())
+		return kept, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	// The previous file was renamed over, the next entries go to the new one
+	(*file).Close()
+	*file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return kept, err
+}
+
+// RunCompaction compacts the store now and then every interval, it never returns
+func (s *HistoryStore) RunCompaction(interval time.Duration) {
+	for {
+		if err := s.Compact(time.Now()); err != nil {
+			log.Println("Error compacting history store", s.dir, ":", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *HistoryStore) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, name := range []string{historySamplesFile, historyRollupsFile, historyPricesFile} {
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			ch <- prometheus.MustNewConstMetric(f2pool_exporter_history_disk_bytes, prometheus.GaugeValue, float64(info.Size()), name)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_history_entries, prometheus.GaugeValue, float64(s.samplesCount), "samples")
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_history_entries, prometheus.GaugeValue, float64(len(s.rollups)), "rollups")
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_history_entries, prometheus.GaugeValue, float64(s.pricesCount), "prices")
+	if !s.lastCompaction.IsZero() {
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_history_last_compaction_timestamp_seconds, prometheus.GaugeValue, float64(s.lastCompaction.Unix()))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Home Assistant MQTT discovery, published along the values so balances, hashrate and
+// workers online state appear as entities
+// See: https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueId          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+var haInvalidId = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func haId(parts ...string) string {
+	return haInvalidId.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
+
+// Discovery topic to config payload of the entities of a resource
+func haDiscoveryConfigs(discoveryPrefix string, topicPrefix string, snapshot *AccountSnapshot) map[string]string {
+	base := mqttAccountTopic(topicPrefix, snapshot)
+	nodeId := haId("f2pool", snapshot.Currency, snapshot.Account)
+	device := haDevice{
+		Identifiers:  []string{nodeId},
+		Name:         "F2Pool " + snapshot.Currency + " " + snapshot.Account,
+		Manufacturer: "F2Pool",
+		Model:        snapshot.Currency,
+	}
+
+	configs := map[string]string{}
+	add := func(component string, objectId string, entity haEntity) {
+		entity.UniqueId = nodeId + "_" + objectId
+		entity.Device = device
+		payload, _ := json.Marshal(entity)
+		configs[discoveryPrefix+"/"+component+"/"+nodeId+"/"+objectId+"/config"] = string(payload)
+	}
+
+	unit := snapshot.HashrateUnit
+	if len(unit) == 0 {
+		unit = "H/s"
+	}
+
+	add("sensor", "balance", haEntity{Name: "Balance", StateTopic: base + "/balance", UnitOfMeasurement: snapshot.Currency, StateClass: "measurement"})
+	add("sensor", "paid", haEntity{Name: "Paid", StateTopic: base + "/paid", UnitOfMeasurement: snapshot.Currency, StateClass: "total_increasing"})
+	add("sensor", "value_last_day", haEntity{Name: "Revenue last 24h", StateTopic: base + "/value_last_day", UnitOfMeasurement: snapshot.Currency, StateClass: "measurement"})
+	add("sensor", "hashrate", haEntity{Name: "Hashrate", StateTopic: base + "/hashrate", UnitOfMeasurement: unit, StateClass: "measurement"})
+	add("sensor", "workers_count", haEntity{Name: "Workers", StateTopic: base + "/workers_count", StateClass: "measurement"})
+
+	for _, worker := range snapshot.Workers {
+		topic := mqttWorkerTopic(base, worker.Name)
+		workerId := haId("worker", worker.Name)
+		add("sensor", workerId+"_hashrate", haEntity{Name: worker.Name + " hashrate", StateTopic: topic + "/hashrate", UnitOfMeasurement: unit, StateClass: "measurement"})
+		add("binary_sensor", workerId+"_online", haEntity{Name: worker.Name + " online", StateTopic: topic + "/online", DeviceClass: "connectivity", PayloadOn: "ON", PayloadOff: "OFF"})
+	}
+	return configs
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Active/standby mode for Kubernetes deployments: replicas elect a leader with a Lease object of the
+// coordination.k8s.io API, only the leader retrieves the data from the F2Pool API, standbys serve the
+// metrics of their last collection and take over when the lease of the leader expires
+// See: https://kubernetes.io/docs/concepts/architecture/leases/
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Time format of the Lease MicroTime fields
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+type leaseSpec struct {
+	HolderIdentity       *string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *string `json:"acquireTime,omitempty"`
+	RenewTime            *string `json:"renewTime,omitempty"`
+	LeaseTransitions     *int    `json:"leaseTransitions,omitempty"`
+}
+
+type lease struct {
+	ApiVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Spec       leaseSpec              `json:"spec"`
+}
+
+type LeaderElector struct {
+	client    *http.Client
+	apiServer string
+	token     string
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+
+	mutex  sync.RWMutex
+	leader bool
+}
+
+// NewLeaderElector configures the election with the in-cluster service account of the pod
+func NewLeaderElector(namespace string, name string, identity string, duration time.Duration) (*LeaderElector, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, errors.New("not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set)")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate found in the service account CA")
+	}
+	if len(namespace) == 0 {
+		data, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	if len(identity) == 0 {
+		if identity, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LeaderElector{
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+		apiServer: "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+		duration:  duration,
+	}, nil
+}
+
+func (l *LeaderElector) IsLeader() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.leader
+}
+
+// Run tries to acquire or renew the lease every third of its duration, it never returns
+func (l *LeaderElector) Run() {
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		leader, err := l.tryAcquireOrRenew(time.Now())
+		if err != nil {
+			log.Println("Error updating lease", l.namespace+"/"+l.name, ":", err)
+		}
+
+		l.mutex.Lock()
+		if leader != l.leader {
+			if leader {
+				log.Println("Leading as", l.identity, "with lease", l.namespace+"/"+l.name)
+			} else {
+				log.Println("Standing by, lease", l.namespace+"/"+l.name, "is not held anymore")
+			}
+		}
+		l.leader = leader
+		l.mutex.Unlock()
+
+		<-ticker.C
+	}
+}
+
+func (l *LeaderElector) tryAcquireOrRenew(now time.Time) (bool, error) {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.namespace)
+	current := &lease{}
+	status, err := l.call("GET", path+"/"+l.name, nil, current)
+	if err != nil {
+		return false, err
+	}
+
+	seconds := int(l.duration / time.Second)
+	renewTime := now.UTC().Format(leaseTimeFormat)
+	if status == http.StatusNotFound {
+		transitions := 0
+		created := &lease{
+			ApiVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   map[string]interface{}{"name": l.name, "namespace": l.namespace},
+			Spec: leaseSpec{HolderIdentity: &l.identity, LeaseDurationSeconds: &seconds,
+				AcquireTime: &renewTime, RenewTime: &renewTime, LeaseTransitions: &transitions},
+		}
+		status, err := l.call("POST", path, created, nil)
+		if err != nil {
+			return false, err
+		}
+		// Another replica created it first
+		return status == http.StatusCreated, nil
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d", status)
+	}
+
+	spec := &current.Spec
+	holder := ""
+	if spec.HolderIdentity != nil {
+		holder = *spec.HolderIdentity
+	}
+	if holder != l.identity && len(holder) != 0 && !leaseExpired(spec, now) {
+		return false, nil
+	}
+
+	if holder != l.identity {
+		transitions := 1
+		if spec.LeaseTransitions != nil {
+			transitions = *spec.LeaseTransitions + 1
+		}
+		spec.HolderIdentity = &l.identity
+		spec.AcquireTime = &renewTime
+		spec.LeaseTransitions = &transitions
+	}
+	spec.LeaseDurationSeconds = &seconds
+	spec.RenewTime = &renewTime
+
+	// The resource version of the retrieved lease makes the update fail if it was modified since
+	status, err = l.call("PUT", path+"/"+l.name, current, nil)
+	if err != nil {
+		return false, err
+	}
+	return status == http.StatusOK, nil
+}
+
+func leaseExpired(spec *leaseSpec, now time.Time) bool {
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	renewed, err := time.Parse(time.RFC3339Nano, *spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second))
+}
+
+// Calls the API server, returning the status; conflicts and missing objects are not errors
+func (l *LeaderElector) call(method string, path string, request interface{}, result interface{}) (int, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, l.apiServer+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		if result != nil {
+			return resp.StatusCode, json.Unmarshal(data, result)
+		}
+		return resp.StatusCode, nil
+	case http.StatusNotFound, http.StatusConflict:
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake Kubernetes API server holding one Lease, updates are rejected if its resource version changed
+type fakeKubernetes struct {
+	mutex   sync.Mutex
+	lease   *lease
+	version int
+}
+
+func (k *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if r.Header.Get("Authorization") != "Bearer sa-token" {
+		http.Error(w, `{"reason": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	const path = "/apis/coordination.k8s.io/v1/namespaces/mining/leases"
+	switch {
+	case r.Method == "GET" && r.URL.Path == path+"/f2pool-exporter":
+		if k.lease == nil {
+			http.Error(w, `{"reason": "NotFound"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(k.lease)
+	case r.Method == "POST" && r.URL.Path == path, r.Method == "PUT" && r.URL.Path == path+"/f2pool-exporter":
+		update := &lease{}
+		json.NewDecoder(r.Body).Decode(update)
+		if r.Method == "POST" && k.lease != nil {
+			http.Error(w, `{"reason": "AlreadyExists"}`, http.StatusConflict)
+			return
+		}
+		if r.Method == "PUT" && update.Metadata["resourceVersion"] != fmt.Sprint(k.version) {
+			http.Error(w, `{"reason": "Conflict"}`, http.StatusConflict)
+			return
+		}
+		k.version++
+		update.Metadata["resourceVersion"] = fmt.Sprint(k.version)
+		k.lease = update
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(k.lease)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (k *fakeKubernetes) holder() (string, int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return *k.lease.Spec.HolderIdentity, *k.lease.Spec.LeaseTransitions
+}
+
+func TestLeaderElectorTryAcquireOrRenew(t *testing.T) {
+	kubernetes := &fakeKubernetes{}
+	server := httptest.NewServer(kubernetes)
+	defer server.Close()
+	elector := func(identity string) *LeaderElector {
+		return &LeaderElector{client: server.Client(), apiServer: server.URL, token: "sa-token", namespace: "mining",
+			name: "f2pool-exporter", identity: identity, duration: 15 * time.Second}
+	}
+	a, b := elector("a"), elector("b")
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	steps := []struct {
+		name        string
+		elector     *LeaderElector
+		at          time.Duration
+		want        bool
+		holder      string
+		transitions int
+	}{
+		{"created", a, 0, true, "a", 0},
+		{"held by another replica", b, time.Second, false, "a", 0},
+		{"renewed", a, 5 * time.Second, true, "a", 0},
+		{"not yet expired", b, 20 * time.Second, false, "a", 0},
+		{"taken over once expired", b, 21 * time.Second, true, "b", 1},
+		{"lost", a, 22 * time.Second, false, "b", 1},
+	}
+	for _, step := range steps {
+		leader, err := step.elector.tryAcquireOrRenew(start.Add(step.at))
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		holder, transitions := kubernetes.holder()
+		if leader != step.want || holder != step.holder || transitions != step.transitions {
+			t.Errorf("%s: leader = %v, holder %s, %d transitions, want %v, %s, %d",
+				step.name, leader, holder, transitions, step.want, step.holder, step.transitions)
+		}
+	}
+}
+
+func TestLeaderElectorConflict(t *testing.T) {
+	kubernetes := &fakeKubernetes{}
+	// The lease is updated by another replica between the retrieval and the update
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			kubernetes.mutex.Lock()
+			kubernetes.version++
+			kubernetes.mutex.Unlock()
+		}
+		kubernetes.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	elector := &LeaderElector{client: server.Client(), apiServer: server.URL, token: "sa-token", namespace: "mining",
+		name: "f2pool-exporter", identity: "a", duration: 15 * time.Second}
+
+	now := time.Now()
+	if leader, err := elector.tryAcquireOrRenew(now); err != nil || !leader {
+		t.Fatalf("tryAcquireOrRenew = %v, %v, want the lease created", leader, err)
+	}
+	if leader, err := elector.tryAcquireOrRenew(now.Add(time.Second)); err != nil || leader {
+		t.Errorf("tryAcquireOrRenew on a conflict = %v, %v, want false without error", leader, err)
+	}
+}
+
+func TestLeaderElectorUnauthorized(t *testing.T) {
+	server := httptest.NewServer(&fakeKubernetes{})
+	defer server.Close()
+	elector := &LeaderElector{client: server.Client(), apiServer: server.URL, token: "expired", namespace: "mining",
+		name: "f2pool-exporter", identity: "a", duration: 15 * time.Second}
+
+	if _, err := elector.tryAcquireOrRenew(time.Now()); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("tryAcquireOrRenew error = %v, want the Unauthorized status", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Limit of the concurrent scrapes: scrapes over --web-max-requests are answered with the 503 status
+// right away, instead of each running a collection (and its F2Pool API calls) at the same time
+
+var scrapesRejected int64
+
+// LimitRequests serves at most max requests at the same time, no limit if max is 0
+func LimitRequests(handler http.Handler, max int) http.Handler {
+	if max <= 0 {
+		return handler
+	}
+	slots := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			handler.ServeHTTP(w, r)
+		default:
+			atomic.AddInt64(&scrapesRejected, 1)
+			http.Error(w, "Too many concurrent scrapes, limit is --web-max-requests", http.StatusServiceUnavailable)
+		}
+	})
+}
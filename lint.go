@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+	"github.com/prometheus/common/model"
+)
+
+// Lint of the exported metrics: one collection checked like promtool check metrics does (naming
+// conventions), with the duplicate series and invalid names or labels, which configuration
+// (metric_names, relabel, const labels...) could introduce. Run at startup with --startup-lint,
+// or by the check command
+
+// LintMetrics gathers the metrics and returns the problems found
+func LintMetrics(gatherer prometheus.Gatherer) []string {
+	problems := []string{}
+	families, err := gatherer.Gather()
+	if err != nil {
+		// Duplicate series and inconsistent label sets, the other families are still linted
+		if errs, ok := err.(prometheus.MultiError); ok {
+			for _, err := range errs {
+				problems = append(problems, err.Error())
+			}
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	lintProblems, err := promlint.NewWithMetricFamilies(families).Lint()
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, problem := range lintProblems {
+		problems = append(problems, fmt.Sprintf("%s: %s", problem.Metric, problem.Text))
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			problems = append(problems, fmt.Sprintf("%s: invalid metric name", name))
+		}
+		invalid := map[string]bool{}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if !model.LabelName(label.GetName()).IsValid() {
+					invalid[fmt.Sprintf("invalid label name %q", label.GetName())] = true
+				}
+				if !utf8.ValidString(label.GetValue()) {
+					invalid[fmt.Sprintf("label %s has an invalid UTF-8 value", label.GetName())] = true
+				}
+			}
+		}
+		for problem := range invalid {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		}
+	}
+	return problems
+}
+
+// RunLint logs the problems of the exported metrics and returns their count
+func RunLint(gatherer prometheus.Gatherer) int {
+	problems := LintMetrics(gatherer)
+	for _, problem := range problems {
+		log.Println("Metrics lint:", problem)
+	}
+	return len(problems)
+}
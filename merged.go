@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Merged mining: the accounts of some currencies also earn merged mined coins (e.g. dogecoin with
+// litecoin), whose balance and revenue are retrieved from the same account and exported with their
+// own currency label. Hashrates are only exported for the primary currency, the merged coins being
+// mined by the same hashes. Merged currencies configured as resources themselves are left out
+
+// Merged mined currencies of each currency
+var mergedMiningCurrencies = map[string][]string{
+	"litecoin": {"dogecoin"},
+}
+
+// MergedCurrenciesFor returns the currencies merged mined with a currency, the configured ones
+// (merged_mining of the configuration file, an empty list disabling them) prevailing over the
+// built-in ones
+func (c *Config) MergedCurrenciesFor(currency string) []string {
+	if currencies, ok := c.MergedMining[currency]; ok {
+		return currencies
+	}
+	return mergedMiningCurrencies[currency]
+}
+
+// Exports the balance and revenue of the merged mined currencies of a resource, skipping the
+// resources already exported
+func (e *F2PoolExporter) collectMerged(ch chan<- prometheus.Metric, span *Span, backend PoolBackend, currency string, user string, exported map[string]bool, rates map[string]map[string]float64) {
+	account := AccountLabel(user)
+	for _, merged := range e.config.MergedCurrenciesFor(currency) {
+		merged = e.config.CanonicalCurrency(merged)
+		resource := merged + "/" + user
+		if exported[resource] {
+			continue
+		}
+		exported[resource] = true
+
+		infos, err := backend.FetchAccount(ResourceClient(e.client, resource, span), merged, user, e.config.TokenFor(merged, user), false)
+		if err != nil {
+			log.Println("Error retrieving", merged, "merged mining of", currency+"/"+user, ":", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(f2pool_balance, prometheus.GaugeValue, infos.Balance, merged, account)
+		ch <- prometheus.MustNewConstMetric(f2pool_paid, prometheus.GaugeValue, infos.Paid, merged, account)
+		ch <- prometheus.MustNewConstMetric(f2pool_value, prometheus.GaugeValue, infos.Value, merged, account)
+		ch <- prometheus.MustNewConstMetric(f2pool_value_last_day, prometheus.GaugeValue, infos.ValueLastDay, merged, account)
+		ch <- prometheus.MustNewConstMetric(f2pool_paid_total, prometheus.CounterValue, e.counters.Observe(resource+"/paid", infos.Paid), merged, account)
+		ch <- prometheus.MustNewConstMetric(f2pool_value_total, prometheus.CounterValue, e.counters.Observe(resource+"/value", infos.Value), merged, account)
+		for fiat, rate := range rates[merged] {
+			ch <- prometheus.MustNewConstMetric(f2pool_balance_fiat, prometheus.GaugeValue, infos.Balance*rate, merged, account, fiat)
+			ch <- prometheus.MustNewConstMetric(f2pool_value_last_day_fiat, prometheus.GaugeValue, infos.ValueLastDay*rate, merged, account, fiat)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Mock F2Pool API (--mock): realistic fake v1 and v2 answers served locally, the collector being
+// pointed at it, to develop and demo dashboards and alerts without real accounts nor API tokens.
+// The data of a resource is stable (seeded by the resource) and varies slowly over time
+
+// Resources retrieved with --mock when none is given
+var mockResources = []string{"bitcoin/demo", "litecoin/demo", "kaspa/demo"}
+
+// Workers of each resource, from 3 to 6 if 0
+var mockWorkersPerResource = 0
+
+// Typical hashrate of a worker, in H/s (Sol/s for Equihash), and its daily revenue
+var mockWorkers = map[string]struct {
+	hashrate float64
+	revenue  float64
+}{
+	"bitcoin":  {110e12, 0.00006},
+	"litecoin": {9.5e9, 0.015},
+	"dogecoin": {9.5e9, 60},
+	"kaspa":    {21e12, 45},
+	"zec":      {140e3, 0.02},
+	"dash":     {1.2e12, 0.002},
+}
+
+// StartMockServer serves the mock API on a local port and returns its base URL
+func StartMockServer() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	// Compressed answers for the clients accepting them
+	mux.Handle("/", CompressHandler(http.HandlerFunc(serveMockV1)))
+	mux.Handle("/v2/", CompressHandler(http.HandlerFunc(serveMockV2)))
+	go http.Serve(listener, mux)
+	return "http://" + listener.Addr().String() + "/", nil
+}
+
+type mockWorker struct {
+	name      string
+	hashrate  float64
+	lastShare time.Time
+}
+
+// Workers of a resource at the given time, the last one is offline
+func mockResourceWorkers(resource string, now time.Time) []mockWorker {
+	hash := fnv.New64a()
+	hash.Write([]byte(resource))
+	random := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	base := mockWorkerHashrate(strings.Split(resource, "/")[0])
+
+	workers := []mockWorker{}
+	count := 3 + random.Intn(4)
+	if mockWorkersPerResource > 0 {
+		count = mockWorkersPerResource
+	}
+	for i := 0; i < count; i++ {
+		worker := mockWorker{name: fmt.Sprintf("rig-%03d", i+1), lastShare: now.Add(-time.Duration(random.Intn(30)) * time.Second)}
+		if i == count-1 {
+			worker.lastShare = now.Add(-2 * time.Hour)
+		} else {
+			// Slow variation (one period every few hours) around the nominal hashrate
+			phase := random.Float64() * 2 * math.Pi
+			worker.hashrate = base * (0.9 + 0.2*random.Float64()) * (1 + 0.05*math.Sin(float64(now.Unix())/3600+phase))
+		}
+		workers = append(workers, worker)
+	}
+	return workers
+}
+
+func mockWorkerHashrate(currency string) float64 {
+	if worker, ok := mockWorkers[currency]; ok {
+		return worker.hashrate
+	}
+	return 1e9
+}
+
+// Revenue of a day at the given hashrate
+func mockRevenue(currency string, hashrate float64) float64 {
+	revenue := 0.01
+	if worker, ok := mockWorkers[currency]; ok {
+		revenue = worker.revenue
+	}
+	return hashrate / mockWorkerHashrate(currency) * revenue
+}
+
+func serveMockV1(w http.ResponseWriter, r *http.Request) {
+	resource := strings.Trim(r.URL.Path, "/")
+	if strings.Count(resource, "/") != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now().UTC()
+	hashrate := 0.0
+	workers := [][]interface{}{}
+	for _, worker := range mockResourceWorkers(resource, now) {
+		hashrate += worker.hashrate
+		lastHour := worker.hashrate * 3600
+		lastDay := worker.hashrate * 86400
+		workers = append(workers, []interface{}{worker.name, worker.hashrate, lastHour, lastHour * 0.002, lastDay, lastDay * 0.002, worker.lastShare.Format(time.RFC3339), worker.hashrate * 1.01})
+	}
+
+	history := map[string]float64{}
+	for i := 0; i < 24; i++ {
+		at := now.Truncate(time.Hour).Add(-time.Duration(i) * time.Hour)
+		total := 0.0
+		for _, worker := range mockResourceWorkers(resource, at) {
+			total += worker.hashrate
+		}
+		history[at.Format(time.RFC3339)] = total
+	}
+
+	valueLastDay := mockRevenue(strings.Split(resource, "/")[0], hashrate)
+	days := float64(now.Unix()-1600000000) / 86400
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"balance":                         math.Mod(valueLastDay*days, valueLastDay*7),
+		"paid":                            valueLastDay * days * 0.9,
+		"value":                           valueLastDay * days,
+		"value_last_day":                  valueLastDay,
+		"hashrate":                        hashrate,
+		"hashes_last_hour":                hashrate * 3600,
+		"hashes_last_day":                 hashrate * 86400,
+		"stale_hashes_rejected_last_hour": hashrate * 3600 * 0.002,
+		"stale_hashes_rejected_last_day":  hashrate * 86400 * 0.002,
+		"hashrate_history":                history,
+		"workers":                         workers,
+	})
+}
+
+func serveMockV2(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Currency  string `json:"currency"`
+		User      string `json:"mining_user_name"`
+		Interval  int64  `json:"interval"`
+		Duration  int64  `json:"duration"`
+		StartTime int64  `json:"start_time"`
+		EndTime   int64  `json:"end_time"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJson(w, http.StatusOK, map[string]interface{}{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/v2/") {
+	case "mining_user/get":
+		wallets := []map[string]interface{}{}
+		for _, resource := range mockResources {
+			currency := strings.Split(resource, "/")[0]
+			wallets = append(wallets, map[string]interface{}{
+				"currency":       currency,
+				"address":        "mock-" + currency + "-address",
+				"threshold":      0.005,
+				"payment_method": "pps+",
+			})
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"mining_user": map[string]interface{}{"mining_user_name": payload.User, "wallets": wallets}})
+	case "hash_rate/history":
+		if payload.Interval <= 0 {
+			payload.Interval = 3600
+		}
+		now := time.Now()
+		points := []map[string]interface{}{}
+		for at := now.Unix() - payload.Duration; at <= now.Unix(); at += payload.Interval {
+			total := 0.0
+			for _, worker := range mockResourceWorkers(payload.Currency+"/"+payload.User, time.Unix(at, 0)) {
+				total += worker.hashrate
+			}
+			points = append(points, map[string]interface{}{"timestamp": at, "hash_rate": total, "stale_hash_rate": total * 0.002})
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"hash_rate_list": points})
+	case "assets/transactions/list":
+		transactions := []map[string]interface{}{}
+		for at := payload.StartTime - payload.StartTime%86400 + 86400; at <= payload.EndTime; at += 86400 {
+			total := 0.0
+			for _, worker := range mockResourceWorkers(payload.Currency+"/"+payload.User, time.Unix(at, 0)) {
+				total += worker.hashrate
+			}
+			transactions = append(transactions, map[string]interface{}{"id": at, "type": "revenue", "changed_balance": mockRevenue(payload.Currency, total), "created_at": at})
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"transactions": transactions})
+	case "assets/balance":
+		total := 0.0
+		for _, worker := range mockResourceWorkers(payload.Currency+"/"+payload.User, time.Now()) {
+			total += worker.hashrate
+		}
+		valueLastDay := mockRevenue(payload.Currency, total)
+		days := float64(time.Now().Unix()-1600000000) / 86400
+		writeJson(w, http.StatusOK, map[string]interface{}{"balance_info": map[string]interface{}{
+			"balance":                math.Mod(valueLastDay*days, valueLastDay*7),
+			"immature_balance":       valueLastDay * 0.1,
+			"paid":                   valueLastDay * days * 0.9,
+			"total_income":           valueLastDay * days,
+			"yesterday_income":       valueLastDay,
+			"estimated_today_income": valueLastDay,
+		}})
+	case "hash_rate/info":
+		total := 0.0
+		for _, worker := range mockResourceWorkers(payload.Currency+"/"+payload.User, time.Now()) {
+			total += worker.hashrate
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"info": mockV2HashRateInfo(payload.User, total)})
+	case "hash_rate/worker/list":
+		workers := []map[string]interface{}{}
+		for _, worker := range mockResourceWorkers(payload.Currency+"/"+payload.User, time.Now()) {
+			workers = append(workers, map[string]interface{}{
+				"hash_rate_info": mockV2HashRateInfo(worker.name, worker.hashrate),
+				"last_share_at":  worker.lastShare.Unix(),
+				"status":         0,
+				"host":           "",
+			})
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"workers": workers})
+	default:
+		writeJson(w, http.StatusOK, map[string]interface{}{"code": 404, "msg": "unknown endpoint"})
+	}
+}
+
+func mockV2HashRateInfo(name string, hashrate float64) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                name,
+		"hash_rate":           hashrate,
+		"h1_hash_rate":        hashrate,
+		"h24_hash_rate":       hashrate,
+		"h1_stale_hash_rate":  hashrate * 0.002,
+		"h24_stale_hash_rate": hashrate * 0.002,
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MQTT publishing of the collected data (MQTT 3.1.1, QoS 0), for home automation
+// Topics: {prefix}/{currency}/{account}/{field} and {prefix}/{currency}/{account}/workers/{worker}/{field}
+// See: http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html
+
+type MqttOptions struct {
+	// Broker URL, tcp://host:1883 or ssl://host:8883 (tls:// and mqtts:// are accepted)
+	Broker      string
+	ClientId    string
+	Username    string
+	Password    string
+	CaFile      string
+	InsecureTls bool
+	Retain      bool
+	TopicPrefix string
+	// Home Assistant discovery prefix, discovery is disabled if empty
+	DiscoveryPrefix string
+}
+
+type MqttClient struct {
+	conn   net.Conn
+	writer *bufio.Writer
+}
+
+func DialMqtt(options *MqttOptions) (*MqttClient, error) {
+	broker, err := url.Parse(options.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", defaultPort(broker.Host, "1883"))
+	case "ssl", "tls", "mqtts":
+		config := &tls.Config{InsecureSkipVerify: options.InsecureTls, ServerName: broker.Hostname()}
+		if len(options.CaFile) != 0 {
+			pem, err := ioutil.ReadFile(options.CaFile)
+			if err != nil {
+				return nil, err
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in %s", options.CaFile)
+			}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", defaultPort(broker.Host, "8883"), config)
+	default:
+		return nil, fmt.Errorf("unsupported MQTT broker scheme %q", broker.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &MqttClient{conn: conn, writer: bufio.NewWriter(conn)}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := client.connect(options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func defaultPort(host string, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (c *MqttClient) connect(options *MqttOptions) error {
+	flags := byte(0x02) // Clean session
+	payload := mqttString(options.ClientId)
+	if len(options.Username) != 0 {
+		flags |= 0x80
+		payload = append(payload, mqttString(options.Username)...)
+		if password := Secret(options.Password); len(password) != 0 {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+
+	// Protocol name, level 4 (3.1.1), flags and keep alive (60 seconds)
+	packet := append(mqttString("MQTT"), 4, flags, 0, 60)
+	if err := c.write(0x10, append(packet, payload...)); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, connack); err != nil {
+		return err
+	}
+	if connack[0] != 0x20 {
+		return errors.New("unexpected MQTT packet instead of CONNACK")
+	}
+	if connack[3] != 0 {
+		return fmt.Errorf("MQTT connection refused (return code %d)", connack[3])
+	}
+	return nil
+}
+
+func (c *MqttClient) Publish(topic string, payload string, retain bool) error {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	return c.write(header, append(mqttString(topic), payload...))
+}
+
+func (c *MqttClient) Close() error {
+	c.write(0xE0, nil)
+	return c.conn.Close()
+}
+
+// Writes a packet: fixed header byte, remaining length and content
+func (c *MqttClient) write(header byte, content []byte) error {
+	packet := []byte{header}
+	length := len(content)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	c.writer.Write(packet)
+	c.writer.Write(content)
+	return c.writer.Flush()
+}
+
+func mqttString(value string) []byte {
+	return append([]byte{byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+// MqttPublisher publishes the data of every resource after each collection
+
+type MqttPublisher struct {
+	exporter *F2PoolExporter
+	options  *MqttOptions
+}
+
+func NewMqttPublisher(exporter *F2PoolExporter, options *MqttOptions) *MqttPublisher {
+	return &MqttPublisher{exporter: exporter, options: options}
+}
+
+// Run collects and publishes every interval, it never returns
+func (p *MqttPublisher) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.exporter.Refresh()
+		if err := p.Publish(); err != nil {
+			log.Println("Error publishing to MQTT broker:", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (p *MqttPublisher) Publish() error {
+	client, err := DialMqtt(p.options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, snapshot := range p.exporter.snapshots.All() {
+		if len(p.options.DiscoveryPrefix) != 0 {
+			// Discovery configs are always retained, for entities to survive Home Assistant restarts
+			for topic, payload := range haDiscoveryConfigs(p.options.DiscoveryPrefix, p.options.TopicPrefix, snapshot) {
+				if err := client.Publish(topic, payload, true); err != nil {
+					return err
+				}
+			}
+		}
+		for topic, payload := range mqttAccountValues(p.options.TopicPrefix, snapshot) {
+			if err := client.Publish(topic, payload, p.options.Retain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Topic to published values of a resource
+func mqttAccountValues(prefix string, snapshot *AccountSnapshot) map[string]string {
+	base := mqttAccountTopic(prefix, snapshot)
+	values := map[string]string{
+		base + "/balance":        formatMqttFloat(snapshot.Balance),
+		base + "/paid":           formatMqttFloat(snapshot.Paid),
+		base + "/value":          formatMqttFloat(snapshot.Value),
+		base + "/value_last_day": formatMqttFloat(snapshot.ValueLastDay),
+		base + "/hashrate":       formatMqttFloat(snapshot.Hashrate),
+		base + "/workers_count":  strconv.Itoa(snapshot.WorkersCount),
+	}
+	for _, worker := range snapshot.Workers {
+		topic := mqttWorkerTopic(base, worker.Name)
+		values[topic+"/hashrate"] = formatMqttFloat(worker.Hashrate)
+		values[topic+"/online"] = mqttOnline(worker)
+		if worker.LastShareAt != nil {
+			values[topic+"/last_share_at"] = worker.LastShareAt.Format(time.RFC3339)
+		}
+	}
+	return values
+}
+
+func mqttAccountTopic(prefix string, snapshot *AccountSnapshot) string {
+	return prefix + "/" + mqttTopicLevel(snapshot.Currency) + "/" + mqttTopicLevel(snapshot.Account)
+}
+
+func mqttWorkerTopic(base string, worker string) string {
+	return base + "/workers/" + mqttTopicLevel(worker)
+}
+
+// A worker is online while it has a hashrate
+func mqttOnline(worker WorkerSnapshot) string {
+	if worker.Hashrate > 0 {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// Replaces the characters which are topic separators or wildcards
+func mqttTopicLevel(value string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+}
+
+func formatMqttFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mqttPacket struct {
+	header  byte
+	content []byte
+}
+
+func readMqttPacket(r *bufio.Reader) (*mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return &mqttPacket{header, content}, nil
+}
+
+func readMqttString(content []byte) (string, []byte) {
+	length := int(binary.BigEndian.Uint16(content))
+	return string(content[2 : 2+length]), content[2+length:]
+}
+
+// Session of a client with the fake broker
+type mqttSession struct {
+	clientId string
+	username string
+	password string
+	// Payloads by topic, retained ones are prefixed with "retain "
+	messages map[string]string
+}
+
+// Fake MQTT broker answering the connections with the return code, the sessions are sent
+// once the client disconnected
+func startMqttBroker(t *testing.T, code byte) (string, <-chan *mqttSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	sessions := make(chan *mqttSession, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			session := &mqttSession{messages: map[string]string{}}
+			r := bufio.NewReader(conn)
+			for {
+				packet, err := readMqttPacket(r)
+				if err != nil {
+					break
+				}
+				switch packet.header >> 4 {
+				case 1: // CONNECT
+					content := packet.content
+					_, content = readMqttString(content)
+					flags := content[1]
+					content = content[4:]
+					session.clientId, content = readMqttString(content)
+					if flags&0x80 != 0 {
+						session.username, content = readMqttString(content)
+					}
+					if flags&0x40 != 0 {
+						session.password, _ = readMqttString(content)
+					}
+					conn.Write([]byte{0x20, 2, 0, code})
+				case 3: // PUBLISH
+					topic, payload := readMqttString(packet.content)
+					if packet.header&0x01 != 0 {
+						session.messages[topic] = "retain " + string(payload)
+					} else {
+						session.messages[topic] = string(payload)
+					}
+				}
+				if packet.header>>4 == 14 { // DISCONNECT
+					break
+				}
+			}
+			conn.Close()
+			sessions <- session
+		}
+	}()
+	return "tcp://" + listener.Addr().String(), sessions
+}
+
+func TestMqttPublisherPublish(t *testing.T) {
+	broker, sessions := startMqttBroker(t, 0)
+	lastShare := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	exporter := &F2PoolExporter{snapshots: NewSnapshotStore()}
+	exporter.snapshots.Set("bitcoin/test", &AccountSnapshot{
+		Currency: "bitcoin", Account: "test", Balance: 0.5, Paid: 1.25, Hashrate: 100, WorkersCount: 2,
+		Workers: []WorkerSnapshot{{Name: "rig/1", Hashrate: 100, LastShareAt: &lastShare}, {Name: "rig-2"}},
+	})
+	publisher := NewMqttPublisher(exporter, &MqttOptions{
+		Broker: broker, ClientId: "f2pool-exporter", Username: "user", Password: "secret", Retain: true, TopicPrefix: "f2pool",
+	})
+	if err := publisher.Publish(); err != nil {
+		t.Fatal(err)
+	}
+
+	session := <-sessions
+	if session.clientId != "f2pool-exporter" || session.username != "user" || session.password != "secret" {
+		t.Errorf("session = %+v, want the client ID and credentials", session)
+	}
+	want := map[string]string{
+		"f2pool/bitcoin/test/balance":                     "retain 0.5",
+		"f2pool/bitcoin/test/paid":                        "retain 1.25",
+		"f2pool/bitcoin/test/value":                       "retain 0",
+		"f2pool/bitcoin/test/value_last_day":              "retain 0",
+		"f2pool/bitcoin/test/hashrate":                    "retain 100",
+		"f2pool/bitcoin/test/workers_count":               "retain 2",
+		"f2pool/bitcoin/test/workers/rig_1/hashrate":      "retain 100",
+		"f2pool/bitcoin/test/workers/rig_1/online":        "retain ON",
+		"f2pool/bitcoin/test/workers/rig_1/last_share_at": "retain 2024-01-02T03:04:05Z",
+		"f2pool/bitcoin/test/workers/rig-2/hashrate":      "retain 0",
+		"f2pool/bitcoin/test/workers/rig-2/online":        "retain OFF",
+	}
+	if !reflect.DeepEqual(session.messages, want) {
+		t.Errorf("messages = %v, want %v", session.messages, want)
+	}
+}
+
+func TestDialMqttRefused(t *testing.T) {
+	broker, _ := startMqttBroker(t, 5)
+	_, err := DialMqtt(&MqttOptions{Broker: broker, ClientId: "f2pool-exporter"})
+	if err == nil || !strings.Contains(err.Error(), "return code 5") {
+		t.Errorf("DialMqtt error = %v, want the refused connection", err)
+	}
+}
+
+func TestDialMqttUnsupportedScheme(t *testing.T) {
+	if _, err := DialMqtt(&MqttOptions{Broker: "ws://localhost:8080"}); err == nil {
+		t.Error("DialMqtt with a ws:// broker = nil error, want an error")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Network statistics (difficulty, block subsidy) of the mined currencies, from the Blockchair public API,
+// cached for --network-stats-cache-ttl: the anonymous requests are rate limited, and the scrapes should not
+// wait for a third-party API. The last retrieved statistics are used when a retrieval fails
+// See: https://blockchair.com/api/docs
+
+var blockchairApiUrl = "https://api.blockchair.com/"
+
+type NetworkStats struct {
+	Difficulty  float64
+	Height      int64
+	BlockReward float64
+	// BlockReward is only known for currencies of the subsidy table
+	HasBlockReward bool
+}
+
+// F2Pool currency names to Blockchair chain names
+var blockchairChains = map[string]string{
+	"bitcoin":     "bitcoin",
+	"bitcoincash": "bitcoin-cash",
+	"bitcoinsv":   "bitcoin-sv",
+	"litecoin":    "litecoin",
+	"dogecoin":    "dogecoin",
+	"dash":        "dash",
+	"zec":         "zcash",
+}
+
+// Block subsidy schedules: initial subsidy halved every interval blocks (0 for no halving)
+type subsidySchedule struct {
+	initial  float64
+	interval int64
+}
+
+var subsidySchedules = map[string]subsidySchedule{
+	"bitcoin":     {50, 210000},
+	"bitcoincash": {50, 210000},
+	"bitcoinsv":   {50, 210000},
+	"litecoin":    {50, 840000},
+	"dogecoin":    {10000, 0},
+}
+
+func FetchNetworkStats(client *http.Client, currency string) (*NetworkStats, error) {
+	chain, ok := blockchairChains[currency]
+	if !ok {
+		return nil, fmt.Errorf("no network statistics source for %s", currency)
+	}
+
+	resp, err := client.Get(blockchairApiUrl + chain + "/stats")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("blockchair: unexpected status %s", resp.Status)
+	}
+
+	var stats struct {
+		Data struct {
+			Difficulty      float64 `json:"difficulty"`
+			BestBlockHeight int64   `json:"best_block_height"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+
+	network := &NetworkStats{Difficulty: stats.Data.Difficulty, Height: stats.Data.BestBlockHeight}
+	if schedule, ok := subsidySchedules[currency]; ok {
+		network.BlockReward = schedule.initial
+		if schedule.interval != 0 {
+			network.BlockReward = schedule.initial / math.Pow(2, float64(network.Height/schedule.interval))
+		}
+		network.HasBlockReward = true
+	}
+	return network, nil
+}
+
+// NetworkStatsCache keeps the network statistics of the currencies for a TTL
+type NetworkStatsCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cachedNetworkStats
+}
+
+type cachedNetworkStats struct {
+	stats   *NetworkStats
+	fetched time.Time
+}
+
+func NewNetworkStatsCache(ttl time.Duration) *NetworkStatsCache {
+	return &NetworkStatsCache{ttl: ttl, entries: map[string]cachedNetworkStats{}}
+}
+
+func (c *NetworkStatsCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Stats returns the network statistics of a currency, the error is only set if none were ever retrieved
+func (c *NetworkStatsCache) Stats(client *http.Client, currency string, now time.Time) (*NetworkStats, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[currency]
+	c.mutex.Unlock()
+	fresh := ok && now.Sub(entry.fetched) < c.ttl
+	cacheStats.Lookup("network_stats", fresh)
+	if fresh {
+		return entry.stats, nil
+	}
+
+	stats, err := FetchNetworkStats(client, currency)
+	if err != nil {
+		if ok {
+			log.Println("Error retrieving", currency, "network statistics, using last known ones:", err)
+			return entry.stats, nil
+		}
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.entries[currency] = cachedNetworkStats{stats: stats, fetched: now}
+	c.mutex.Unlock()
+	return stats, nil
+}
+
+// ExpectedDailyReward returns the block subsidy expected in 24 hours at the given hashrate (H/s),
+// difficulty being expressed in multiples of 2^32 hashes as for the currencies of the subsidy table
+func (n *NetworkStats) ExpectedDailyReward(hashrate float64) float64 {
+	return n.ExpectedBlocks(hashrate, 24*time.Hour) * n.BlockReward
+}
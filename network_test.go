@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNetworkStatsCache(t *testing.T) {
+	requests := 0
+	failing := false
+	blockchair := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		if r.URL.Path != "/bitcoin/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"difficulty": 1000, "best_block_height": 840000}}`))
+	}))
+	defer blockchair.Close()
+	setFlag(t, &blockchairApiUrl, blockchair.URL+"/")
+
+	cache := NewNetworkStatsCache(10 * time.Minute)
+	start := time.Now()
+	tests := []struct {
+		name     string
+		at       time.Duration
+		failing  bool
+		requests int
+		height   int64
+		wantErr  bool
+	}{
+		{name: "first", at: 0, requests: 1, height: 840000},
+		{name: "cached", at: time.Minute, requests: 1, height: 840000},
+		{name: "expired", at: 11 * time.Minute, requests: 2, height: 840000},
+		{name: "failing, last known", at: 22 * time.Minute, failing: true, requests: 3, height: 840000},
+	}
+	for _, test := range tests {
+		failing = test.failing
+		stats, err := cache.Stats(blockchair.Client(), "bitcoin", start.Add(test.at))
+		if err != nil {
+			t.Fatalf("%s: Stats error: %v", test.name, err)
+		}
+		if requests != test.requests || stats.Height != test.height {
+			t.Errorf("%s: Stats = %+v after %d requests, want height %d after %d requests", test.name, stats, requests, test.height, test.requests)
+		}
+	}
+	if stats, _ := cache.Stats(blockchair.Client(), "bitcoin", start); stats.BlockReward != 3.125 {
+		t.Errorf("block reward = %v, want 3.125", stats.BlockReward)
+	}
+
+	// Without statistics retrieved before, a failure is an error
+	if _, err := cache.Stats(blockchair.Client(), "litecoin", start); err == nil {
+		t.Error("Stats of a failing currency = nil error, want an error")
+	}
+	if _, err := cache.Stats(blockchair.Client(), "kaspa", start); err == nil {
+		t.Error("Stats of an unsupported currency = nil error, want an error")
+	}
+}
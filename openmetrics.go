@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// OpenMetrics exposition, negotiated with the Accept header. The expfmt encoder is completed
+// with UNIT metadata (from the metric name suffix) and optionally counters created timestamps. The
+// counters whose values survive restarts (counters state file) have no created timestamp: the
+// exporter start would present their restored values as a reset
+
+// Units declared when they are the suffix of a metric family name
+var openMetricsUnits = []string{"seconds", "bytes", "ratio", "hashes", "watts"}
+
+type OpenMetricsHandler struct {
+	gatherer prometheus.Gatherer
+	fallback http.Handler
+	created  bool
+	// Counters are reset with the exporter, they are created when it starts
+	start time.Time
+	// Counter families not reset with the exporter
+	persisted map[string]bool
+}
+
+func NewOpenMetricsHandler(gatherer prometheus.Gatherer, created bool, persisted []string) *OpenMetricsHandler {
+	h := &OpenMetricsHandler{
+		gatherer: gatherer,
+		// Compressed by the web server with --web-compression
+		fallback:  promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{DisableCompression: true}),
+		created:   created,
+		start:     time.Now(),
+		persisted: map[string]bool{},
+	}
+	for _, name := range persisted {
+		h.persisted[name] = true
+	}
+	return h
+}
+
+func (h *OpenMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if expfmt.NegotiateIncludingOpenMetrics(r.Header) != expfmt.FmtOpenMetrics {
+		h.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	families, err := h.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		if err := h.writeFamily(out, family); err != nil {
+			return
+		}
+	}
+	expfmt.FinalizeOpenMetrics(out)
+	out.Flush()
+}
+
+func (h *OpenMetricsHandler) writeFamily(out *bufio.Writer, family *dto.MetricFamily) error {
+	var buf bytes.Buffer
+	if _, err := expfmt.MetricFamilyToOpenMetrics(&buf, family); err != nil {
+		return err
+	}
+
+	name := family.GetName()
+	counter := family.GetType() == dto.MetricType_COUNTER && strings.HasSuffix(name, "_total")
+	shortName := strings.TrimSuffix(name, "_total")
+	if !counter {
+		shortName = name
+	}
+	created := strconv.FormatFloat(float64(h.start.UnixNano())/1e9, 'f', 3, 64)
+
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		out.WriteString(line)
+
+		if strings.HasPrefix(line, "# TYPE ") {
+			for _, unit := range openMetricsUnits {
+				if strings.HasSuffix(shortName, "_"+unit) {
+					out.WriteString("# UNIT " + shortName + " " + unit + "\n")
+					break
+				}
+			}
+		} else if h.created && counter && !h.persisted[name] && strings.HasPrefix(line, name) {
+			out.WriteString(shortName + "_created" + sampleLabels(line[len(name):]) + " " + created + "\n")
+		}
+	}
+	return nil
+}
+
+// Returns the label set (with braces) starting a sample line after its name, empty if none
+func sampleLabels(rest string) string {
+	if !strings.HasPrefix(rest, "{") {
+		return ""
+	}
+	quoted := false
+	for i := 1; i < len(rest); i++ {
+		switch {
+		case quoted && rest[i] == '\\':
+			i++
+		case rest[i] == '"':
+			quoted = !quoted
+		case !quoted && rest[i] == '}':
+			return rest[:i+1]
+		}
+	}
+	return ""
+}
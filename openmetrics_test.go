@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOpenMetricsHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	paid := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "f2pool_paid_total", Help: "Paid"}, []string{"currency"})
+	paid.WithLabelValues("bitcoin").Add(2)
+	bytes := prometheus.NewCounter(prometheus.CounterOpts{Name: "f2pool_api_bytes_total", Help: "Bytes"})
+	idle := prometheus.NewGauge(prometheus.GaugeOpts{Name: "f2pool_worker_idle_seconds", Help: "Idle"})
+	registry.MustRegister(paid, bytes, idle)
+
+	tests := []struct {
+		name      string
+		accept    string
+		created   bool
+		persisted []string
+		contains  []string
+		excludes  []string
+	}{
+		{
+			name:     "text format",
+			accept:   "text/plain",
+			created:  true,
+			contains: []string{`f2pool_paid_total{currency="bitcoin"} 2`},
+			excludes: []string{"_created", "# UNIT", "# EOF"},
+		},
+		{
+			name:     "without created timestamps",
+			accept:   "application/openmetrics-text",
+			contains: []string{"# UNIT f2pool_worker_idle_seconds seconds", "# UNIT f2pool_api_bytes bytes", "# EOF"},
+			excludes: []string{"_created"},
+		},
+		{
+			name:     "created timestamps",
+			accept:   "application/openmetrics-text",
+			created:  true,
+			contains: []string{`f2pool_paid_created{currency="bitcoin"} `, "f2pool_api_bytes_created "},
+			excludes: []string{"f2pool_worker_idle_created"},
+		},
+		{
+			name:      "persisted counters",
+			accept:    "application/openmetrics-text",
+			created:   true,
+			persisted: []string{"f2pool_paid_total"},
+			contains:  []string{`f2pool_paid_total{currency="bitcoin"} 2`, "f2pool_api_bytes_created "},
+			excludes:  []string{"f2pool_paid_created"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.Header.Set("Accept", test.accept)
+			w := httptest.NewRecorder()
+			NewOpenMetricsHandler(registry, test.created, test.persisted).ServeHTTP(w, r)
+			for _, value := range test.contains {
+				if !strings.Contains(w.Body.String(), value) {
+					t.Errorf("exposition does not contain %q:\n%s", value, w.Body.String())
+				}
+			}
+			for _, value := range test.excludes {
+				if strings.Contains(w.Body.String(), value) {
+					t.Errorf("exposition contains %q:\n%s", value, w.Body.String())
+				}
+			}
+		})
+	}
+}
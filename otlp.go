@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OTLP/HTTP metrics sink, using the JSON encoding of the OTLP protocol
+// See: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+
+type OtlpSink struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	// Cumulative sums are reported since the exporter start
+	start time.Time
+}
+
+func NewOtlpSink(client *http.Client, endpoint string, headers map[string]string) *OtlpSink {
+	return &OtlpSink{client: client, endpoint: endpoint, headers: headers, start: time.Now()}
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+	// Histogram and summary fields
+	Count          string         `json:"count,omitempty"`
+	Sum            *float64       `json:"sum,omitempty"`
+	BucketCounts   []string       `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64      `json:"explicitBounds,omitempty"`
+	QuantileValues []otlpQuantile `json:"quantileValues,omitempty"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpPoints struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality,omitempty"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Gauge       *otlpPoints `json:"gauge,omitempty"`
+	Sum         *otlpPoints `json:"sum,omitempty"`
+	Histogram   *otlpPoints `json:"histogram,omitempty"`
+	Summary     *otlpPoints `json:"summary,omitempty"`
+}
+
+// Cumulative aggregation temporality
+const otlpCumulative = 2
+
+func (s *OtlpSink) Push(families []*dto.MetricFamily) error {
+	now := time.Now()
+	metrics := make([]otlpMetric, 0, len(families))
+	for _, family := range families {
+		metrics = append(metrics, s.convert(family, now))
+	}
+
+	serviceName := otlpKeyValue{Key: "service.name"}
+	serviceName.Value.StringValue = "f2pool-exporter"
+	request := map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": []otlpKeyValue{serviceName}},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]string{"name": "f2pool-exporter", "version": version},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (s *OtlpSink) convert(family *dto.MetricFamily, now time.Time) otlpMetric {
+	metric := otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+	points := &otlpPoints{}
+	start := strconv.FormatInt(s.start.UnixNano(), 10)
+
+	for _, m := range family.GetMetric() {
+		point := otlpDataPoint{
+			Attributes:   otlpAttributes(m),
+			TimeUnixNano: strconv.FormatInt(metricTime(m, now).UnixNano(), 10),
+		}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			value := m.GetCounter().GetValue()
+			point.AsDouble = &value
+			point.StartTimeUnixNano = start
+		case dto.MetricType_GAUGE:
+			value := m.GetGauge().GetValue()
+			point.AsDouble = &value
+		case dto.MetricType_UNTYPED:
+			value := m.GetUntyped().GetValue()
+			point.AsDouble = &value
+		case dto.MetricType_HISTOGRAM:
+			histogram := m.GetHistogram()
+			sum := histogram.GetSampleSum()
+			point.StartTimeUnixNano = start
+			point.Count = strconv.FormatUint(histogram.GetSampleCount(), 10)
+			point.Sum = &sum
+			// Prometheus buckets are cumulative, OTLP ones are not
+			previous := uint64(0)
+			for _, bucket := range histogram.GetBucket() {
+				point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+				point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(bucket.GetCumulativeCount()-previous, 10))
+				previous = bucket.GetCumulativeCount()
+			}
+			point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(histogram.GetSampleCount()-previous, 10))
+		case dto.MetricType_SUMMARY:
+			summary := m.GetSummary()
+			sum := summary.GetSampleSum()
+			point.StartTimeUnixNano = start
+			point.Count = strconv.FormatUint(summary.GetSampleCount(), 10)
+			point.Sum = &sum
+			for _, quantile := range summary.GetQuantile() {
+				point.QuantileValues = append(point.QuantileValues, otlpQuantile{quantile.GetQuantile(), quantile.GetValue()})
+			}
+		}
+		points.DataPoints = append(points.DataPoints, point)
+	}
+
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		points.AggregationTemporality = otlpCumulative
+		points.IsMonotonic = true
+		metric.Sum = points
+	case dto.MetricType_HISTOGRAM:
+		points.AggregationTemporality = otlpCumulative
+		metric.Histogram = points
+	case dto.MetricType_SUMMARY:
+		metric.Summary = points
+	default:
+		metric.Gauge = points
+	}
+	return metric
+}
+
+func otlpAttributes(m *dto.Metric) []otlpKeyValue {
+	labels := metricLabels(m)
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := make([]otlpKeyValue, 0, len(names))
+	for _, name := range names {
+		attribute := otlpKeyValue{Key: name}
+		attribute.Value.StringValue = labels[name]
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+// ParseHeaders parses a list of name=value separated by commas
+func ParseHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, header := range strings.Split(value, ",") {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOtlpSinkPush(t *testing.T) {
+	type point struct {
+		Attributes []struct {
+			Key   string `json:"key"`
+			Value struct {
+				StringValue string `json:"stringValue"`
+			} `json:"value"`
+		} `json:"attributes"`
+		AsDouble     *float64 `json:"asDouble"`
+		Count        string   `json:"count"`
+		BucketCounts []string `json:"bucketCounts"`
+	}
+	type points struct {
+		DataPoints             []point `json:"dataPoints"`
+		AggregationTemporality int     `json:"aggregationTemporality"`
+		IsMonotonic            bool    `json:"isMonotonic"`
+	}
+	var request struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name      string  `json:"name"`
+					Gauge     *points `json:"gauge"`
+					Sum       *points `json:"sum"`
+					Histogram *points `json:"histogram"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	var authorization string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer collector.Close()
+
+	sink := NewOtlpSink(collector.Client(), collector.URL, ParseHeaders("Authorization = Bearer token, invalid"))
+	if err := sink.Push(testFamilies(t)); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer token" {
+		t.Errorf("Authorization header = %q, want %q", authorization, "Bearer token")
+	}
+	if len(request.ResourceMetrics) != 1 || len(request.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("request = %+v, want one resource and scope", request)
+	}
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("metrics = %+v, want 3", metrics)
+	}
+	for _, metric := range metrics {
+		switch metric.Name {
+		case "test_paid_total":
+			if metric.Sum == nil || !metric.Sum.IsMonotonic || metric.Sum.AggregationTemporality != otlpCumulative ||
+				len(metric.Sum.DataPoints) != 1 || *metric.Sum.DataPoints[0].AsDouble != 3 {
+				t.Errorf("counter = %+v, want a cumulative monotonic sum of 3", metric.Sum)
+			}
+		case "test_hashrate":
+			if metric.Gauge == nil || len(metric.Gauge.DataPoints) != 1 || *metric.Gauge.DataPoints[0].AsDouble != 100 {
+				t.Fatalf("gauge = %+v, want a gauge of 100", metric.Gauge)
+			}
+			attributes := map[string]string{}
+			for _, attribute := range metric.Gauge.DataPoints[0].Attributes {
+				attributes[attribute.Key] = attribute.Value.StringValue
+			}
+			if want := map[string]string{"currency": "bitcoin", "worker": "rig 1"}; !reflect.DeepEqual(attributes, want) {
+				t.Errorf("gauge attributes = %v, want %v", attributes, want)
+			}
+		case "test_duration_seconds":
+			// Buckets are not cumulative, the last one is +Inf
+			if metric.Histogram == nil || len(metric.Histogram.DataPoints) != 1 ||
+				metric.Histogram.DataPoints[0].Count != "4" || !reflect.DeepEqual(metric.Histogram.DataPoints[0].BucketCounts, []string{"1", "2", "1"}) {
+				t.Errorf("histogram = %+v, want 4 observations in buckets 1, 2, 1", metric.Histogram)
+			}
+		default:
+			t.Errorf("unexpected metric %s", metric.Name)
+		}
+	}
+}
+
+func TestOtlpSinkPushError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer collector.Close()
+
+	if err := NewOtlpSink(collector.Client(), collector.URL, nil).Push(testFamilies(t)); err == nil {
+		t.Error("Push = nil error, want the status error")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Paused collection: the resources matching a pause rule (e.g. during a known maintenance) are not
+// retrieved, their series (f2pool_up included) and snapshot are dropped so that alerts stay quiet
+// and no API quota is used, f2pool_paused telling them apart. Rules are given in the configuration
+// file or replaced through the admin API
+//   GET, PUT /api/v1/admin/paused (requires the admin token)
+
+const apiAdminPausedPath = "/api/v1/admin/paused"
+
+var f2pool_paused = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "paused"),
+	"Whether the collection of the resource is paused", []string{"currency", "account"}, nil)
+
+// PauseRule pauses the resources of a currency, account and/or backend, omitted ones matching any
+// value
+type PauseRule struct {
+	Currency string `json:"currency,omitempty"`
+	Account  string `json:"account,omitempty"`
+	Backend  string `json:"backend,omitempty"`
+	// Time the collection resumes at, paused until the rule is removed if omitted
+	Until  *time.Time `json:"until,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// SetPaused validates and replaces the pause rules
+func (c *Config) SetPaused(rules []PauseRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if _, ok := poolBackends[rule.Backend]; len(rule.Backend) != 0 && !ok {
+			return fmt.Errorf("pause rule %d has an unknown backend %q", i, rule.Backend)
+		}
+		if len(rule.Currency) != 0 {
+			rule.Currency = c.CanonicalCurrency(rule.Currency)
+		}
+	}
+
+	c.pausedMutex.Lock()
+	defer c.pausedMutex.Unlock()
+	c.Paused = rules
+	return nil
+}
+
+// PausedFor returns the first rule pausing a resource at the given time, nil if it is not paused
+func (c *Config) PausedFor(currency string, user string, now time.Time) *PauseRule {
+	c.pausedMutex.RLock()
+	defer c.pausedMutex.RUnlock()
+	for i := range c.Paused {
+		rule := &c.Paused[i]
+		if (len(rule.Currency) == 0 || rule.Currency == currency) &&
+			(len(rule.Account) == 0 || rule.Account == user) &&
+			(len(rule.Backend) == 0 || rule.Backend == c.BackendNameFor(currency, user)) &&
+			(rule.Until == nil || now.Before(*rule.Until)) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Lists or replaces the pause rules, with the JSON list of the request body
+func (e *F2PoolExporter) servePaused(w http.ResponseWriter, r *http.Request) {
+	if !Authorized(w, r, e.adminToken) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		e.config.pausedMutex.RLock()
+		defer e.config.pausedMutex.RUnlock()
+		rules := e.config.Paused
+		if rules == nil {
+			rules = []PauseRule{}
+		}
+		writeJson(w, http.StatusOK, rules)
+	case http.MethodPut:
+		rules := []PauseRule{}
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := e.config.SetPaused(rules); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Println("Replaced pause rules with", len(rules), "rules from", r.RemoteAddr)
+		writeJson(w, http.StatusOK, map[string]int{"paused": len(rules)})
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
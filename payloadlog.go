@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+)
+
+// Debug logging of the raw F2Pool API payloads which could not be parsed (schema change of a
+// currency...), sampled, size-limited and redacted, to be attached to bug reports
+
+// Numeric fields of the v1 account payloads, required
+var accountPayloadFields = []string{"balance", "paid", "value", "value_last_day", "hashrate", "hashes_last_hour",
+	"hashes_last_day", "stale_hashes_rejected_last_hour", "stale_hashes_rejected_last_day"}
+
+// LogPayload logs the payload of a parsing anomaly, when enabled and sampled
+func LogPayload(source string, payload string, err error) {
+	if !*debugPayloads || rand.Float64() >= *debugPayloadsSampling {
+		return
+	}
+	redactor := logRedactor
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+	truncated := ""
+	if len(payload) > *debugPayloadsMaxBytes {
+		truncated = fmt.Sprintf(" (truncated, %d bytes)", len(payload))
+		payload = payload[:*debugPayloadsMaxBytes]
+	}
+	log.Printf("Debug payload of %s (%v)%s: %s", source, err, truncated, redactor.Redact(payload))
+}
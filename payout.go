@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Payout countdown: the time the balance takes to reach the payout threshold at the revenue of the
+// last 24 hours. The threshold is the one of the wallet on the pool (v2 API, with a token), or the
+// configured one (payout_thresholds of the configuration file, by {currency}/{account} or currency)
+
+var (
+	f2pool_payout_threshold = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "payout_threshold"),
+		"Balance the payouts are made at", []string{"currency", "account"}, nil)
+	f2pool_estimated_seconds_to_payout = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "estimated_seconds_to_payout"),
+		"Estimated time before the balance reaches the payout threshold, at the revenue of the last 24 hours", []string{"currency", "account"}, nil)
+)
+
+// PayoutThresholdFor returns the configured payout threshold of a resource, the one of the resource
+// prevailing over the one of its currency
+func (c *Config) PayoutThresholdFor(currency string, user string) (float64, bool) {
+	if threshold, ok := c.PayoutThresholds[currency+"/"+user]; ok {
+		return threshold, true
+	}
+	threshold, ok := c.PayoutThresholds[currency]
+	return threshold, ok
+}
+
+// SecondsToPayout returns the time before the balance reaches the threshold, false without revenue
+func SecondsToPayout(balance float64, threshold float64, valueLastDay float64) (float64, bool) {
+	if balance >= threshold {
+		return 0, true
+	}
+	if valueLastDay <= 0 {
+		return 0, false
+	}
+	return (threshold - balance) / valueLastDay * 86400, true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pool luck: blocks found by the pool over a window against the blocks expected at its hashrate and
+// the network difficulty, 1 being the expected luck. The blocks found are counted with the miner of
+// the blocks guessed by Blockchair, the pool hashrate (H/s) is the configured one (pool_hashrates of
+// the configuration file), the F2Pool API not exposing it. Expected blocks are computed at the
+// current difficulty, so a difficulty adjustment during the window biases the ratio
+
+// Miner name of the pool blocks on Blockchair
+const blockchairPoolMiner = "F2Pool"
+
+// Windows the luck is computed over, by label
+var poolLuckWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+var (
+	f2pool_pool_blocks_found = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "pool_blocks_found"),
+		"Blocks found by the pool over the window", []string{"currency", "window"}, nil)
+	f2pool_pool_luck_ratio = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "pool_luck_ratio"),
+		"Blocks found by the pool over the blocks expected at its hashrate and the network difficulty, over the window", []string{"currency", "window"}, nil)
+)
+
+func FetchPoolBlocksCount(client *http.Client, currency string, since time.Time) (int64, error) {
+	chain, ok := blockchairChains[currency]
+	if !ok {
+		return 0, fmt.Errorf("no blocks source for %s", currency)
+	}
+
+	query := url.Values{}
+	query.Set("a", "count()")
+	query.Set("q", "guessed_miner("+blockchairPoolMiner+"),time("+since.UTC().Format("2006-01-02 15:04:05")+"..)")
+	resp, err := client.Get(blockchairApiUrl + chain + "/blocks?" + query.Encode())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("blockchair: unexpected status %s", resp.Status)
+	}
+
+	var count struct {
+		Data []struct {
+			Count int64 `json:"count()"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &count); err != nil {
+		return 0, err
+	}
+	if len(count.Data) == 0 {
+		return 0, nil
+	}
+	return count.Data[0].Count, nil
+}
+
+// PoolBlocksCache keeps the blocks counts for a TTL, the counts changing with the blocks only
+type PoolBlocksCache struct {
+	ttl    time.Duration
+	mutex  sync.Mutex
+	counts map[string]cachedPoolBlocks
+}
+
+type cachedPoolBlocks struct {
+	count     int64
+	fetchedAt time.Time
+}
+
+func NewPoolBlocksCache(ttl time.Duration) *PoolBlocksCache {
+	return &PoolBlocksCache{ttl: ttl, counts: map[string]cachedPoolBlocks{}}
+}
+
+func (c *PoolBlocksCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.counts)
+}
+
+// Count returns the blocks found by the pool over a window of a currency
+func (c *PoolBlocksCache) Count(client *http.Client, currency string, window time.Duration, now time.Time) (int64, error) {
+	key := currency + "/" + window.String()
+	c.mutex.Lock()
+	cached, ok := c.counts[key]
+	c.mutex.Unlock()
+	fresh := ok && now.Sub(cached.fetchedAt) < c.ttl
+	cacheStats.Lookup("pool_blocks", fresh)
+	if fresh {
+		return cached.count, nil
+	}
+
+	count, err := FetchPoolBlocksCount(client, currency, now.Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	c.mutex.Lock()
+	c.counts[key] = cachedPoolBlocks{count: count, fetchedAt: now}
+	c.mutex.Unlock()
+	return count, nil
+}
+
+// ExpectedBlocks returns the blocks expected over a duration at the given hashrate (H/s), difficulty
+// being expressed in multiples of 2^32 hashes as for the currencies of the subsidy table
+func (n *NetworkStats) ExpectedBlocks(hashrate float64, duration time.Duration) float64 {
+	if !n.HasBlockReward || n.Difficulty == 0 {
+		return 0
+	}
+	return hashrate * duration.Seconds() / (n.Difficulty * math.Pow(2, 32))
+}
+
+// Exports the blocks found and the luck of the pool for the currencies with a configured hashrate
+func (e *F2PoolExporter) collectPoolLuck(ch chan<- prometheus.Metric, networks map[string]*NetworkStats) {
+	now := time.Now()
+	for currency, network := range networks {
+		hashrate, ok := e.config.PoolHashrates[currency]
+		if network == nil || !ok {
+			continue
+		}
+		for _, window := range poolLuckWindows {
+			count, err := e.poolBlocks.Count(e.external, currency, window.duration, now)
+			if err != nil {
+				log.Println("Error retrieving", currency, "pool blocks:", err)
+				break
+			}
+			ch <- prometheus.MustNewConstMetric(f2pool_pool_blocks_found, prometheus.GaugeValue, float64(count), currency, window.name)
+			if expected := network.ExpectedBlocks(hashrate, window.duration); expected > 0 {
+				ch <- prometheus.MustNewConstMetric(f2pool_pool_luck_ratio, prometheus.GaugeValue, float64(count)/expected, currency, window.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// Electricity consumption of the mining hardware, used for power cost and profitability metrics
+
+type PowerConfig struct {
+	// Electricity price per kWh, in Fiat
+	Price    float64       `json:"price"`
+	Fiat     string        `json:"fiat"`
+	Accounts []PowerDevice `json:"accounts"`
+	Workers  []PowerDevice `json:"workers"`
+}
+
+// PowerDevice is the power draw of an account (worker is empty) or of one of its workers
+type PowerDevice struct {
+	Currency string  `json:"currency"`
+	Account  string  `json:"account"`
+	Worker   string  `json:"worker"`
+	Watts    float64 `json:"watts"`
+}
+
+// Watts returns the power draw of an account: its configured draw if any, else the sum of
+// its hashing workers configured draws
+func (p *PowerConfig) Watts(currency string, account string, hashingWorkers []string) (float64, bool) {
+	for _, device := range p.Accounts {
+		if strings.EqualFold(device.Currency, currency) && device.Account == account {
+			return device.Watts, true
+		}
+	}
+
+	watts := 0.0
+	found := false
+	for _, device := range p.Workers {
+		if !strings.EqualFold(device.Currency, currency) || device.Account != account {
+			continue
+		}
+		for _, worker := range hashingWorkers {
+			if worker == device.Worker {
+				watts += device.Watts
+				found = true
+			}
+		}
+	}
+	return watts, found
+}
+
+// DailyCost returns the electricity cost of 24 hours at the given power draw
+func (p *PowerConfig) DailyCost(watts float64) float64 {
+	return watts / 1000 * 24 * p.Price
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Price subsystem: exchange rates of the mined currencies to a fiat currency
+
+type PriceProvider interface {
+	// Price returns the value of one unit of currency (F2Pool name) in fiat
+	Price(currency string, fiat string) (float64, error)
+}
+
+// PriceSource selects the provider of a currency in the configuration file, rates being
+// the fixed rates by fiat of the "fixed" provider
+type PriceSource struct {
+	Provider string             `json:"provider"`
+	Rates    map[string]float64 `json:"rates"`
+}
+
+func NewPriceProvider(name string, client *http.Client) (PriceProvider, error) {
+	switch name {
+	case "coingecko":
+		return &CoinGeckoProvider{client: client}, nil
+	case "kraken":
+		return &KrakenProvider{client: client}, nil
+	case "binance":
+		return &BinanceProvider{client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown price provider %q", name)
+}
+
+// PriceRouter uses the provider configured for each currency, or the default one
+type PriceRouter struct {
+	fallback  PriceProvider
+	providers map[string]PriceProvider
+}
+
+func NewPriceRouter(name string, sources map[string]PriceSource, client *http.Client) (*PriceRouter, error) {
+	fallback, err := NewPriceProvider(name, client)
+	if err != nil {
+		return nil, err
+	}
+
+	router := &PriceRouter{fallback: fallback, providers: map[string]PriceProvider{}}
+	for currency, source := range sources {
+		if source.Provider == "fixed" {
+			router.providers[currency] = &FixedPriceProvider{rates: source.Rates}
+			continue
+		}
+		provider, err := NewPriceProvider(source.Provider, client)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", currency, err)
+		}
+		router.providers[currency] = provider
+	}
+	return router, nil
+}
+
+func (r *PriceRouter) Price(currency string, fiat string) (float64, error) {
+	if provider, ok := r.providers[currency]; ok {
+		return provider.Price(currency, fiat)
+	}
+	return r.fallback.Price(currency, fiat)
+}
+
+// Ticker symbols of the F2Pool currency names, used by exchanges
+var currencySymbols = map[string]string{
+	"bitcoin":         "BTC",
+	"bitcoincash":     "BCH",
+	"bitcoinsv":       "BSV",
+	"litecoin":        "LTC",
+	"dogecoin":        "DOGE",
+	"ethereum":        "ETH",
+	"ethereumclassic": "ETC",
+	"dash":            "DASH",
+	"zec":             "ZEC",
+	"xmr":             "XMR",
+	"dcr":             "DCR",
+	"conflux":         "CFX",
+	"ravencoin":       "RVN",
+	"kaspa":           "KAS",
+}
+
+func currencySymbol(currency string) string {
+	if symbol, ok := currencySymbols[currency]; ok {
+		return symbol
+	}
+	return strings.ToUpper(currency)
+}
+
+// Fetches an URL and decodes its JSON answer
+func getPriceJson(client *http.Client, provider string, uri string, result interface{}) error {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", provider, resp.Status)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// CoinGecko public API, see: https://www.coingecko.com/en/api/documentation
+
+type CoinGeckoProvider struct {
+	client *http.Client
+}
+
+// F2Pool currency names which are not CoinGecko coin ids
+var coinGeckoIds = map[string]string{
+	"bitcoincash":     "bitcoin-cash",
+	"bitcoinsv":       "bitcoin-cash-sv",
+	"ethereumclassic": "ethereum-classic",
+	"zec":             "zcash",
+	"dcr":             "decred",
+	"xmr":             "monero",
+	"conflux":         "conflux-token",
+}
+
+func (p *CoinGeckoProvider) Price(currency string, fiat string) (float64, error) {
+	id, ok := coinGeckoIds[currency]
+	if !ok {
+		id = currency
+	}
+	fiat = strings.ToLower(fiat)
+
+	uri := "https://api.coingecko.com/api/v3/simple/price?ids=" + url.QueryEscape(id) + "&vs_currencies=" + url.QueryEscape(fiat)
+	var prices map[string]map[string]float64
+	if err := getPriceJson(p.client, "coingecko", uri, &prices); err != nil {
+		return 0, err
+	}
+	price, ok := prices[id][fiat]
+	if !ok {
+		return 0, fmt.Errorf("coingecko: no %s price for %s", fiat, id)
+	}
+	return price, nil
+}
+
+// Kraken public ticker, see: https://docs.kraken.com/rest/#operation/getTickerInformation
+
+type KrakenProvider struct {
+	client *http.Client
+}
+
+// Kraken uses its own symbols for some currencies
+var krakenSymbols = map[string]string{
+	"BTC":  "XBT",
+	"DOGE": "XDG",
+}
+
+func (p *KrakenProvider) Price(currency string, fiat string) (float64, error) {
+	symbol := currencySymbol(currency)
+	if s, ok := krakenSymbols[symbol]; ok {
+		symbol = s
+	}
+	pair := symbol + strings.ToUpper(fiat)
+
+	var ticker struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			// Last trade closed: price, lot volume
+			Close []string `json:"c"`
+		} `json:"result"`
+	}
+	if err := getPriceJson(p.client, "kraken", "https://api.kraken.com/0/public/Ticker?pair="+url.QueryEscape(pair), &ticker); err != nil {
+		return 0, err
+	}
+	if len(ticker.Error) != 0 {
+		return 0, fmt.Errorf("kraken: %s", strings.Join(ticker.Error, ", "))
+	}
+	// The result is keyed by the Kraken pair name, which may differ from the requested one
+	for _, result := range ticker.Result {
+		if len(result.Close) != 0 {
+			return strconv.ParseFloat(result.Close[0], 64)
+		}
+	}
+	return 0, fmt.Errorf("kraken: no price for %s", pair)
+}
+
+// Binance public ticker, see: https://binance-docs.github.io/apidocs/spot/en/#symbol-price-ticker
+
+type BinanceProvider struct {
+	client *http.Client
+}
+
+// Binance does not quote USD, the USDT stable coin is used instead
+var binanceFiats = map[string]string{
+	"USD": "USDT",
+}
+
+func (p *BinanceProvider) Price(currency string, fiat string) (float64, error) {
+	quote := strings.ToUpper(fiat)
+	if q, ok := binanceFiats[quote]; ok {
+		quote = q
+	}
+	symbol := currencySymbol(currency) + quote
+
+	var ticker struct {
+		Symbol string `json:"symbol"`
+		Price  string `json:"price"`
+	}
+	if err := getPriceJson(p.client, "binance", "https://api.binance.com/api/v3/ticker/price?symbol="+url.QueryEscape(symbol), &ticker); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(ticker.Price, 64)
+}
+
+// Fixed rates from the configuration file
+
+type FixedPriceProvider struct {
+	rates map[string]float64
+}
+
+func (p *FixedPriceProvider) Price(currency string, fiat string) (float64, error) {
+	for f, rate := range p.rates {
+		if strings.EqualFold(f, fiat) {
+			return rate, nil
+		}
+	}
+	return 0, fmt.Errorf("no fixed %s rate for %s", fiat, currency)
+}
+
+// PriceCache keeps the rates of a provider for a TTL, and serves the last known rate
+// when the provider fails
+
+type cachedPrice struct {
+	price   float64
+	fetched time.Time
+}
+
+type PriceCache struct {
+	provider PriceProvider
+	ttl      time.Duration
+	mutex    sync.Mutex
+	entries  map[string]cachedPrice
+}
+
+func NewPriceCache(provider PriceProvider, ttl time.Duration) *PriceCache {
+	return &PriceCache{provider: provider, ttl: ttl, entries: map[string]cachedPrice{}}
+}
+
+// Len returns the number of cached rates
+func (c *PriceCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Price returns the rate and its age, the error is only set if no rate was ever retrieved
+func (c *PriceCache) Price(currency string, fiat string) (float64, time.Duration, error) {
+	key := currency + "/" + fiat
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	c.mutex.Unlock()
+	fresh := ok && now.Sub(entry.fetched) < c.ttl
+	cacheStats.Lookup("prices", fresh)
+	if fresh {
+		return entry.price, now.Sub(entry.fetched), nil
+	}
+
+	price, err := c.provider.Price(currency, fiat)
+	if err != nil {
+		if ok {
+			log.Println("Error retrieving", currency, "to", fiat, "exchange rate, using last known rate:", err)
+			return entry.price, now.Sub(entry.fetched), nil
+		}
+		return 0, 0, err
+	}
+
+	c.mutex.Lock()
+	c.entries[key] = cachedPrice{price: price, fetched: now}
+	c.mutex.Unlock()
+	return price, 0, nil
+}
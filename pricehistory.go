@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Price history: with --fiat, the exchange rates retrieved from the providers are recorded in the
+// history store, and served by the JSON API, so that the fiat revenue of past days can be computed
+// with their own rates rather than the current one:
+//   /api/v1/prices?currency=bitcoin&fiat=usd&range=30d
+// With daily=true, the average rate of each day (UTC) is returned instead of the recorded ones
+
+const historyPricesFile = "prices.jsonl"
+
+type PriceSample struct {
+	Time     time.Time `json:"time"`
+	Currency string    `json:"currency"`
+	Fiat     string    `json:"fiat"`
+	Price    float64   `json:"price"`
+}
+
+type DailyPrice struct {
+	Date     string  `json:"date"`
+	Currency string  `json:"currency"`
+	Fiat     string  `json:"fiat"`
+	Price    float64 `json:"price"`
+	Samples  int     `json:"samples"`
+}
+
+// Counts the recorded rates and opens their file for the next ones
+func (s *HistoryStore) openPrices() error {
+	if err := readJsonLines(filepath.Join(s.dir, historyPricesFile), func(line []byte) error {
+		s.pricesCount++
+		return nil
+	}); err != nil {
+		return err
+	}
+	var err error
+	s.pricesFile, err = os.OpenFile(filepath.Join(s.dir, historyPricesFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return err
+}
+
+// RecordPrice stores a rate retrieved from a provider
+func (s *HistoryStore) RecordPrice(currency string, fiat string, price float64, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sample := PriceSample{Time: at.UTC(), Currency: currency, Fiat: fiat, Price: price}
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	if _, err := s.pricesFile.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.pricesCount++
+	return nil
+}
+
+// Prices returns the rates of a currency to a fiat recorded since the given time, read from the file
+func (s *HistoryStore) Prices(currency string, fiat string, since time.Time) ([]PriceSample, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	samples := []PriceSample{}
+	err := readJsonLines(filepath.Join(s.dir, historyPricesFile), func(line []byte) error {
+		sample := PriceSample{}
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		if strings.EqualFold(sample.Currency, currency) && strings.EqualFold(sample.Fiat, fiat) && !sample.Time.Before(since) {
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// DailyPrices returns the average rate of each day of a currency to a fiat since the given time
+func (s *HistoryStore) DailyPrices(currency string, fiat string, since time.Time) ([]DailyPrice, error) {
+	samples, err := s.Prices(currency, fiat, since)
+	if err != nil {
+		return nil, err
+	}
+	days := []DailyPrice{}
+	for _, sample := range samples {
+		date := sample.Time.Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, DailyPrice{Date: date, Currency: sample.Currency, Fiat: sample.Fiat})
+		}
+		day := &days[len(days)-1]
+		// Running average
+		day.Samples++
+		day.Price += (sample.Price - day.Price) / float64(day.Samples)
+	}
+	return days, nil
+}
+
+func (e *F2PoolExporter) servePrices(w http.ResponseWriter, r *http.Request) {
+	currency, fiat := r.URL.Query().Get("currency"), r.URL.Query().Get("fiat")
+	if len(currency) == 0 || len(fiat) == 0 {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "currency and fiat required"})
+		return
+	}
+	length := 24 * time.Hour
+	if value := r.URL.Query().Get("range"); len(value) != 0 {
+		var err error
+		if length, err = ParseRange(value); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	since := time.Now().Add(-length)
+	var prices interface{}
+	var err error
+	if r.URL.Query().Get("daily") == "true" {
+		prices, err = e.history.DailyPrices(currency, fiat, since)
+	} else {
+		prices, err = e.history.Prices(currency, fiat, since)
+	}
+	if err != nil {
+		log.Println("Error reading", currency, "to", fiat, "exchange rates history :", err)
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "history unavailable"})
+		return
+	}
+	writeJson(w, http.StatusOK, prices)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Pushgateway sink, for one-shot (--once) or cron invocations
+
+type PushgatewaySink struct {
+	url      string
+	job      string
+	grouping map[string]string
+}
+
+func NewPushgatewaySink(url string, job string, grouping map[string]string) *PushgatewaySink {
+	return &PushgatewaySink{url: url, job: job, grouping: grouping}
+}
+
+// Push replaces the metrics of the whole group on the Pushgateway
+func (s *PushgatewaySink) Push(families []*dto.MetricFamily) error {
+	pusher := push.New(s.url, s.job).Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	}))
+	for name, value := range s.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.Push()
+}
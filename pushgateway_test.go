@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPushgatewaySinkPush(t *testing.T) {
+	var method, path, contentType string
+	var body []byte
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer pushgateway.Close()
+
+	sink := NewPushgatewaySink(pushgateway.URL, "f2pool", map[string]string{"instance": "cron/1"})
+	if err := sink.Push(testFamilies(t)); err != nil {
+		t.Fatal(err)
+	}
+	// The whole group is replaced, values with a '/' are base64 encoded
+	if method != http.MethodPut || path != "/metrics/job/f2pool/instance@base64/Y3Jvbi8x" {
+		t.Errorf("request = %s %s, want PUT /metrics/job/f2pool/instance@base64/Y3Jvbi8x", method, path)
+	}
+	if !strings.HasPrefix(contentType, "application/vnd.google.protobuf") || len(body) == 0 {
+		t.Errorf("body of type %q and %d bytes, want the protobuf families", contentType, len(body))
+	}
+}
+
+func TestPushgatewaySinkPushError(t *testing.T) {
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "inconsistent metrics", http.StatusBadRequest)
+	}))
+	defer pushgateway.Close()
+
+	if err := NewPushgatewaySink(pushgateway.URL, "f2pool", nil).Push(testFamilies(t)); err == nil {
+		t.Error("Push = nil error, want the status error")
+	}
+}
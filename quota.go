@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// API quotas: the requests made to the F2Pool API endpoints are counted against the configured
+// limits (api_quotas of the configuration file, e.g. the documented rate limits of the API) over
+// sliding windows, the usage being exported and logged when it reaches --api-quota-warning-ratio,
+// before the API starts throttling the exporter. Endpoints are v1 (the account calls) and
+// v2/{endpoint}, a v2 quota applying to every v2 endpoint
+
+var f2pool_api_quota_used_ratio = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "api", "quota_used_ratio"),
+	"Requests made to the F2Pool API endpoint over the quota window, over the quota limit", []string{"endpoint"}, nil)
+
+type ApiQuota struct {
+	Requests int      `json:"requests"`
+	Window   Duration `json:"window"`
+}
+
+type QuotaTracker struct {
+	mutex  sync.Mutex
+	quotas map[string]ApiQuota
+	// Times of the requests of each quota window
+	requests map[string][]time.Time
+	// Quotas whose usage was logged as reaching the warning ratio
+	warned map[string]bool
+}
+
+// Quota usage of the API requests, nil without quota
+var apiQuotas *QuotaTracker
+
+func NewQuotaTracker(quotas map[string]ApiQuota) (*QuotaTracker, error) {
+	for endpoint, quota := range quotas {
+		if quota.Requests <= 0 || quota.Window.Duration <= 0 {
+			return nil, fmt.Errorf("invalid API quota of %s: requests and window must be positive", endpoint)
+		}
+	}
+	return &QuotaTracker{quotas: quotas, requests: map[string][]time.Time{}, warned: map[string]bool{}}, nil
+}
+
+// apiEndpointName returns the endpoint of an API request: v1, or v2/{endpoint}, whatever the base
+// URL of the API (fallback endpoints included)
+func apiEndpointName(req *http.Request) string {
+	if i := strings.Index(req.URL.Path, "/v2/"); i >= 0 {
+		return req.URL.Path[i+1:]
+	}
+	return "v1"
+}
+
+// prune drops the requests out of the window of a quota, t.mutex being held
+func (t *QuotaTracker) prune(endpoint string, now time.Time) []time.Time {
+	requests := t.requests[endpoint]
+	since := now.Add(-t.quotas[endpoint].Window.Duration)
+	i := sort.Search(len(requests), func(i int) bool { return requests[i].After(since) })
+	requests = requests[i:]
+	t.requests[endpoint] = requests
+	return requests
+}
+
+// Observe counts a request to an endpoint against the quotas it is subject to
+func (t *QuotaTracker) Observe(endpoint string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for quotaEndpoint, quota := range t.quotas {
+		if quotaEndpoint != endpoint && !strings.HasPrefix(endpoint, quotaEndpoint+"/") {
+			continue
+		}
+		requests := append(t.prune(quotaEndpoint, now), now)
+		t.requests[quotaEndpoint] = requests
+
+		ratio := float64(len(requests)) / float64(quota.Requests)
+		if ratio < *apiQuotaWarningRatio {
+			t.warned[quotaEndpoint] = false
+		} else if !t.warned[quotaEndpoint] {
+			t.warned[quotaEndpoint] = true
+			log.Printf("Warning F2Pool API quota of %s at %.0f%%: %d requests of %d over %s", quotaEndpoint, ratio*100, len(requests), quota.Requests, quota.Window.Duration)
+		}
+	}
+}
+
+func (t *QuotaTracker) Collect(ch chan<- prometheus.Metric, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for endpoint, quota := range t.quotas {
+		used := len(t.prune(endpoint, now))
+		ch <- prometheus.MustNewConstMetric(f2pool_api_quota_used_ratio, prometheus.GaugeValue, float64(used)/float64(quota.Requests), endpoint)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Log redaction: wallet addresses, API tokens, passwords and authentication headers are masked in
+// the log output (and the startup messages), so logs can be shipped to shared logging systems
+
+const redacted = "[REDACTED]"
+
+var (
+	// Bitcoin-like base58 (P2PKH/P2SH, Litecoin L/M, Dogecoin D, Zcash t1/t3...), bech32 and Ethereum-like addresses
+	walletAddressRegexp = regexp.MustCompile(`\b(0x[0-9a-fA-F]{40}|(bc|ltc|tb|bcrt)1[02-9ac-hj-np-z]{11,71}|(t1|t3)[1-9A-HJ-NP-Za-km-z]{33}|[13LMD][1-9A-HJ-NP-Za-km-z]{25,34})\b`)
+	// Authentication headers, given as Header: value or header=value (flags, URLs, dumps)
+	authHeaderRegexp = regexp.MustCompile(`(?i)((?:authorization|f2p-api-secret|x-consul-token|x-vault-token|token|password|secret|secret_id|access_token|api_key)["']?\s*[:=]\s*["']?)((?:bearer|basic)\s+)?[^\s"',&;]+`)
+	// Passwords of URLs user information
+	urlPasswordRegexp = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+)
+
+// Redactor masks the sensitive data of texts, and of everything written to its writers
+type Redactor struct {
+	mutex   sync.RWMutex
+	secrets map[string]bool
+	// Registered secrets, longest first so that a secret containing another one is masked entirely
+	sorted []string
+}
+
+var (
+	// Set when the redaction is enabled
+	logRedactor *Redactor
+	// Output of the startup messages
+	stdout io.Writer = os.Stdout
+)
+
+// EnableLogRedaction redacts the log output and the startup messages
+func EnableLogRedaction() {
+	logRedactor = NewRedactor()
+	log.SetOutput(logRedactor.Writer(os.Stderr))
+	stdout = logRedactor.Writer(os.Stdout)
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{secrets: map[string]bool{}}
+}
+
+// AddSecret registers a value masked wherever it appears (tokens read from files or Vault...)
+func (r *Redactor) AddSecret(secret string) {
+	// Too short values would mask unrelated text
+	if len(secret) < 4 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.secrets[secret] {
+		return
+	}
+	r.secrets[secret] = true
+	r.sorted = append(r.sorted, secret)
+	sort.Slice(r.sorted, func(i, j int) bool { return len(r.sorted[i]) > len(r.sorted[j]) })
+}
+
+func (r *Redactor) Redact(text string) string {
+	r.mutex.RLock()
+	for _, secret := range r.sorted {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	r.mutex.RUnlock()
+
+	text = urlPasswordRegexp.ReplaceAllString(text, "${1}"+redacted+"@")
+	text = authHeaderRegexp.ReplaceAllString(text, "${1}${2}"+redacted)
+	// The first characters are kept to tell addresses apart
+	return walletAddressRegexp.ReplaceAllStringFunc(text, func(address string) string {
+		return address[:6] + "***"
+	})
+}
+
+// Writer returns a writer redacting what is written to the given one
+func (r *Redactor) Writer(writer io.Writer) io.Writer {
+	return &redactingWriter{redactor: r, writer: writer}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	writer   io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.writer, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactSecret registers a secret value when the redaction is enabled
+func RedactSecret(secret string) {
+	if logRedactor != nil {
+		logRedactor.AddSecret(secret)
+	}
+}
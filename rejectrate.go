@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// High reject rate condition of the workers: the stale rejected ratio of the last hour is over
+// --reject-rate-threshold. It is exported as f2pool_worker_reject_rate_high and used by the
+// reject_rate_high rule of the built-in alerting, for one definition with and without Prometheus
+
+var f2pool_worker_reject_rate_high = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_reject_rate_high"),
+	"Whether the stale rejected ratio of the last hour of the worker is over --reject-rate-threshold", []string{"currency", "account", "worker"}, nil)
+
+// RejectRate returns the stale rejected ratio of the last hour of a worker, false without hashes
+func RejectRate(worker *WorkerSnapshot) (float64, bool) {
+	if worker.HashesLastHour <= 0 {
+		return 0, false
+	}
+	return worker.StaleHashesRejectedLastHour / worker.HashesLastHour, true
+}
+
+func RejectRateHigh(worker *WorkerSnapshot) bool {
+	ratio, ok := RejectRate(worker)
+	return ok && ratio > *rejectRateThreshold
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prometheus-style relabeling of the worker label, applied before the worker series are emitted
+// See: https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config
+
+var defaultRelabelRegex = MustCompileRegexp("(.*)")
+
+type RelabelRule struct {
+	// Labels (currency, account, worker) whose values are concatenated with Separator, worker by default
+	SourceLabels []string `json:"source_labels"`
+	Separator    string   `json:"separator"`
+	// Regular expression (anchored) matched against the concatenated values, (.*) by default
+	Regex *Regexp `json:"regex"`
+	// Worker name of the replace action, with $1 style references to the regex groups, $1 by default
+	Replacement *string `json:"replacement"`
+	// replace (default), keep or drop
+	Action string `json:"action"`
+}
+
+// RelabelWorker applies the relabel rules to a worker, returning its new name and whether it is kept
+func (c *Config) RelabelWorker(currency string, account string, worker string) (string, bool) {
+	for _, rule := range c.Relabel {
+		labels := map[string]string{"currency": currency, "account": account, "worker": worker}
+		sources := rule.SourceLabels
+		if len(sources) == 0 {
+			sources = []string{"worker"}
+		}
+		separator := rule.Separator
+		if len(separator) == 0 {
+			separator = ";"
+		}
+		values := []string{}
+		for _, source := range sources {
+			values = append(values, labels[source])
+		}
+		value := strings.Join(values, separator)
+
+		regex := rule.Regex
+		if regex == nil {
+			regex = defaultRelabelRegex
+		}
+		match := regex.FindStringSubmatchIndex(value)
+
+		switch rule.Action {
+		case "", "replace":
+			if match == nil {
+				continue
+			}
+			replacement := "$1"
+			if rule.Replacement != nil {
+				replacement = *rule.Replacement
+			}
+			worker = string(regex.ExpandString(nil, replacement, value, match))
+		case "keep":
+			if match == nil {
+				return worker, false
+			}
+		case "drop":
+			if match != nil {
+				return worker, false
+			}
+		}
+	}
+	return worker, true
+}
+
+// MergeWorkers aggregates the workers given the same label (e.g. rigs grouped by a replace rule), in
+// the order of their first worker: their hashrates and hashes are summed and their last share is the
+// most recent one, parsed with lastShare. The workers are copied, the answer is not modified
+func MergeWorkers(workers []LabeledWorker, lastShare func(value string) (time.Time, bool)) []LabeledWorker {
+	merged := make([]LabeledWorker, 0, len(workers))
+	indexes := make(map[string]int, len(workers))
+	for _, labeled := range workers {
+		index, ok := indexes[labeled.Label]
+		if !ok {
+			indexes[labeled.Label] = len(merged)
+			merged = append(merged, labeled)
+			continue
+		}
+
+		worker := *merged[index].Worker
+		other := labeled.Worker
+		worker.Hashrate += other.Hashrate
+		worker.HashesLastHour += other.HashesLastHour
+		worker.StaleHashesRejectedLastHour += other.StaleHashesRejectedLastHour
+		worker.HashesLastDay += other.HashesLastDay
+		worker.StaleHashesRejectedLastDay += other.StaleHashesRejectedLastDay
+		worker.LocalHashrate += other.LocalHashrate
+		worker.HasLocalHashrate = worker.HasLocalHashrate || other.HasLocalHashrate
+		if other.Fields > worker.Fields {
+			worker.Fields = other.Fields
+		}
+		if t, ok := lastShare(other.LastShare); ok {
+			if last, ok := lastShare(worker.LastShare); !ok || t.After(last) {
+				worker.LastShare = other.LastShare
+			}
+		}
+		merged[index].Worker = &worker
+	}
+	return merged
+}
+
+func validateRelabelRules(rules []RelabelRule) error {
+	for _, rule := range rules {
+		switch rule.Action {
+		case "", "replace", "keep", "drop":
+		default:
+			return fmt.Errorf("unknown relabel action %q", rule.Action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRelabelWorker(t *testing.T) {
+	farm := "farm-$1"
+	empty := ""
+	tests := []struct {
+		name   string
+		rules  []RelabelRule
+		worker string
+		want   string
+		keep   bool
+	}{
+		{name: "no rules", worker: "rig-1", want: "rig-1", keep: true},
+		{
+			name:   "replace",
+			rules:  []RelabelRule{{Regex: MustCompileRegexp(`(\w+)\.rig-\d+`), Replacement: &farm}},
+			worker: "paris.rig-12",
+			want:   "farm-paris",
+			keep:   true,
+		},
+		{
+			name:   "replace not matching",
+			rules:  []RelabelRule{{Regex: MustCompileRegexp(`(\w+)\.rig-\d+`), Replacement: &farm}},
+			worker: "paris.rig-12.old",
+			want:   "paris.rig-12.old",
+			keep:   true,
+		},
+		{
+			name:   "replace with the account",
+			rules:  []RelabelRule{{SourceLabels: []string{"account", "worker"}, Regex: MustCompileRegexp(`(.*);(.*)`), Replacement: &empty}, {Regex: MustCompileRegexp(``), Replacement: &farm}},
+			worker: "rig-1",
+			want:   "farm-",
+			keep:   true,
+		},
+		{
+			name:   "keep",
+			rules:  []RelabelRule{{Regex: MustCompileRegexp(`rig-.*`), Action: "keep"}},
+			worker: "test-1",
+			want:   "test-1",
+			keep:   false,
+		},
+		{
+			name:   "drop",
+			rules:  []RelabelRule{{SourceLabels: []string{"currency"}, Regex: MustCompileRegexp(`litecoin`), Action: "drop"}},
+			worker: "rig-1",
+			want:   "rig-1",
+			keep:   false,
+		},
+		{
+			name:   "drop not matching",
+			rules:  []RelabelRule{{Regex: MustCompileRegexp(`test-.*`), Action: "drop"}},
+			worker: "rig-1",
+			want:   "rig-1",
+			keep:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{Relabel: test.rules}
+			got, keep := config.RelabelWorker("litecoin", "account", test.worker)
+			if got != test.want || keep != test.keep {
+				t.Errorf("RelabelWorker(%q) = %q, %v, want %q, %v", test.worker, got, keep, test.want, test.keep)
+			}
+		})
+	}
+}
+
+func TestMergeWorkers(t *testing.T) {
+	lastShare := func(value string) (time.Time, bool) {
+		t, err := time.Parse(time.RFC3339, value)
+		return t, err == nil
+	}
+	rig1 := &AccountWorker{Name: "rig-1", Hashrate: 1, HashesLastDay: 10, LastShare: "2024-01-02T03:00:00Z", Fields: 7}
+	rig2 := &AccountWorker{Name: "rig-2", Hashrate: 2, HashesLastDay: 20, LastShare: "2024-01-02T04:00:00Z", LocalHashrate: 3, HasLocalHashrate: true, Fields: 8}
+	rig3 := &AccountWorker{Name: "rig-3", Hashrate: 4, HashesLastDay: 40, Fields: 6}
+	other := &AccountWorker{Name: "other", Hashrate: 8}
+	tests := []struct {
+		name    string
+		workers []LabeledWorker
+		want    []AccountWorker
+	}{
+		{
+			name:    "distinct labels",
+			workers: []LabeledWorker{{rig1, "rig-1"}, {rig2, "rig-2"}},
+			want:    []AccountWorker{*rig1, *rig2},
+		},
+		{
+			name:    "same label",
+			workers: []LabeledWorker{{rig1, "farm"}, {other, "other"}, {rig2, "farm"}, {rig3, "farm"}},
+			want: []AccountWorker{
+				{Name: "rig-1", Hashrate: 7, HashesLastDay: 70, LastShare: "2024-01-02T04:00:00Z", LocalHashrate: 3, HasLocalHashrate: true, Fields: 8},
+				*other,
+			},
+		},
+		{
+			name:    "earlier last share",
+			workers: []LabeledWorker{{rig2, "farm"}, {rig1, "farm"}},
+			want:    []AccountWorker{{Name: "rig-2", Hashrate: 3, HashesLastDay: 30, LastShare: "2024-01-02T04:00:00Z", LocalHashrate: 3, HasLocalHashrate: true, Fields: 8}},
+		},
+		{
+			name:    "without last share",
+			workers: []LabeledWorker{{rig3, "farm"}, {rig1, "farm"}},
+			want:    []AccountWorker{{Name: "rig-3", Hashrate: 5, HashesLastDay: 50, LastShare: "2024-01-02T03:00:00Z", Fields: 7}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := []AccountWorker{}
+			for _, worker := range MergeWorkers(test.workers, lastShare) {
+				merged = append(merged, *worker.Worker)
+			}
+			if !reflect.DeepEqual(merged, test.want) {
+				t.Errorf("MergeWorkers = %+v, want %+v", merged, test.want)
+			}
+		})
+	}
+	if rig1.Hashrate != 1 || rig3.LastShare != "" {
+		t.Error("MergeWorkers modified the workers")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Prometheus remote_write sink, for exporters which cannot be scraped (behind NAT)
+// See: https://prometheus.io/docs/concepts/remote_write_spec/
+
+type RemoteWriteSink struct {
+	client      *http.Client
+	url         string
+	username    string
+	password    string
+	bearerToken string
+}
+
+func NewRemoteWriteSink(client *http.Client, url string, username string, password string, bearerToken string) *RemoteWriteSink {
+	return &RemoteWriteSink{client: client, url: url, username: username, password: password, bearerToken: bearerToken}
+}
+
+func (s *RemoteWriteSink) Push(families []*dto.MetricFamily) error {
+	request := encodeWriteRequest(FlattenFamilies(families, time.Now()))
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(snappyEncode(request)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "f2pool-exporter/"+version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if len(s.bearerToken) != 0 {
+		req.Header.Set("Authorization", "Bearer "+Secret(s.bearerToken))
+	} else if len(s.username) != 0 {
+		req.SetBasicAuth(s.username, Secret(s.password))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Protobuf encoding of prometheus.WriteRequest:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label { string name = 1; string value = 2; }
+//	Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(samples []FlatSample) []byte {
+	var request []byte
+	for _, sample := range samples {
+		labels := map[string]string{"__name__": sample.Name}
+		for name, value := range sample.Labels {
+			labels[name] = value
+		}
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		// Labels have to be sorted by name
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, labels[name])
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var point []byte
+		point = protowire.AppendTag(point, 1, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, math.Float64bits(sample.Value))
+		point = protowire.AppendTag(point, 2, protowire.VarintType)
+		point = protowire.AppendVarint(point, uint64(sample.Time.UnixNano()/int64(time.Millisecond)))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, point)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	return request
+}
+
+// Snappy block format encoding using only literals, valid for any snappy decoder
+// See: https://github.com/google/snappy/blob/main/format_description.txt
+func snappyEncode(data []byte) []byte {
+	out := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data)+len(data)/65536*3+3)
+	out = out[:binary.PutUvarint(out, uint64(len(data)))]
+	for len(data) != 0 {
+		chunk := data
+		if len(chunk) > 65536 {
+			chunk = chunk[:65536]
+		}
+		data = data[len(chunk):]
+
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			out = append(out, byte(n)<<2)
+		case n < 1<<8:
+			out = append(out, 60<<2, byte(n))
+		default:
+			out = append(out, 61<<2, byte(n), byte(n>>8))
+		}
+		out = append(out, chunk...)
+	}
+	return out
+}
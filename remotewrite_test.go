@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Decodes the literals of a snappy block, the only elements written by snappyEncode
+func snappyDecodeLiterals(data []byte) ([]byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid length")
+	}
+	data = data[n:]
+	out := []byte{}
+	for len(data) != 0 {
+		tag := data[0]
+		if tag&3 != 0 {
+			return nil, fmt.Errorf("not a literal: %x", tag)
+		}
+		size, header := int(tag>>2)+1, 1
+		switch tag >> 2 {
+		case 60:
+			size, header = int(data[1])+1, 2
+		case 61:
+			size, header = int(data[1])|int(data[2])<<8+1, 3
+		}
+		if len(data) < header+size {
+			return nil, fmt.Errorf("truncated literal")
+		}
+		out = append(out, data[header:header+size]...)
+		data = data[header+size:]
+	}
+	if uint64(len(out)) != length {
+		return nil, fmt.Errorf("length %d, want %d", len(out), length)
+	}
+	return out, nil
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, size := range []int{0, 1, 60, 61, 256, 257, 65536, 65537, 200000} {
+		data := bytes.Repeat([]byte("f2pool"), size/6+1)[:size]
+		got, err := snappyDecodeLiterals(snappyEncode(data))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("snappyEncode of %d bytes does not decode: %v", size, err)
+		}
+	}
+}
+
+// Series of a WriteRequest, as name{label="value",...} value
+func decodeWriteRequest(t *testing.T, request []byte) []string {
+	t.Helper()
+	fields := func(data []byte, field func(number protowire.Number, typ protowire.Type, value []byte)) {
+		for len(data) != 0 {
+			number, typ, n := protowire.ConsumeTag(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			data = data[n:]
+			n = protowire.ConsumeFieldValue(number, typ, data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			field(number, typ, data[:n])
+			data = data[n:]
+		}
+	}
+	series := []string{}
+	fields(request, func(_ protowire.Number, _ protowire.Type, value []byte) {
+		content, _ := protowire.ConsumeBytes(value)
+		name, labels, sample := "", []string{}, ""
+		fields(content, func(number protowire.Number, _ protowire.Type, value []byte) {
+			message, _ := protowire.ConsumeBytes(value)
+			switch number {
+			case 1:
+				var label [2]string
+				fields(message, func(number protowire.Number, _ protowire.Type, value []byte) {
+					s, _ := protowire.ConsumeString(value)
+					label[number-1] = s
+				})
+				if label[0] == "__name__" {
+					name = label[1]
+				} else {
+					labels = append(labels, fmt.Sprintf("%s=%q", label[0], label[1]))
+				}
+			case 2:
+				fields(message, func(number protowire.Number, _ protowire.Type, value []byte) {
+					if number == 1 {
+						bits, _ := protowire.ConsumeFixed64(value)
+						sample = fmt.Sprint(math.Float64frombits(bits))
+					}
+				})
+			}
+		})
+		series = append(series, name+"{"+strings.Join(labels, ",")+"} "+sample)
+	})
+	sort.Strings(series)
+	return series
+}
+
+func TestRemoteWriteSinkPush(t *testing.T) {
+	tests := []struct {
+		name          string
+		username      string
+		password      string
+		bearerToken   string
+		authorization string
+	}{
+		{name: "anonymous"},
+		{name: "basic", username: "user", password: "secret", authorization: "Basic dXNlcjpzZWNyZXQ="},
+		{name: "bearer", username: "user", bearerToken: "token", authorization: "Bearer token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var headers http.Header
+			var body []byte
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers = r.Header
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer receiver.Close()
+
+			sink := NewRemoteWriteSink(receiver.Client(), receiver.URL, test.username, test.password, test.bearerToken)
+			if err := sink.Push(testFamilies(t)); err != nil {
+				t.Fatal(err)
+			}
+			if got := headers.Get("Authorization"); got != test.authorization {
+				t.Errorf("Authorization header = %q, want %q", got, test.authorization)
+			}
+			if headers.Get("Content-Encoding") != "snappy" || headers.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+				t.Errorf("headers = %v, want the remote write ones", headers)
+			}
+			request, err := snappyDecodeLiterals(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			series := decodeWriteRequest(t, request)
+			for _, want := range []string{`test_paid_total{} 3`, `test_hashrate{currency="bitcoin",worker="rig 1"} 100`} {
+				if i := sort.SearchStrings(series, want); i == len(series) || series[i] != want {
+					t.Errorf("series = %q, want %s", series, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteWriteSinkPushError(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	err := NewRemoteWriteSink(receiver.Client(), receiver.URL, "", "", "").Push(testFamilies(t))
+	if err == nil || !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("Push error = %v, want the receiver message", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// Renaming of the exported metrics (e.g. to keep old names after a naming change), applied
+// when the metrics are gathered for the scrapes and the sinks. A metric renamed to the name of a
+// gathered metric which is not renamed would duplicate the family: it keeps its name, logged once
+
+type RenamingGatherer struct {
+	gatherer prometheus.Gatherer
+	names    map[string]string
+	// Renames not applied, logged
+	conflicts sync.Map
+}
+
+func NewRenamingGatherer(gatherer prometheus.Gatherer, names map[string]string) (*RenamingGatherer, error) {
+	exported := map[string]string{}
+	for name, newName := range names {
+		if !model.IsValidMetricName(model.LabelValue(newName)) {
+			return nil, fmt.Errorf("invalid metric name %q", newName)
+		}
+		if other, ok := exported[newName]; ok {
+			return nil, fmt.Errorf("metrics %s and %s are both renamed to %s", other, name, newName)
+		}
+		exported[newName] = name
+	}
+	return &RenamingGatherer{gatherer: gatherer, names: names}, nil
+}
+
+func (g *RenamingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	// Names keeping their family
+	kept := make(map[string]bool, len(families))
+	for _, family := range families {
+		if _, ok := g.names[family.GetName()]; !ok {
+			kept[family.GetName()] = true
+		}
+	}
+	// Gathered families are built for each call, they can be modified
+	for _, family := range families {
+		newName, ok := g.names[family.GetName()]
+		if !ok {
+			continue
+		}
+		if kept[newName] {
+			if _, logged := g.conflicts.LoadOrStore(family.GetName(), true); !logged {
+				log.Println("Metric", family.GetName(), "not renamed to", newName, ": an exported metric already has the name")
+			}
+			continue
+		}
+		family.Name = &newName
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families, err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRenamingGatherer(t *testing.T) {
+	tests := []struct {
+		name     string
+		families []string
+		names    map[string]string
+		want     []string
+	}{
+		{
+			name:     "renamed",
+			families: []string{"f2pool_hashrate", "f2pool_up"},
+			names:    map[string]string{"f2pool_hashrate": "f2pool_hashrate_hashes_per_second"},
+			want:     []string{"f2pool_hashrate_hashes_per_second", "f2pool_up"},
+		},
+		{
+			name:     "swapped",
+			families: []string{"f2pool_a", "f2pool_b"},
+			names:    map[string]string{"f2pool_a": "f2pool_b", "f2pool_b": "f2pool_a"},
+			want:     []string{"f2pool_a", "f2pool_b"},
+		},
+		{
+			name:     "onto a gathered name",
+			families: []string{"f2pool_hashrate", "f2pool_up"},
+			names:    map[string]string{"f2pool_hashrate": "f2pool_up"},
+			want:     []string{"f2pool_hashrate", "f2pool_up"},
+		},
+		{
+			name:     "not gathered",
+			families: []string{"f2pool_up"},
+			names:    map[string]string{"f2pool_hashrate": "f2pool_up_renamed"},
+			want:     []string{"f2pool_up"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gatherer, err := NewRenamingGatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				families := []*dto.MetricFamily{}
+				for _, name := range test.families {
+					name := name
+					families = append(families, &dto.MetricFamily{Name: &name})
+				}
+				return families, nil
+			}), test.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			families, err := gatherer.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, family := range families {
+				names = append(names, family.GetName())
+			}
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("Gather = %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestNewRenamingGathererInvalid(t *testing.T) {
+	tests := []map[string]string{
+		{"f2pool_up": "f2pool-up"},
+		{"f2pool_a": "f2pool_c", "f2pool_b": "f2pool_c"},
+	}
+	for _, names := range tests {
+		if _, err := NewRenamingGatherer(prometheus.NewRegistry(), names); err == nil {
+			t.Errorf("NewRenamingGatherer(%v) = nil error, want an error", names)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Revenue drops: the revenue of the last 24 hours is compared to its average over the trailing
+// --revenue-average-range of the history store, so that sudden revenue changes (fees, luck,
+// settlement) are alertable without per-account thresholds
+
+var f2pool_value_last_day_drop_percent = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "value_last_day_drop_percent"),
+	"Drop of the revenue of the last 24 hours from its trailing average, in percent (negative for an increase)", []string{"currency", "account"}, nil)
+
+// AverageValueLastDay returns the average revenue of the last 24 hours of the samples of a resource
+// recorded since the given time, within the recent range of the store, false without sample
+func (s *HistoryStore) AverageValueLastDay(resource string, since time.Time) (float64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sum, count := 0.0, 0
+	for _, sample := range s.recent[resource] {
+		if sample.Resource == resource && !sample.Time.Before(since) {
+			sum += sample.ValueLastDay
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// Drop of a revenue from the average, false for a zero average
+func revenueDropPercent(value float64, average float64) (float64, bool) {
+	if average <= 0 {
+		return 0, false
+	}
+	return (1 - value/average) * 100, true
+}
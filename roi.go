@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Return on investment of the mining hardware, revenue is retrieved from the v2 API transactions
+
+// HardwareGroup is the purchase of the hardware running some workers of an account (all of them if empty)
+type HardwareGroup struct {
+	Name     string   `json:"name"`
+	Currency string   `json:"currency"`
+	Account  string   `json:"account"`
+	Workers  []string `json:"workers"`
+	Cost     float64  `json:"cost"`
+	Fiat     string   `json:"fiat"`
+	// Purchase date, YYYY-MM-DD
+	Purchased string `json:"purchased"`
+}
+
+// Revenue sums are refreshed hourly, transactions being daily
+const hardwareRevenueTTL = time.Hour
+
+type cachedRevenue struct {
+	value   float64
+	fetched time.Time
+}
+
+type RevenueTracker struct {
+	mutex   sync.Mutex
+	entries map[string]cachedRevenue
+}
+
+func NewRevenueTracker() *RevenueTracker {
+	return &RevenueTracker{entries: map[string]cachedRevenue{}}
+}
+
+// AccountRevenueSince returns the revenue of an account since the given date
+func (t *RevenueTracker) AccountRevenueSince(client *http.Client, token string, currency string, account string, since time.Time) (float64, error) {
+	key := currency + "/" + account + "/" + since.Format("2006-01-02")
+	now := time.Now()
+
+	t.mutex.Lock()
+	entry, ok := t.entries[key]
+	t.mutex.Unlock()
+	if ok && now.Sub(entry.fetched) < hardwareRevenueTTL {
+		return entry.value, nil
+	}
+
+	transactions, err := FetchTransactions(client, token, currency, account, "revenue", since.Unix(), now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	revenue := 0.0
+	for _, transaction := range transactions {
+		revenue += transaction.ChangedBalance
+	}
+
+	t.mutex.Lock()
+	t.entries[key] = cachedRevenue{value: revenue, fetched: now}
+	t.mutex.Unlock()
+	return revenue, nil
+}
+
+// Share returns the part of the account hashes of last 24 hours made by the group workers,
+// used to approximate its part of the account revenue
+func (g *HardwareGroup) Share(workerHashes map[string]float64, accountHashes float64) float64 {
+	if len(g.Workers) == 0 {
+		return 1
+	}
+	if accountHashes == 0 {
+		return 0
+	}
+	hashes := 0.0
+	for _, worker := range g.Workers {
+		hashes += workerHashes[worker]
+	}
+	return hashes / accountHashes
+}
+
+func (g *HardwareGroup) Matches(currency string, account string) bool {
+	return strings.EqualFold(g.Currency, currency) && g.Account == account
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Rules command: writes Prometheus alerting rules on the exported metrics, to be loaded
+// with the rule_files setting of Prometheus
+
+type RulesThresholds struct {
+	// Minutes without share before a worker is offline
+	OfflineMinutes float64
+	// Stale rejected hashes ratio of the last hour
+	StaleRatio float64
+	// Ratio of the hashrate below its moving average
+	HashrateDeviation float64
+	// Percent of revenue drop from the trailing average
+	RevenueDrop float64
+	// Days without payout
+	PayoutDays int
+}
+
+type alertingRule struct {
+	name        string
+	expr        string
+	duration    string
+	severity    string
+	summary     string
+	description string
+}
+
+func runRules(thresholds RulesThresholds, out io.Writer) error {
+	rules := []alertingRule{
+		{
+			name:        "F2PoolDown",
+			expr:        "f2pool_up == 0",
+			duration:    "5m",
+			severity:    "critical",
+			summary:     "F2Pool API unreachable",
+			description: "Data of {{ $labels.currency }}/{{ $labels.account }} cannot be retrieved from the F2Pool API.",
+		},
+		{
+			name:        "F2PoolWorkerOffline",
+			expr:        fmt.Sprintf(`f2pool_worker_idle_seconds{worker!=%q} > %g`, *accountWorker, thresholds.OfflineMinutes*60),
+			duration:    "0m",
+			severity:    "warning",
+			summary:     "F2Pool worker offline",
+			description: fmt.Sprintf("Worker {{ $labels.worker }} of {{ $labels.currency }}/{{ $labels.account }} has no share for more than %g minutes.", thresholds.OfflineMinutes),
+		},
+		{
+			name:        "F2PoolStaleRatioHigh",
+			expr:        fmt.Sprintf("f2pool_stale_hashes_rejected_last_hour / (f2pool_hashes_last_hour > 0) > %g", thresholds.StaleRatio),
+			duration:    "15m",
+			severity:    "warning",
+			summary:     "F2Pool stale ratio high",
+			description: fmt.Sprintf("Stale rejected ratio of {{ $labels.worker }} ({{ $labels.currency }}/{{ $labels.account }}) is {{ $value | humanizePercentage }} (more than %g%%) over the last hour.", thresholds.StaleRatio*100),
+		},
+		{
+			name:        "F2PoolRejectRateHigh",
+			expr:        "f2pool_worker_reject_rate_high == 1",
+			duration:    "15m",
+			severity:    "warning",
+			summary:     "F2Pool worker reject rate high",
+			description: fmt.Sprintf("Stale rejected ratio of worker {{ $labels.worker }} ({{ $labels.currency }}/{{ $labels.account }}) is over %g%% over the last hour.", *rejectRateThreshold*100),
+		},
+		{
+			name:        "F2PoolHashrateBelowNormal",
+			expr:        fmt.Sprintf("f2pool_hashrate_deviation_ratio < %g", -thresholds.HashrateDeviation),
+			duration:    "30m",
+			severity:    "warning",
+			summary:     "F2Pool hashrate below normal",
+			description: fmt.Sprintf("Hashrate of {{ $labels.worker }} ({{ $labels.currency }}/{{ $labels.account }}) is {{ $value | humanizePercentage }} from its moving average (more than %g%% below).", thresholds.HashrateDeviation*100),
+		},
+		{
+			name:        "F2PoolRevenueDrop",
+			expr:        fmt.Sprintf("f2pool_value_last_day_drop_percent > %g", thresholds.RevenueDrop),
+			duration:    "1h",
+			severity:    "warning",
+			summary:     "F2Pool revenue drop",
+			description: fmt.Sprintf("Revenue of the last 24 hours of {{ $labels.currency }}/{{ $labels.account }} is {{ $value | humanize }}%% under its trailing average (more than %g%%).", thresholds.RevenueDrop),
+		},
+		{
+			name:        "F2PoolNoPayout",
+			expr:        fmt.Sprintf("changes(f2pool_paid[%dd]) == 0", thresholds.PayoutDays),
+			duration:    "1h",
+			severity:    "warning",
+			summary:     "No F2Pool payout",
+			description: fmt.Sprintf("{{ $labels.currency }}/{{ $labels.account }} received no payout for %d days.", thresholds.PayoutDays),
+		},
+	}
+
+	var b strings.Builder
+	b.WriteString("groups:\n")
+	b.WriteString("  - name: f2pool\n")
+	b.WriteString("    rules:\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "      - alert: %s\n", rule.name)
+		fmt.Fprintf(&b, "        expr: %s\n", yamlQuote(rule.expr))
+		fmt.Fprintf(&b, "        for: %s\n", rule.duration)
+		fmt.Fprintf(&b, "        labels:\n")
+		fmt.Fprintf(&b, "          severity: %s\n", rule.severity)
+		fmt.Fprintf(&b, "        annotations:\n")
+		fmt.Fprintf(&b, "          summary: %s\n", yamlQuote(rule.summary))
+		fmt.Fprintf(&b, "          description: %s\n", yamlQuote(rule.description))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// Single quoted YAML scalar, quotes are escaped by doubling them
+func yamlQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operational metrics of the exporter itself, to tell when it is the bottleneck: concurrent
+// collections, in-flight F2Pool API requests and sizes of the caches. The sinks, MQTT publisher and
+// alert notifiers send from their own goroutine without queue, so there is no channel backlog: a
+// slow one delays its next push, seen in its logs and in collections_in_flight
+
+var (
+	collectionsInFlight int64
+	apiRequestsInFlight int64
+
+	f2pool_exporter_goroutines            = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "goroutines"), "Goroutines of the exporter", nil, nil)
+	f2pool_exporter_collections_in_flight = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "collections_in_flight"),
+		"Collections (scrapes, API and sink refreshes) currently running", nil, nil)
+	f2pool_exporter_upstream_requests_in_flight = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "upstream_requests_in_flight"),
+		"F2Pool API requests currently running", nil, nil)
+	f2pool_exporter_cache_entries = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "cache_entries"),
+		"Entries of the exporter caches", []string{"cache"}, nil)
+	f2pool_exporter_scrapes_rejected_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "exporter", "scrapes_rejected_total"),
+		"Scrapes answered with the 503 status, over --web-max-requests concurrent scrapes", nil, nil)
+)
+
+func describeRuntime(ch chan<- *prometheus.Desc) {
+	ch <- f2pool_exporter_goroutines
+	ch <- f2pool_exporter_collections_in_flight
+	ch <- f2pool_exporter_upstream_requests_in_flight
+	ch <- f2pool_exporter_cache_entries
+	ch <- f2pool_exporter_cache_hits_total
+	ch <- f2pool_exporter_cache_misses_total
+	ch <- f2pool_exporter_scrapes_rejected_total
+	ch <- f2pool_exporter_history_disk_bytes
+	ch <- f2pool_exporter_history_entries
+	ch <- f2pool_exporter_history_last_compaction_timestamp_seconds
+	ch <- f2pool_exporter_api_endpoint_up
+	ch <- f2pool_exporter_api_endpoint_active
+	ch <- f2pool_exporter_api_failovers_total
+}
+
+func (e *F2PoolExporter) collectRuntime(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_goroutines, prometheus.GaugeValue, float64(runtime.NumGoroutine()))
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_collections_in_flight, prometheus.GaugeValue, float64(atomic.LoadInt64(&collectionsInFlight)))
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_upstream_requests_in_flight, prometheus.GaugeValue, float64(atomic.LoadInt64(&apiRequestsInFlight)))
+	ch <- prometheus.MustNewConstMetric(f2pool_exporter_scrapes_rejected_total, prometheus.CounterValue, float64(atomic.LoadInt64(&scrapesRejected)))
+
+	caches := map[string]int{
+		"snapshots": e.snapshots.Len(),
+		"counters":  e.counters.Len(),
+		"secrets":   secretFilesLen(),
+	}
+	if e.prices != nil {
+		caches["prices"] = e.prices.Len()
+	}
+	if e.baselines != nil {
+		caches["hashrate_baselines"] = e.baselines.Len()
+	}
+	if e.flaps != nil {
+		caches["worker_flaps"] = e.flaps.Len()
+	}
+	caches["pool_blocks"] = e.poolBlocks.Len()
+	caches["network_stats"] = e.networks.Len()
+	if apiCache != nil {
+		caches["api_responses"] = apiCache.Len()
+	}
+	if e.workerLists != nil {
+		caches["worker_lists"] = e.workerLists.Len()
+	}
+	if e.dns != nil {
+		caches["dns_addresses"] = e.dns.Len()
+	}
+	if e.config.vault != nil {
+		caches["vault_secrets"] = e.config.vault.Len()
+	}
+	for cache, entries := range caches {
+		ch <- prometheus.MustNewConstMetric(f2pool_exporter_cache_entries, prometheus.GaugeValue, float64(entries), cache)
+	}
+	if e.history != nil {
+		e.history.Collect(ch)
+	}
+	if apiEndpoints != nil {
+		apiEndpoints.Collect(ch)
+	}
+}
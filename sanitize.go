@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Sanitization of the worker names used as label values: names with other characters than
+// letters, digits, '_', '-', '.' and ':' (spaces, slashes, emoji...) break dashboards and label matching
+
+var invalidWorkerChars = regexp.MustCompile(`[^a-zA-Z0-9_.:-]`)
+
+var workerSanitizeStrategies = []string{"none", "replace", "hash", "drop"}
+
+func validateWorkerSanitize(strategy string) error {
+	for _, s := range workerSanitizeStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown worker sanitization strategy %q (%s)", strategy, strings.Join(workerSanitizeStrategies, ", "))
+}
+
+// SanitizeWorker returns the label value of a worker name and whether the worker is kept:
+//
+//	none: the name is kept (invalid UTF-8 sequences are always replaced, they cannot be exported)
+//	replace: every invalid character is replaced by '_'
+//	hash: names with invalid characters are replaced by a short hash of the name
+//	drop: workers whose name has invalid characters are not exported
+func SanitizeWorker(name string, strategy string) (string, bool) {
+	name = strings.ToValidUTF8(name, "�")
+	if !invalidWorkerChars.MatchString(name) {
+		return name, true
+	}
+	switch strategy {
+	case "replace":
+		return invalidWorkerChars.ReplaceAllString(name, "_"), true
+	case "hash":
+		return "worker_" + HashValue(name)[:12], true
+	case "drop":
+		return name, false
+	}
+	return name, true
+}
+
+// Worker of an account with its label value
+type LabeledWorker struct {
+	Worker *AccountWorker
+	Label  string
+}
+
+// Worker names made identical by the sanitization, logged once
+var loggedWorkerCollisions sync.Map
+
+// SanitizeWorkers sanitizes the labels of the workers of a resource, dropping the ones not kept.
+// Different names made identical by the sanitization (e.g. "rig 1" and "rig/1" replaced by "rig_1")
+// would export duplicate series: the changed ones are suffixed with a short hash of the name. So is a
+// worker labeled as the account-level series (--account-worker, e.g. a rig named "all")
+func SanitizeWorkers(resource string, workers []LabeledWorker, strategy string, accountWorker string) []LabeledWorker {
+	sanitized := make([]LabeledWorker, 0, len(workers))
+	// Names of the workers by sanitized label
+	names := map[string]map[string]bool{}
+	originals := make([]string, 0, len(workers))
+	for _, worker := range workers {
+		label, keep := SanitizeWorker(worker.Label, strategy)
+		if !keep {
+			continue
+		}
+		if names[label] == nil {
+			names[label] = map[string]bool{}
+		}
+		names[label][worker.Label] = true
+		originals = append(originals, worker.Label)
+		sanitized = append(sanitized, LabeledWorker{Worker: worker.Worker, Label: label})
+	}
+
+	for i := range sanitized {
+		worker := &sanitized[i]
+		if original := originals[i]; len(names[worker.Label]) > 1 && original != worker.Label {
+			label := worker.Label + "_" + HashValue(original)[:6]
+			if _, logged := loggedWorkerCollisions.LoadOrStore(resource+"/"+original, true); !logged {
+				log.Println("Worker", original, "of", resource, "sanitized to the label", worker.Label, "of another worker, exported as", label)
+			}
+			worker.Label = label
+		}
+		// An empty label is the one of the account-level series without worker label too
+		if worker.Label == accountWorker {
+			label := worker.Label + "_" + HashValue(originals[i])[:6]
+			if _, logged := loggedWorkerCollisions.LoadOrStore(resource+"/"+originals[i], true); !logged {
+				log.Println("Worker", originals[i], "of", resource, "labeled as the account-level series, exported as", label)
+			}
+			worker.Label = label
+		}
+	}
+	return sanitized
+}
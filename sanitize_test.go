@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeWorker(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		want     string
+		keep     bool
+	}{
+		{"rig-1.farm:a_b", "replace", "rig-1.farm:a_b", true},
+		{"rig 1", "none", "rig 1", true},
+		{"rig 1", "replace", "rig_1", true},
+		{"rig 1", "hash", "worker_" + HashValue("rig 1")[:12], true},
+		{"rig 1", "drop", "rig 1", false},
+		{"rig\xff", "none", "rig�", true},
+		{"rig\xff", "replace", "rig_", true},
+	}
+	for _, test := range tests {
+		got, keep := SanitizeWorker(test.name, test.strategy)
+		if got != test.want || keep != test.keep {
+			t.Errorf("SanitizeWorker(%q, %s) = %q, %v, want %q, %v", test.name, test.strategy, got, keep, test.want, test.keep)
+		}
+	}
+}
+
+func TestSanitizeWorkers(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       []string
+		strategy      string
+		accountWorker string
+		want          []string
+	}{
+		{
+			name:     "no collision",
+			workers:  []string{"rig 1", "rig 2"},
+			strategy: "replace",
+			want:     []string{"rig_1", "rig_2"},
+		},
+		{
+			name:     "changed names colliding",
+			workers:  []string{"rig 1", "rig/1"},
+			strategy: "replace",
+			want:     []string{"rig_1_" + HashValue("rig 1")[:6], "rig_1_" + HashValue("rig/1")[:6]},
+		},
+		{
+			name:     "changed name colliding with a valid one",
+			workers:  []string{"rig_1", "rig 1"},
+			strategy: "replace",
+			want:     []string{"rig_1", "rig_1_" + HashValue("rig 1")[:6]},
+		},
+		{
+			// e.g. workers merged by a relabel rule, aggregated afterwards
+			name:     "same names",
+			workers:  []string{"rig 1", "rig 1"},
+			strategy: "replace",
+			want:     []string{"rig_1", "rig_1"},
+		},
+		{
+			name:     "dropped",
+			workers:  []string{"rig 1", "rig_1"},
+			strategy: "drop",
+			want:     []string{"rig_1"},
+		},
+		{
+			name:     "kept",
+			workers:  []string{"rig 1", "rig/1"},
+			strategy: "none",
+			want:     []string{"rig 1", "rig/1"},
+		},
+		{
+			name:          "named as the account-level series",
+			workers:       []string{"all", "rig 1"},
+			strategy:      "none",
+			accountWorker: "all",
+			want:          []string{"all_" + HashValue("all")[:6], "rig 1"},
+		},
+		{
+			name:          "changed name colliding with the account-level series",
+			workers:       []string{"all!", "all"},
+			strategy:      "replace",
+			accountWorker: "all_",
+			want:          []string{"all__" + HashValue("all!")[:6], "all"},
+		},
+		{
+			name:     "empty name without account worker label",
+			workers:  []string{"", "all"},
+			strategy: "none",
+			want:     []string{"_" + HashValue("")[:6], "all"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workers := []LabeledWorker{}
+			for _, name := range test.workers {
+				workers = append(workers, LabeledWorker{Worker: &AccountWorker{Name: name}, Label: name})
+			}
+			labels := []string{}
+			for _, worker := range SanitizeWorkers("bitcoin/test", workers, test.strategy, test.accountWorker) {
+				labels = append(labels, worker.Label)
+			}
+			if !reflect.DeepEqual(labels, test.want) {
+				t.Errorf("SanitizeWorkers(%q) = %q, want %q", test.workers, labels, test.want)
+			}
+		})
+	}
+}
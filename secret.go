@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secret references: values of the form secret:///run/secrets/foo (tokens, passwords...) are read
+// from the file, Docker secrets and Kubernetes mounted secrets. The file is read again when it
+// changes (Kubernetes rotates mounted secrets by replacing the files)
+
+const secretPrefix = "secret://"
+
+type secretFile struct {
+	value   string
+	modTime time.Time
+	size    int64
+}
+
+var secretFiles = struct {
+	sync.Mutex
+	files map[string]*secretFile
+}{files: map[string]*secretFile{}}
+
+func secretFilesLen() int {
+	secretFiles.Lock()
+	defer secretFiles.Unlock()
+	return len(secretFiles.files)
+}
+
+// ResolveSecret returns the value of a secret reference, other values are returned unchanged
+func ResolveSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, secretPrefix) {
+		return value, nil
+	}
+	path := strings.TrimPrefix(value, secretPrefix)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	secretFiles.Lock()
+	defer secretFiles.Unlock()
+	file, ok := secretFiles.files[path]
+	if ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return file.value, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	file = &secretFile{value: strings.TrimSpace(string(data)), modTime: info.ModTime(), size: info.Size()}
+	secretFiles.files[path] = file
+	return file.value, nil
+}
+
+// Secret returns the value of a secret reference, or an empty value if it cannot be read
+func Secret(value string) string {
+	resolved, err := ResolveSecret(value)
+	if err != nil {
+		log.Println("Error reading secret", strings.TrimPrefix(value, secretPrefix), ":", err)
+	}
+	RedactSecret(resolved)
+	return resolved
+}
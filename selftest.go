@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Self-test of the whole pipeline, for smoke tests after a deployment: a collection of one resource
+// (the first one by default), whose metrics are encoded and parsed back with the Prometheus text
+// parser, the expected families being checked
+//   /-/selftest?resource={currency}/{account}
+
+// Families every successful collection of a resource exports
+var selftestFamilies = []string{"f2pool_up", "f2pool_balance", "f2pool_paid", "f2pool_value", "f2pool_hashrate"}
+
+type SelftestCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+type SelftestReport struct {
+	Resource string          `json:"resource"`
+	Passed   bool            `json:"passed"`
+	Duration float64         `json:"duration_seconds"`
+	Checks   []SelftestCheck `json:"checks"`
+}
+
+func (r *SelftestReport) check(name string, err error) bool {
+	check := SelftestCheck{Name: name, Passed: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, check)
+	return err == nil
+}
+
+// Selftest collects a resource with a dedicated exporter built like the served one, its trackers
+// being new (the state of the exporter is not changed)
+func (e *F2PoolExporter) Selftest(resource string) *SelftestReport {
+	start := time.Now()
+	report := &SelftestReport{Resource: ResourceLabel(resource), Passed: true}
+	defer func() { report.Duration = time.Since(start).Seconds() }()
+
+	exporter := newF2PoolExporter(e, NewResourceSet(e.config, []string{resource}))
+	registry := prometheus.NewRegistry()
+	if !report.check("register", registry.Register(exporter)) {
+		return report
+	}
+
+	families, err := registry.Gather()
+	if !report.check("collect", err) {
+		return report
+	}
+
+	var text bytes.Buffer
+	encoder := expfmt.NewEncoder(&text, expfmt.FmtText)
+	for _, family := range families {
+		if err = encoder.Encode(family); err != nil {
+			break
+		}
+	}
+	if !report.check("encode", err) {
+		return report
+	}
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(&text)
+	if !report.check("parse", err) {
+		return report
+	}
+
+	for _, name := range selftestFamilies {
+		family, ok := parsed[name]
+		var err error
+		switch {
+		case !ok || len(family.Metric) == 0:
+			err = fmt.Errorf("family %s not exported", name)
+		case name == "f2pool_up" && family.Metric[0].GetGauge().GetValue() != 1:
+			err = fmt.Errorf("%s retrieval failed (see the exporter logs)", report.Resource)
+		}
+		report.check("family "+name, err)
+	}
+	return report
+}
+
+func (e *F2PoolExporter) serveSelftest(w http.ResponseWriter, r *http.Request) {
+	// The resource is given with the label value of its account, like the JSON API
+	resource := r.URL.Query().Get("resource")
+	if len(resource) == 0 {
+		resources := e.resources.All()
+		if len(resources) == 0 {
+			writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": "no resource to test"})
+			return
+		}
+		resource = ResourceLabel(resources[0])
+	}
+	if currency, account, ok := strings.Cut(resource, "/"); !ok || len(currency) == 0 || len(account) == 0 {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid resource, expected {currency}/{account}"})
+		return
+	}
+	resource, ok := e.resourceOf(resource)
+	if !ok {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": "unknown resource"})
+		return
+	}
+
+	report := e.Selftest(resource)
+	status := http.StatusOK
+	if !report.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	writeJson(w, status, report)
+}
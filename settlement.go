@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracks the payment method (PPS+, FPPS, ...) of each resource to detect settlement changes
+
+type SettlementState struct {
+	Mode    string
+	Since   time.Time
+	Changes float64
+}
+
+type SettlementTracker struct {
+	mutex  sync.Mutex
+	states map[string]*SettlementState
+}
+
+func NewSettlementTracker() *SettlementTracker {
+	return &SettlementTracker{states: map[string]*SettlementState{}}
+}
+
+// Observe records the current mode of a resource and returns its updated state
+func (t *SettlementTracker) Observe(resource string, mode string, now time.Time) SettlementState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, ok := t.states[resource]
+	if !ok {
+		state = &SettlementState{Mode: mode, Since: now}
+		t.states[resource] = state
+	} else if state.Mode != mode {
+		state.Mode = mode
+		state.Since = now
+		state.Changes++
+	}
+	return *state
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Last share age distribution: the time since the last share of every worker of an account, as a
+// histogram with the --worker-share-age-buckets buckets, for the health of a fleet at a glance (how
+// many rigs shared within a minute, ten minutes, an hour) without per-worker series. Workers
+// without last share time are not observed
+
+var f2pool_worker_last_share_age_seconds = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "worker_last_share_age_seconds"),
+	"Time since the last share of the workers of the account", []string{"currency", "account"}, nil)
+
+// ParseShareAgeBuckets parses the upper bounds of the buckets, durations separated by commas
+func ParseShareAgeBuckets(value string) ([]float64, error) {
+	buckets := []float64{}
+	for _, bucket := range strings.Split(value, ",") {
+		if bucket = strings.TrimSpace(bucket); len(bucket) == 0 {
+			continue
+		}
+		duration, err := time.ParseDuration(bucket)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid share age bucket %q", bucket)
+		}
+		buckets = append(buckets, duration.Seconds())
+	}
+	sort.Float64s(buckets)
+	return buckets, nil
+}
+
+type ShareAgeHistogram struct {
+	buckets []float64
+	counts  map[float64]uint64
+	count   uint64
+	sum     float64
+}
+
+func NewShareAgeHistogram(buckets []float64) *ShareAgeHistogram {
+	counts := make(map[float64]uint64, len(buckets))
+	for _, bucket := range buckets {
+		counts[bucket] = 0
+	}
+	return &ShareAgeHistogram{buckets: buckets, counts: counts}
+}
+
+// Observe adds the age (in seconds) of a worker last share, the bucket counts being cumulative
+func (h *ShareAgeHistogram) Observe(age float64) {
+	h.count++
+	h.sum += age
+	for _, bucket := range h.buckets {
+		if age <= bucket {
+			h.counts[bucket]++
+		}
+	}
+}
+
+func (h *ShareAgeHistogram) Metric(currency string, account string) prometheus.Metric {
+	return prometheus.MustNewConstHistogram(f2pool_worker_last_share_age_seconds, h.count, h.sum, h.counts, currency, account)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Time zones of --worker-share-timezone, the image having no zoneinfo
+	_ "time/tzdata"
+)
+
+// Worker last share times: the API answers RFC 3339 times for most currencies, but other formats
+// for some, so the layouts of --worker-share-time-layouts are tried in order, the values without
+// time zone being in --worker-share-timezone. Besides the Go layouts, unix and unixmilli parse
+// the epoch times in seconds and milliseconds. Unparsable values are logged once by currency
+
+type ShareTimeParser struct {
+	layouts  []string
+	location *time.Location
+	mutex    sync.Mutex
+	// Currencies whose unparsable values were logged
+	logged map[string]bool
+}
+
+func NewShareTimeParser(layouts string, timezone string) (*ShareTimeParser, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	parser := &ShareTimeParser{location: location, logged: map[string]bool{}}
+	for _, layout := range strings.Split(layouts, ",") {
+		if layout = strings.TrimSpace(layout); len(layout) != 0 {
+			parser.layouts = append(parser.layouts, layout)
+		}
+	}
+	return parser, nil
+}
+
+// Parse returns the last share time of a worker of a currency, false if empty or unparsable
+func (p *ShareTimeParser) Parse(currency string, value string) (time.Time, bool) {
+	if len(value) == 0 {
+		return time.Time{}, false
+	}
+	for _, layout := range p.layouts {
+		switch layout {
+		case "unix", "unixmilli":
+			epoch, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || epoch <= 0 {
+				continue
+			}
+			if layout == "unixmilli" {
+				return time.UnixMilli(epoch), true
+			}
+			return time.Unix(epoch, 0), true
+		default:
+			if t, err := time.ParseInLocation(layout, value, p.location); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.logged[currency] {
+		p.logged[currency] = true
+		log.Println("Error parsing", currency, "worker last share time", strconv.Quote(value), ": no matching layout in --worker-share-time-layouts")
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareTimeParserParse(t *testing.T) {
+	parser, err := NewShareTimeParser("2006-01-02T15:04:05Z07:00,2006-01-02 15:04:05,unix,unixmilli", "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), true},
+		{"2024-01-02T03:04:05+08:00", time.Date(2024, 1, 2, 3, 4, 5, 0, shanghai), true},
+		// Without time zone, in the configured one
+		{"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, shanghai), true},
+		{"1704164645", time.Unix(1704164645, 0), true},
+		// unix is tried first, the milliseconds value is a valid epoch in seconds too
+		{"1704164645000", time.Unix(1704164645000, 0), true},
+		{"", time.Time{}, false},
+		{"0", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parser.Parse("bitcoin", test.value)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("Parse(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestShareTimeParserUnixMilli(t *testing.T) {
+	parser, err := NewShareTimeParser("unixmilli", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := parser.Parse("bitcoin", "1704164645123"); !ok || !got.Equal(time.UnixMilli(1704164645123)) {
+		t.Errorf("Parse(1704164645123) = %v, %v, want %v", got, ok, time.UnixMilli(1704164645123))
+	}
+}
+
+func TestNewShareTimeParserInvalidTimezone(t *testing.T) {
+	if _, err := NewShareTimeParser("unix", "Nowhere/Invalid"); err == nil {
+		t.Error("NewShareTimeParser with an invalid time zone = nil error, want an error")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Sinks periodically push the gathered metrics to another system, instead of (or in addition to)
+// exposing them to be scraped
+
+type Sink interface {
+	Push(families []*dto.MetricFamily) error
+}
+
+type SinkConfig struct {
+	Name     string
+	Sink     Sink
+	Interval time.Duration
+}
+
+// RunOnce gathers the metrics once and pushes them to every sink, they are written
+// to the standard output in the text format if there is none
+func RunOnce(sinks []SinkConfig, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		log.Println("Error gathering metrics:", err)
+	}
+
+	if len(sinks) == 0 {
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(os.Stdout, family); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	failed := 0
+	for _, sink := range sinks {
+		if err := sink.Sink.Push(families); err != nil {
+			log.Println("Error pushing metrics to", sink.Name, ":", err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d pushes failed", failed, len(sinks))
+	}
+	return nil
+}
+
+// RunSink gathers and pushes the metrics every interval, it never returns
+func RunSink(name string, sink Sink, gatherer prometheus.Gatherer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Println("Error gathering metrics for", name, ":", err)
+		}
+		if len(families) != 0 {
+			if err := sink.Push(families); err != nil {
+				log.Println("Error pushing metrics to", name, ":", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// Returns the labels of a metric as a map
+func metricLabels(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+// Returns the timestamp of a metric, now if it has none
+func metricTime(metric *dto.Metric, now time.Time) time.Time {
+	if metric.TimestampMs != nil {
+		return time.Unix(0, metric.GetTimestampMs()*int64(time.Millisecond))
+	}
+	return now
+}
+
+// FlatSample is a single value of the gathered metrics, histograms and summaries being
+// flattened into their _bucket, _sum and _count (or quantile) samples as in the text format
+type FlatSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+func FlattenFamilies(families []*dto.MetricFamily, now time.Time) []FlatSample {
+	samples := []FlatSample{}
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			t := metricTime(m, now)
+			add := func(suffix string, value float64, extra ...string) {
+				labels := metricLabels(m)
+				for i := 0; i+1 < len(extra); i += 2 {
+					labels[extra[i]] = extra[i+1]
+				}
+				samples = append(samples, FlatSample{Name: name + suffix, Labels: labels, Value: value, Time: t})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					add("_bucket", float64(bucket.GetCumulativeCount()), "le", strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64))
+				}
+				add("_bucket", float64(histogram.GetSampleCount()), "le", "+Inf")
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add("", quantile.GetValue(), "quantile", strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64))
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
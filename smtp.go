@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email notification channel of the built-in alerting
+
+type SmtpConfig struct {
+	// Server address, host:port
+	Address  string   `json:"address"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Implicit TLS connection (usually on port 465), otherwise STARTTLS is used when the server supports it
+	Tls                bool `json:"tls"`
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+type SmtpNotifier struct {
+	config *SmtpConfig
+}
+
+func (n *SmtpNotifier) Notify(alert *Alert) error {
+	if len(n.config.To) == 0 {
+		return errors.New("smtp: no recipient")
+	}
+	host, _, err := net.SplitHostPort(n.config.Address)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: n.config.InsecureSkipVerify}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if n.config.Tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.config.Address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.config.Address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !n.config.Tls {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	// PLAIN authentication is refused by net/smtp on unencrypted connections (except to localhost)
+	if len(n.config.Username) != 0 {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, Secret(n.config.Password), host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.config.From); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(alert)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (n *SmtpNotifier) message(alert *Alert) []byte {
+	resource := alert.Currency + "/" + alert.Account
+	if len(alert.Worker) != 0 {
+		resource += "/" + alert.Worker
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	// The worker names come from the API: line breaks would inject headers, other characters are encoded
+	subject := fmt.Sprintf("[%s] %s %s", strings.ToUpper(alert.Status), alert.Rule, resource)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", stripLineBreaks(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n", alert.Message)
+	fmt.Fprintf(&b, "Rule: %s\r\n", alert.Rule)
+	fmt.Fprintf(&b, "Status: %s\r\n", alert.Status)
+	fmt.Fprintf(&b, "Resource: %s/%s\r\n", alert.Currency, alert.Account)
+	if len(alert.Worker) != 0 {
+		fmt.Fprintf(&b, "Worker: %s\r\n", stripLineBreaks(alert.Worker))
+	}
+	fmt.Fprintf(&b, "Value: %g\r\n", alert.Value)
+	fmt.Fprintf(&b, "Started at: %s\r\n", alert.StartsAt.Format(time.RFC3339))
+	if !alert.EndsAt.IsZero() {
+		fmt.Fprintf(&b, "Ended at: %s\r\n", alert.EndsAt.Format(time.RFC3339))
+	}
+	return b.Bytes()
+}
+
+// Replaces the CR and LF characters by spaces
+func stripLineBreaks(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
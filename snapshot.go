@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latest data collected for each resource, served by the JSON API. Snapshots are stored by
+// resource, their account being its label value (hashed with --hash-accounts) like the metrics
+
+type AccountSnapshot struct {
+	Currency                    string    `json:"currency"`
+	Account                     string    `json:"account"`
+	Balance                     float64   `json:"balance"`
+	Paid                        float64   `json:"paid"`
+	Value                       float64   `json:"value"`
+	ValueLastDay                float64   `json:"value_last_day"`
+	Algorithm                   string    `json:"algorithm,omitempty"`
+	HashrateUnit                string    `json:"hashrate_unit,omitempty"`
+	Hashrate                    float64   `json:"hashrate"`
+	HashesLastHour              float64   `json:"hashes_last_hour"`
+	HashesLastDay               float64   `json:"hashes_last_day"`
+	StaleHashesRejectedLastHour float64   `json:"stale_hashes_rejected_last_hour"`
+	StaleHashesRejectedLastDay  float64   `json:"stale_hashes_rejected_last_day"`
+	WorkersCount                int       `json:"workers_count"`
+	UpdatedAt                   time.Time `json:"updated_at"`
+
+	Workers []WorkerSnapshot `json:"-"`
+}
+
+type WorkerSnapshot struct {
+	Name                        string     `json:"name"`
+	Hashrate                    float64    `json:"hashrate"`
+	HashesLastHour              float64    `json:"hashes_last_hour"`
+	HashesLastDay               float64    `json:"hashes_last_day"`
+	StaleHashesRejectedLastHour float64    `json:"stale_hashes_rejected_last_hour"`
+	StaleHashesRejectedLastDay  float64    `json:"stale_hashes_rejected_last_day"`
+	LastShareAt                 *time.Time `json:"last_share_at"`
+}
+
+type SnapshotStore struct {
+	mutex     sync.RWMutex
+	snapshots map[string]*AccountSnapshot
+}
+
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{snapshots: map[string]*AccountSnapshot{}}
+}
+
+func (s *SnapshotStore) Set(resource string, snapshot *AccountSnapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots[resource] = snapshot
+}
+
+func (s *SnapshotStore) Delete(resource string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.snapshots, resource)
+}
+
+// Retain removes the snapshots of the resources which are not retrieved anymore
+func (s *SnapshotStore) Retain(resources []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	retained := map[string]bool{}
+	for _, resource := range resources {
+		retained[resource] = true
+	}
+	for resource := range s.snapshots {
+		if !retained[resource] {
+			delete(s.snapshots, resource)
+		}
+	}
+}
+
+func (s *SnapshotStore) Get(resource string) *AccountSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.snapshots[resource]
+}
+
+// All returns the snapshots ordered by resource
+func (s *SnapshotStore) All() []*AccountSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	resources := make([]string, 0, len(s.snapshots))
+	for resource := range s.snapshots {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	snapshots := make([]*AccountSnapshot, 0, len(resources))
+	for _, resource := range resources {
+		snapshots = append(snapshots, s.snapshots[resource])
+	}
+	return snapshots
+}
+
+// UpdatedAt returns the time of the most recent snapshot, false if there is none
+func (s *SnapshotStore) UpdatedAt() (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	updatedAt, ok := time.Time{}, false
+	for _, snapshot := range s.snapshots {
+		if !ok || snapshot.UpdatedAt.After(updatedAt) {
+			updatedAt, ok = snapshot.UpdatedAt, true
+		}
+	}
+	return updatedAt, ok
+}
+
+func (s *SnapshotStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.snapshots)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsD sink over UDP, labels being sent as DogStatsD tags or, without tags support,
+// appended to the metric name as in Graphite paths
+// Counters are sent as increments since the previous push, other values as gauges
+
+// Datagrams are kept under the usual network MTU
+const statsdMaxPacketSize = 1432
+
+type StatsdSink struct {
+	address string
+	prefix  string
+	tags    bool
+	mutex   sync.Mutex
+	// Last counter values, by series
+	counters map[string]float64
+}
+
+func NewStatsdSink(address string, prefix string, tags bool) *StatsdSink {
+	return &StatsdSink{address: address, prefix: prefix, tags: tags, counters: map[string]float64{}}
+}
+
+func (s *StatsdSink) Push(families []*dto.MetricFamily) error {
+	conn, err := net.Dial("udp", s.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var packet bytes.Buffer
+	send := func(line string) error {
+		if packet.Len() != 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() != 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+		return nil
+	}
+
+	counters := map[string]bool{}
+	for _, family := range families {
+		if family.GetType() == dto.MetricType_COUNTER {
+			counters[family.GetName()] = true
+		}
+	}
+
+	for _, sample := range FlattenFamilies(families, time.Now()) {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		name, tags := s.series(sample)
+
+		kind, value := "g", sample.Value
+		if counters[sample.Name] {
+			key := name + tags
+			previous, ok := s.counters[key]
+			s.counters[key] = sample.Value
+			// The first value is only a reference, a decrease is a counter reset
+			if !ok {
+				continue
+			}
+			kind, value = "c", sample.Value-previous
+			if value < 0 {
+				value = sample.Value
+			}
+		}
+
+		if err := send(fmt.Sprintf("%s:%g|%s%s", name, value, kind, tags)); err != nil {
+			return err
+		}
+	}
+
+	if packet.Len() != 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+// Returns the metric name and the DogStatsD tags suffix of a sample
+func (s *StatsdSink) series(sample FlatSample) (string, string) {
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	name := sample.Name
+	if len(s.prefix) != 0 {
+		name = s.prefix + "." + name
+	}
+
+	if !s.tags {
+		for _, label := range names {
+			name += "." + statsdSanitize(label) + "." + statsdSanitize(sample.Labels[label])
+		}
+		return name, ""
+	}
+
+	tags := make([]string, 0, len(names))
+	for _, label := range names {
+		tags = append(tags, statsdSanitize(label)+":"+statsdSanitize(sample.Labels[label]))
+	}
+	if len(tags) == 0 {
+		return name, ""
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+// Replaces the characters which are separators of the StatsD protocol
+func statsdSanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '@', '\n', ' ', '.':
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Lines of the datagrams received by a StatsD listener during a push
+func statsdLines(t *testing.T, conn net.PacketConn, push func() error) []string {
+	t.Helper()
+	if err := push(); err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	buffer := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		if n > statsdMaxPacketSize {
+			t.Errorf("datagram of %d bytes, want at most %d", n, statsdMaxPacketSize)
+		}
+		lines = append(lines, strings.Split(string(buffer[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestStatsdSinkPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "paid_total"}, []string{"currency"})
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hashrate"}, []string{"worker"})
+	registry.MustRegister(counter, gauge)
+	counter.WithLabelValues("bitcoin").Add(3)
+	gauge.WithLabelValues("rig 1").Set(100)
+	families := func() []*dto.MetricFamily {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return families
+	}
+
+	tests := []struct {
+		name string
+		tags bool
+		want [][]string
+	}{
+		{
+			name: "tags",
+			tags: true,
+			// The first counter value is only a reference
+			want: [][]string{
+				{"f2pool.hashrate:100|g|#worker:rig_1"},
+				{"f2pool.hashrate:100|g|#worker:rig_1", "f2pool.paid_total:2|c|#currency:bitcoin"},
+			},
+		},
+		{
+			name: "names",
+			want: [][]string{
+				{"f2pool.hashrate.worker.rig_1:100|g"},
+				{"f2pool.hashrate.worker.rig_1:100|g", "f2pool.paid_total.currency.bitcoin:2|c"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter.Reset()
+			counter.WithLabelValues("bitcoin").Add(3)
+			sink := NewStatsdSink(conn.LocalAddr().String(), "f2pool", test.tags)
+			for i, want := range test.want {
+				if i != 0 {
+					counter.WithLabelValues("bitcoin").Add(2)
+				}
+				got := statsdLines(t, conn, func() error { return sink.Push(families()) })
+				if strings.Join(got, "\n") != strings.Join(want, "\n") {
+					t.Errorf("push %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsdSinkPushSplitsPackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hashrate"}, []string{"worker"})
+	registry.MustRegister(gauge)
+	for i := 0; i < 200; i++ {
+		gauge.WithLabelValues("rig-" + strings.Repeat("x", i%10) + string(rune('a'+i%26)) + string(rune('a'+i/26))).Set(1)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewStatsdSink(conn.LocalAddr().String(), "", true)
+	if got := statsdLines(t, conn, func() error { return sink.Push(families) }); len(got) != 200 {
+		t.Errorf("received %d lines, want 200", len(got))
+	}
+}
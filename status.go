@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status page: the outcome of the last retrieval of every resource (time, HTTP status, decoding
+// error, consecutive failures, age of the data served), as HTML or JSON, so that a blank dashboard
+// can be troubleshot without reading the logs
+//   /status (JSON with ?format=json or an Accept: application/json header)
+
+const statusPath = "/status"
+
+// HttpStatusError is an API answer with an unexpected HTTP status
+type HttpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HttpStatusError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+// PayloadError is an API answer which cannot be decoded
+type PayloadError struct {
+	Err error
+}
+
+func (e *PayloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+type ResourceStatus struct {
+	Resource string `json:"resource"`
+	Backend  string `json:"backend"`
+	Paused   bool   `json:"paused"`
+	// Last retrieval, and last successful one
+	LastFetch   *time.Time `json:"last_fetch,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// HTTP status of the last retrieval, 0 if the API was not reached
+	HttpStatus          int    `json:"http_status"`
+	Error               string `json:"error,omitempty"`
+	ParseError          string `json:"parse_error,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// Age of the data served for the resource (snapshot of the last successful retrieval)
+	CacheAgeSeconds *float64 `json:"cache_age_seconds,omitempty"`
+}
+
+type StatusTracker struct {
+	mutex    sync.Mutex
+	statuses map[string]*ResourceStatus
+}
+
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{statuses: map[string]*ResourceStatus{}}
+}
+
+func (t *StatusTracker) status(resource string) *ResourceStatus {
+	status, ok := t.statuses[resource]
+	if !ok {
+		status = &ResourceStatus{Resource: resource}
+		t.statuses[resource] = status
+	}
+	return status
+}
+
+// Observe records the outcome of a retrieval of a resource
+func (t *StatusTracker) Observe(resource string, backend string, err error, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := t.status(resource)
+	status.Backend = backend
+	status.Paused = false
+	status.LastFetch = &now
+	status.Error, status.ParseError = "", ""
+	if err == nil {
+		status.LastSuccess = &now
+		status.HttpStatus = http.StatusOK
+		status.ConsecutiveFailures = 0
+		return
+	}
+
+	status.Error = err.Error()
+	status.ConsecutiveFailures++
+	status.HttpStatus = 0
+	var statusErr *HttpStatusError
+	var payloadErr *PayloadError
+	switch {
+	case errors.As(err, &statusErr):
+		status.HttpStatus = statusErr.StatusCode
+	case errors.As(err, &payloadErr):
+		// The answer was received
+		status.HttpStatus = http.StatusOK
+		status.ParseError = payloadErr.Error()
+	}
+}
+
+// ObservePaused records a resource which is not retrieved
+func (t *StatusTracker) ObservePaused(resource string, backend string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	status := t.status(resource)
+	status.Backend = backend
+	status.Paused = true
+}
+
+// All returns the statuses of the given resources, ordered by resource
+func (t *StatusTracker) All(resources []string, snapshots *SnapshotStore, now time.Time) []ResourceStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sorted := append([]string{}, resources...)
+	sort.Strings(sorted)
+	statuses := make([]ResourceStatus, 0, len(sorted))
+	for _, resource := range sorted {
+		status := ResourceStatus{Resource: resource}
+		if tracked, ok := t.statuses[resource]; ok {
+			status = *tracked
+		}
+		if snapshot := snapshots.Get(resource); snapshot != nil {
+			age := now.Sub(snapshot.UpdatedAt).Seconds()
+			status.CacheAgeSeconds = &age
+		}
+		// The account is exposed as its label value, errors included (the v1 URLs contain it)
+		if label := ResourceLabel(resource); label != resource {
+			_, user, _ := strings.Cut(resource, "/")
+			_, account, _ := strings.Cut(label, "/")
+			status.Resource = label
+			status.Error = strings.ReplaceAll(status.Error, user, account)
+			status.ParseError = strings.ReplaceAll(status.ParseError, user, account)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	},
+	"age": func(seconds *float64) string {
+		if seconds == nil {
+			return "-"
+		}
+		return (time.Duration(*seconds) * time.Second).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>F2Pool exporter status</title>
+<style>
+body { font-family: sans-serif; margin: 24px; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+.failed { color: #c00; }
+.paused { color: #888; }
+</style>
+</head>
+<body>
+<h1>F2Pool exporter status</h1>
+<table>
+<tr><th>Resource</th><th>Backend</th><th>Last fetch</th><th>Last success</th><th>HTTP status</th><th>Failures</th><th>Data age</th><th>Error</th></tr>
+{{range .}}<tr class="{{if .Paused}}paused{{else if .ConsecutiveFailures}}failed{{end}}">
+<td>{{.Resource}}</td><td>{{.Backend}}</td><td>{{time .LastFetch}}</td><td>{{time .LastSuccess}}</td>
+<td>{{if .HttpStatus}}{{.HttpStatus}}{{else}}-{{end}}</td><td>{{.ConsecutiveFailures}}</td><td>{{age .CacheAgeSeconds}}</td>
+<td>{{if .Paused}}paused{{else if .ParseError}}invalid answer: {{.ParseError}}{{else}}{{.Error}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (e *F2PoolExporter) serveStatus(w http.ResponseWriter, r *http.Request) {
+	statuses := e.statuses.All(e.resources.All(), e.snapshots, time.Now())
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJson(w, http.StatusOK, statuses)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	statusTemplate.Execute(w, statuses)
+}
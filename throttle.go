@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate limiting of the F2Pool API: when the API answers 429 (or 503) with a Retry-After header, or
+// its rate-limit headers tell the quota is exhausted, the requests are not made until the indicated
+// time, instead of being retried on the next scrape
+
+// Backoff of 429 answers without Retry-After
+const defaultThrottleBackoff = time.Minute
+
+type ApiThrottle struct {
+	mutex sync.Mutex
+	until time.Time
+	// Throttled answers of the API
+	throttled float64
+}
+
+var apiThrottle = &ApiThrottle{}
+
+// Check returns an error while the API requests are backed off
+func (t *ApiThrottle) Check() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if remaining := time.Until(t.until); remaining > 0 {
+		return fmt.Errorf("throttled by the F2Pool API, backing off for %s", remaining.Round(time.Second))
+	}
+	return nil
+}
+
+// Observe records the rate-limit state of an API answer
+func (t *ApiThrottle) Observe(resp *http.Response) {
+	now := time.Now()
+	until := time.Time{}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		until = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if until.IsZero() && resp.StatusCode == http.StatusTooManyRequests {
+			until = now.Add(defaultThrottleBackoff)
+		}
+	case resp.Header.Get("X-RateLimit-Remaining") == "0":
+		until = parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now)
+	}
+	if until.IsZero() {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		t.throttled++
+	}
+	if until.After(t.until) {
+		t.until = until
+	}
+}
+
+// State returns the count of throttled answers and the remaining backoff
+func (t *ApiThrottle) State() (float64, time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	remaining := time.Until(t.until)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return t.throttled, remaining
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Time {
+	if len(value) == 0 {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date
+	}
+	return time.Time{}
+}
+
+// X-RateLimit-Reset is either a Unix timestamp or a number of seconds
+func parseRateLimitReset(value string, now time.Time) time.Time {
+	reset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	if reset > 1e9 {
+		return time.Unix(reset, 0)
+	}
+	return now.Add(time.Duration(reset) * time.Second)
+}
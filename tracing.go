@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing of the collections: each collection is a trace, with a span by resource and a span by F2Pool
+// API request (failover retries included), exported to an OTLP/HTTP traces endpoint using the JSON
+// encoding when the collection ends, to tell which account slows the scrapes down
+// See: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+
+// Span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// Status code of the failed spans
+const spanStatusError = 2
+
+type Tracer struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+}
+
+func NewTracer(client *http.Client, endpoint string, headers map[string]string) *Tracer {
+	return &Tracer{client: client, endpoint: endpoint, headers: headers}
+}
+
+type trace struct {
+	tracer *Tracer
+	id     string
+	mutex  sync.Mutex
+	spans  []*Span
+	// Accounts and their label values, replaced in the exported spans with --hash-accounts
+	redactions []string
+}
+
+// Span of a trace, the methods of a nil span (tracing disabled) doing nothing
+type Span struct {
+	trace      *trace
+	id         string
+	parentId   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+func randomId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// StartTrace starts the root span of a new trace, the trace being exported when it ends
+func (t *Tracer) StartTrace(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return (&trace{tracer: t, id: randomId(16)}).start(name, "", spanKindInternal)
+}
+
+func (t *trace) start(name string, parentId string, kind int) *Span {
+	span := &Span{trace: t, id: randomId(8), parentId: parentId, name: name, kind: kind, start: time.Now(), attributes: map[string]string{}}
+	t.mutex.Lock()
+	t.spans = append(t.spans, span)
+	t.mutex.Unlock()
+	return span
+}
+
+// Child starts a span under the span
+func (s *Span) Child(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.trace.start(name, s.id, kind)
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.trace.mutex.Lock()
+	defer s.trace.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+// RedactAccount replaces an account with its label value in the exported trace (names, attributes,
+// errors), with --hash-accounts: the v1 API paths and the errors of their requests contain it
+func (s *Span) RedactAccount(account string) {
+	if s == nil || !*hashAccounts || len(account) == 0 {
+		return
+	}
+	s.trace.mutex.Lock()
+	defer s.trace.mutex.Unlock()
+	s.trace.redactions = append(s.trace.redactions, account, AccountLabel(account))
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.trace.mutex.Lock()
+	defer s.trace.mutex.Unlock()
+	s.err = err
+}
+
+// End ends the span, exporting the trace for a root span
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.trace.mutex.Lock()
+	s.end = time.Now()
+	s.trace.mutex.Unlock()
+	if len(s.parentId) == 0 {
+		go func() {
+			if err := s.trace.export(); err != nil {
+				log.Println("Error exporting the collection trace:", err)
+			}
+		}()
+	}
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (t *trace) export() error {
+	t.mutex.Lock()
+	redact := strings.NewReplacer(t.redactions...)
+	spans := make([]otlpSpan, 0, len(t.spans))
+	for _, span := range t.spans {
+		end := span.end
+		if end.IsZero() {
+			// Not ended with the collection, e.g. an answer body never closed
+			end = time.Now()
+		}
+		converted := otlpSpan{
+			TraceId: t.id, SpanId: span.id, ParentSpanId: span.parentId, Name: redact.Replace(span.name), Kind: span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		}
+		keys := make([]string, 0, len(span.attributes))
+		for key := range span.attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			attribute := otlpKeyValue{Key: key}
+			attribute.Value.StringValue = redact.Replace(span.attributes[key])
+			converted.Attributes = append(converted.Attributes, attribute)
+		}
+		if span.err != nil {
+			converted.Status = &otlpStatus{Code: spanStatusError, Message: redact.Replace(span.err.Error())}
+		}
+		spans = append(spans, converted)
+	}
+	t.mutex.Unlock()
+
+	serviceName := otlpKeyValue{Key: "service.name"}
+	serviceName.Value.StringValue = "f2pool-exporter"
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": []otlpKeyValue{serviceName}},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "f2pool-exporter", "version": version},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.tracer.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.tracer.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.tracer.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+type traceSpanKey struct{}
+
+// TracingTransport records a span for each request made under a resource span
+type TracingTransport struct {
+	next http.RoundTripper
+}
+
+func NewTracingTransport(next http.RoundTripper) *TracingTransport {
+	return &TracingTransport{next: next}
+}
+
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent, _ := req.Context().Value(traceSpanKey{}).(*Span)
+	if parent == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	span := parent.Child(req.Method+" "+apiEndpointName(req), spanKindClient)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	span.SetAttribute("url.path", req.URL.Path)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetError(&HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+	// The request lasts until its answer is read
+	resp.Body = &spanBody{body: resp.Body, span: span}
+	return resp, nil
+}
+
+type spanBody struct {
+	body io.ReadCloser
+	span *Span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	return b.body.Read(p)
+}
+
+func (b *spanBody) Close() error {
+	b.once.Do(b.span.End)
+	return b.body.Close()
+}
+
+// withSpan returns the context of the requests made under a span
+func withSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceSpanKey{}, span)
+}
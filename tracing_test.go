@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracingHashAccounts(t *testing.T) {
+	const address = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	label := HashValue(address)[:16]
+	tests := []struct {
+		name     string
+		hash     bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "hashed",
+			hash:     true,
+			contains: []string{`"collect bitcoin/` + label + `"`, `"/bitcoin/` + label + `"`},
+			excludes: []string{address},
+		},
+		{
+			name:     "not hashed",
+			contains: []string{`"collect bitcoin/` + address + `"`, `"/bitcoin/` + address + `"`},
+			excludes: []string{label},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFlag(t, hashAccounts, test.hash)
+			traces := make(chan string, 1)
+			collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				traces <- string(body)
+			}))
+			defer collector.Close()
+
+			exporter := newMockExporter(t, &Config{}, "bitcoin/"+address)
+			exporter.tracer = NewTracer(collector.Client(), collector.URL, nil)
+			exporter.Refresh()
+
+			select {
+			case trace := <-traces:
+				for _, value := range test.contains {
+					if !strings.Contains(trace, value) {
+						t.Errorf("trace does not contain %s: %s", value, trace)
+					}
+				}
+				for _, value := range test.excludes {
+					if strings.Contains(trace, value) {
+						t.Errorf("trace contains %s: %s", value, trace)
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no trace exported")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Traffic accounting: the bytes sent to and received from the F2Pool API are counted by resource,
+// for the sites on metered links. They are counted on the wire (compressed answers, headers
+// included as HTTP/1.1 would write them), the answers of the API cache and the retries of the
+// failover being respectively not counted and counted
+
+var f2pool_api_bytes_total = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "api", "bytes_total"),
+	"Bytes sent to (direction sent) and received from (direction received) the F2Pool API for the resource", []string{"currency", "account", "direction"}, nil)
+
+type trafficResourceKey struct{}
+
+type TrafficAccounting struct {
+	mutex sync.Mutex
+	// Bytes sent and received, by resource
+	sent     map[string]float64
+	received map[string]float64
+}
+
+var apiTraffic = &TrafficAccounting{sent: map[string]float64{}, received: map[string]float64{}}
+
+func (a *TrafficAccounting) add(counts map[string]float64, resource string, bytes int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	counts[resource] += float64(bytes)
+}
+
+func (a *TrafficAccounting) Collect(ch chan<- prometheus.Metric) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for resource, bytes := range a.sent {
+		currency, user, _ := strings.Cut(resource, "/")
+		ch <- prometheus.MustNewConstMetric(f2pool_api_bytes_total, prometheus.CounterValue, bytes, currency, AccountLabel(user), "sent")
+		ch <- prometheus.MustNewConstMetric(f2pool_api_bytes_total, prometheus.CounterValue, a.received[resource], currency, AccountLabel(user), "received")
+	}
+}
+
+// resourceTransport attributes the requests to a resource, for the TrafficTransport, and to its
+// span, for the TracingTransport
+type resourceTransport struct {
+	next     http.RoundTripper
+	resource string
+	span     *Span
+}
+
+func (t *resourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := withSpan(context.WithValue(req.Context(), trafficResourceKey{}, t.resource), t.span)
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
+
+// ResourceClient returns a client whose F2Pool API traffic is counted for the resource, and whose
+// requests are traced under the span (nil if not traced)
+func ResourceClient(client *http.Client, resource string, span *Span) *http.Client {
+	resourceClient := *client
+	resourceClient.Transport = &resourceTransport{next: client.Transport, resource: resource, span: span}
+	return &resourceClient
+}
+
+// TrafficTransport counts the bytes of the requests attributed to a resource, it wraps the
+// transport writing to the network, under the decompression
+type TrafficTransport struct {
+	next http.RoundTripper
+}
+
+func NewTrafficTransport(next http.RoundTripper) *TrafficTransport {
+	return &TrafficTransport{next: next}
+}
+
+func (t *TrafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource, ok := req.Context().Value(trafficResourceKey{}).(string)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	sent := int64(len(req.Method)+len(req.URL.RequestURI())+len(" HTTP/1.1\r\n")) + headerSize(req.Header) + int64(len("Host: \r\n")+len(req.URL.Host))
+	if req.ContentLength > 0 {
+		sent += req.ContentLength
+	}
+	apiTraffic.add(apiTraffic.sent, resource, sent)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	apiTraffic.add(apiTraffic.received, resource, int64(len("HTTP/1.1 \r\n")+len(resp.Status))+headerSize(resp.Header))
+	resp.Body = &countedBody{body: resp.Body, resource: resource}
+	return resp, nil
+}
+
+// headerSize returns the size of the headers as written by HTTP/1.1, final empty line included
+func headerSize(header http.Header) int64 {
+	size := int64(len("\r\n"))
+	for name, values := range header {
+		for _, value := range values {
+			size += int64(len(name) + len(": ") + len(value) + len("\r\n"))
+		}
+	}
+	return size
+}
+
+type countedBody struct {
+	body     io.ReadCloser
+	resource string
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		apiTraffic.add(apiTraffic.received, b.resource, int64(n))
+	}
+	return n, err
+}
+
+func (b *countedBody) Close() error {
+	return b.body.Close()
+}
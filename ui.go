@@ -0,0 +1,26 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Web dashboard: a single page served at /ui/, embedded in the binary, showing the balance and
+// hashrate of each account and a sortable table of its workers, from the JSON API, for the sites
+// without Grafana. The hashrate sparklines use the history store (--history-dir), or the values
+// the page retrieved since it was opened otherwise
+
+const uiPath = "/ui/"
+
+//go:embed ui
+var uiAssets embed.FS
+
+func RegisterUi(mux *http.ServeMux) {
+	assets, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		panic(err)
+	}
+	mux.Handle(uiPath, http.StripPrefix(uiPath, http.FileServer(http.FS(assets))))
+	mux.Handle("/ui", http.RedirectHandler(uiPath, http.StatusMovedPermanently))
+}
@@ -0,0 +1,197 @@
+// Dashboard of the exporter: accounts from the JSON API, refreshed every minute, and the workers of
+// the selected account. URLs are relative, for the exporters served behind a path prefix
+
+const refreshInterval = 60 * 1000;
+// Hashrates retrieved since the page was opened, by resource, without history store
+const pageHistory = {};
+let selected = null;
+let workers = [];
+let sort = { key: "name", asc: true };
+
+function resourceOf(account) {
+  return account.currency + "/" + account.account;
+}
+
+function formatHashrate(value, unit) {
+  const prefixes = ["", "K", "M", "G", "T", "P", "E"];
+  let i = 0;
+  while (Math.abs(value) >= 1000 && i < prefixes.length - 1) {
+    value /= 1000;
+    i++;
+  }
+  return value.toFixed(2) + " " + prefixes[i] + (unit || "H/s");
+}
+
+function formatAmount(value) {
+  return value.toLocaleString(undefined, { maximumFractionDigits: 8 });
+}
+
+function formatAge(time) {
+  if (!time) {
+    return "never";
+  }
+  const seconds = Math.max(0, (Date.now() - new Date(time).getTime()) / 1000);
+  if (seconds < 60) {
+    return Math.round(seconds) + " s ago";
+  }
+  if (seconds < 3600) {
+    return Math.round(seconds / 60) + " min ago";
+  }
+  return Math.round(seconds / 3600) + " h ago";
+}
+
+async function getJson(url, options) {
+  const resp = await fetch(url, options);
+  if (!resp.ok) {
+    const error = new Error(url + ": " + resp.status);
+    error.status = resp.status;
+    throw error;
+  }
+  return resp.json();
+}
+
+// Hashrates of the last 24 hours of a resource, from the history store if enabled
+async function hashrateHistory(account) {
+  const resource = resourceOf(account);
+  try {
+    // Without history store, the path is redirected to the metrics
+    const samples = await getJson("../api/v1/history?range=24h&resource=" + encodeURIComponent(resource), { redirect: "manual" });
+    return samples.map((sample) => sample.hashrate);
+  } catch (error) {
+    if (error.status !== 0 && error.status !== 404) {
+      throw error;
+    }
+  }
+  const points = pageHistory[resource] || (pageHistory[resource] = []);
+  points.push(account.hashrate);
+  // A day of refreshes
+  if (points.length > 1440) {
+    points.shift();
+  }
+  return points;
+}
+
+function sparkline(values) {
+  const svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+  svg.setAttribute("class", "sparkline");
+  svg.setAttribute("viewBox", "0 0 100 40");
+  svg.setAttribute("preserveAspectRatio", "none");
+  if (values.length < 2) {
+    return svg;
+  }
+  const max = Math.max(...values) || 1;
+  const points = values.map((value, i) => (i * 100) / (values.length - 1) + "," + (38 - (value / max) * 36));
+  const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+  line.setAttribute("points", points.join(" "));
+  line.setAttribute("vector-effect", "non-scaling-stroke");
+  svg.appendChild(line);
+  return svg;
+}
+
+function field(list, name, value) {
+  const dt = document.createElement("dt");
+  dt.textContent = name;
+  const dd = document.createElement("dd");
+  dd.textContent = value;
+  list.append(dt, dd);
+}
+
+async function renderAccounts(accounts) {
+  const section = document.getElementById("accounts");
+  const cards = await Promise.all(accounts.map(async (account) => {
+    const card = document.createElement("div");
+    card.className = "account" + (resourceOf(account) === selected ? " selected" : "");
+    const title = document.createElement("h3");
+    title.textContent = resourceOf(account);
+    const list = document.createElement("dl");
+    field(list, "Balance", formatAmount(account.balance) + " " + account.currency);
+    field(list, "Revenue (24h)", formatAmount(account.value_last_day) + " " + account.currency);
+    field(list, "Hashrate", formatHashrate(account.hashrate, account.hashrate_unit));
+    field(list, "Workers", account.workers_count);
+    card.append(title, list, sparkline(await hashrateHistory(account)));
+    card.addEventListener("click", () => selectAccount(account));
+    return card;
+  }));
+  section.replaceChildren(...cards);
+}
+
+async function selectAccount(account) {
+  selected = resourceOf(account);
+  document.querySelectorAll(".account").forEach((card) => {
+    card.classList.toggle("selected", card.querySelector("h3").textContent === selected);
+  });
+  const list = await getJson("../api/v1/accounts/" + selected + "/workers");
+  workers = list.map((worker) => ({
+    ...worker,
+    online: worker.hashrate > 0,
+    stale_ratio: worker.hashes_last_hour > 0 ? worker.stale_hashes_rejected_last_hour / worker.hashes_last_hour : 0,
+    unit: account.hashrate_unit,
+  }));
+  document.getElementById("workers-title").textContent = "Workers of " + selected;
+  document.getElementById("workers").hidden = false;
+  renderWorkers();
+}
+
+function renderWorkers() {
+  const sorted = [...workers].sort((a, b) => {
+    const x = a[sort.key] ?? "";
+    const y = b[sort.key] ?? "";
+    return (x < y ? -1 : x > y ? 1 : 0) * (sort.asc ? 1 : -1);
+  });
+  const rows = sorted.map((worker) => {
+    const row = document.createElement("tr");
+    const status = document.createElement("td");
+    status.textContent = worker.online ? "online" : "offline";
+    status.className = worker.online ? "online" : "offline";
+    const cells = [
+      worker.name,
+      status,
+      formatHashrate(worker.hashrate, worker.unit),
+      formatHashrate(worker.hashes_last_day / 86400, worker.unit),
+      (worker.stale_ratio * 100).toFixed(2) + " %",
+      formatAge(worker.last_share_at),
+    ];
+    for (const cell of cells) {
+      if (cell instanceof Node) {
+        row.appendChild(cell);
+      } else {
+        const td = document.createElement("td");
+        td.textContent = cell;
+        row.appendChild(td);
+      }
+    }
+    return row;
+  });
+  document.querySelector("#workers tbody").replaceChildren(...rows);
+  document.querySelectorAll("#workers th").forEach((th) => {
+    th.classList.toggle("asc", th.dataset.key === sort.key && sort.asc);
+    th.classList.toggle("desc", th.dataset.key === sort.key && !sort.asc);
+  });
+}
+
+document.querySelectorAll("#workers th").forEach((th) => {
+  th.addEventListener("click", () => {
+    sort = { key: th.dataset.key, asc: sort.key === th.dataset.key ? !sort.asc : true };
+    renderWorkers();
+  });
+});
+
+async function refresh() {
+  const error = document.getElementById("error");
+  try {
+    const accounts = await getJson("../api/v1/accounts");
+    await renderAccounts(accounts);
+    const current = accounts.find((account) => resourceOf(account) === selected) || accounts[0];
+    if (current) {
+      await selectAccount(current);
+    }
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+    error.hidden = true;
+  } catch (e) {
+    error.textContent = "Error retrieving the data: " + e.message;
+    error.hidden = false;
+  }
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// F2Pool v2 API, calls are authenticated POST requests with a JSON payload
+// See: https://www.f2pool.com/developer/api
+
+type V2Error struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *V2Error) Error() string {
+	return fmt.Sprintf("f2pool v2 API error %d: %s", e.Code, e.Msg)
+}
+
+type V2Wallet struct {
+	Currency      string  `json:"currency"`
+	Address       string  `json:"address"`
+	Threshold     float64 `json:"threshold"`
+	PaymentMethod string  `json:"payment_method"`
+}
+
+type V2MiningUser struct {
+	Name    string     `json:"mining_user_name"`
+	Wallets []V2Wallet `json:"wallets"`
+}
+
+// V2Call posts the payload to the given v2 endpoint and decodes the response in result
+func V2Call(client *http.Client, endpoint string, token string, payload interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if err := apiThrottle.Check(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", f2poolApiUrl+"v2/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	SetApiHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("F2P-API-SECRET", token)
+
+	resp, err := ApiDo(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	apiThrottle.Observe(resp)
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("f2pool v2 API %s: %w", endpoint, &HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+
+	apiErr := &V2Error{}
+	if err := json.Unmarshal(data, apiErr); err == nil && apiErr.Code != 0 {
+		return apiErr
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		LogPayload("v2 "+endpoint, string(data), err)
+		return &PayloadError{Err: err}
+	}
+	// The error fields are part of every answer
+	fields := []string{}
+	for _, field := range unknownFields(data, result) {
+		if field != "code" && field != "msg" {
+			fields = append(fields, field)
+		}
+	}
+	apiDrift.Observe("v2/"+endpoint, fields)
+	return nil
+}
+
+// FetchMiningUser returns the mining user settings (wallets, payment method) of an account
+func FetchMiningUser(client *http.Client, token string, account string) (*V2MiningUser, error) {
+	var resp struct {
+		MiningUser V2MiningUser `json:"mining_user"`
+	}
+	payload := map[string]string{"mining_user_name": account}
+	if err := V2Call(client, "mining_user/get", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.MiningUser, nil
+}
+
+// Wallet returns the wallet configured for the given currency, if any
+func (u *V2MiningUser) Wallet(currency string) *V2Wallet {
+	for i := range u.Wallets {
+		if u.Wallets[i].Currency == currency {
+			return &u.Wallets[i]
+		}
+	}
+	return nil
+}
+
+type V2HashRatePoint struct {
+	Timestamp     int64   `json:"timestamp"`
+	HashRate      float64 `json:"hash_rate"`
+	StaleHashRate float64 `json:"stale_hash_rate"`
+}
+
+// FetchHashRateHistory returns the account hashrate over the last duration seconds, one point per interval seconds
+func FetchHashRateHistory(client *http.Client, token string, currency string, account string, interval int64, duration int64) ([]V2HashRatePoint, error) {
+	var resp struct {
+		HashRateList []V2HashRatePoint `json:"hash_rate_list"`
+	}
+	payload := map[string]interface{}{
+		"currency":         currency,
+		"mining_user_name": account,
+		"interval":         interval,
+		"duration":         duration,
+	}
+	if err := V2Call(client, "hash_rate/history", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return resp.HashRateList, nil
+}
+
+type V2Transaction struct {
+	Id             int64   `json:"id"`
+	Type           string  `json:"type"`
+	ChangedBalance float64 `json:"changed_balance"`
+	CreatedAt      int64   `json:"created_at"`
+}
+
+// FetchTransactions returns the account transactions of the given type ("revenue", "payout" or "all") between two unix times
+func FetchTransactions(client *http.Client, token string, currency string, account string, kind string, start int64, end int64) ([]V2Transaction, error) {
+	var resp struct {
+		Transactions []V2Transaction `json:"transactions"`
+	}
+	payload := map[string]interface{}{
+		"currency":         currency,
+		"mining_user_name": account,
+		"type":             kind,
+		"start_time":       start,
+		"end_time":         end,
+	}
+	if err := V2Call(client, "assets/transactions/list", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Transactions, nil
+}
+
+type V2Balance struct {
+	Balance              float64 `json:"balance"`
+	ImmatureBalance      float64 `json:"immature_balance"`
+	Paid                 float64 `json:"paid"`
+	TotalIncome          float64 `json:"total_income"`
+	YesterdayIncome      float64 `json:"yesterday_income"`
+	EstimatedTodayIncome float64 `json:"estimated_today_income"`
+}
+
+// FetchBalance returns the balance and income of an account
+func FetchBalance(client *http.Client, token string, currency string, account string) (*V2Balance, error) {
+	var resp struct {
+		BalanceInfo V2Balance `json:"balance_info"`
+	}
+	payload := map[string]string{"currency": currency, "mining_user_name": account}
+	if err := V2Call(client, "assets/balance", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.BalanceInfo, nil
+}
+
+// Hashrates of an account or a worker: current, and averages of the last hour and 24 hours
+type V2HashRateInfo struct {
+	Name             string  `json:"name"`
+	HashRate         float64 `json:"hash_rate"`
+	H1HashRate       float64 `json:"h1_hash_rate"`
+	H24HashRate      float64 `json:"h24_hash_rate"`
+	H1StaleHashRate  float64 `json:"h1_stale_hash_rate"`
+	H24StaleHashRate float64 `json:"h24_stale_hash_rate"`
+	H24DelayHashRate float64 `json:"h24_delay_hash_rate"`
+	LocalHashRate    float64 `json:"local_hash_rate"`
+	H24LocalHashRate float64 `json:"h24_local_hash_rate"`
+}
+
+// FetchHashRateInfo returns the hashrates of an account
+func FetchHashRateInfo(client *http.Client, token string, currency string, account string) (*V2HashRateInfo, error) {
+	var resp struct {
+		Info V2HashRateInfo `json:"info"`
+	}
+	payload := map[string]string{"currency": currency, "mining_user_name": account}
+	if err := V2Call(client, "hash_rate/info", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Info, nil
+}
+
+type V2Worker struct {
+	HashRateInfo V2HashRateInfo `json:"hash_rate_info"`
+	// Unix time of the last share
+	LastShareAt int64  `json:"last_share_at"`
+	Status      int    `json:"status"`
+	Host        string `json:"host"`
+}
+
+// FetchWorkers returns the workers of an account
+func FetchWorkers(client *http.Client, token string, currency string, account string) ([]V2Worker, error) {
+	var resp struct {
+		Workers []V2Worker `json:"workers"`
+	}
+	payload := map[string]string{"currency": currency, "mining_user_name": account}
+	if err := V2Call(client, "hash_rate/worker/list", token, payload, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Workers, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashiCorp Vault integration: API tokens of the credentials are read from Vault secrets (KV v1
+// or v2), with token or AppRole authentication. The Vault token is renewed (or the AppRole login
+// done again) before it expires, secrets are cached for their lease duration (5 minutes by default)
+// See: https://developer.hashicorp.com/vault/api-docs
+
+type VaultConfig struct {
+	Address string `json:"address"`
+	// Vault token (token authentication), or the file it is read from
+	Token     string `json:"token"`
+	TokenFile string `json:"token_file"`
+	// AppRole authentication, the secret ID can be read from a file
+	RoleId       string `json:"role_id"`
+	SecretId     string `json:"secret_id"`
+	SecretIdFile string `json:"secret_id_file"`
+	// Mount path of the AppRole auth method, approle by default
+	ApproleMount string `json:"approle_mount"`
+	// Vault namespace (Vault Enterprise)
+	Namespace string `json:"namespace"`
+	// Cache duration of the secrets without lease, 5m by default
+	CacheTTL Duration `json:"cache_ttl"`
+}
+
+type vaultSecret struct {
+	values    map[string]interface{}
+	expiresAt time.Time
+}
+
+type VaultClient struct {
+	config *VaultConfig
+	client *http.Client
+
+	mutex sync.Mutex
+	token string
+	// Zero for tokens without expiration
+	tokenExpiresAt time.Time
+	renewable      bool
+	secrets        map[string]*vaultSecret
+}
+
+func NewVaultClient(config *VaultConfig) *VaultClient {
+	return &VaultClient{config: config, client: &http.Client{Timeout: 30 * time.Second}, secrets: map[string]*vaultSecret{}}
+}
+
+// Len returns the number of cached secrets
+func (v *VaultClient) Len() int {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return len(v.secrets)
+}
+
+// Secret returns a value of a secret, the path is the one of the HTTP API (e.g. secret/data/f2pool
+// for the f2pool secret of a KV v2 engine mounted on secret/)
+func (v *VaultClient) Secret(path string, key string) (string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	secret, ok := v.secrets[path]
+	expired := !ok || time.Now().After(secret.expiresAt)
+	cacheStats.Lookup("vault_secrets", !expired)
+	if expired {
+		var err error
+		if secret, err = v.readSecret(path); err != nil {
+			return "", err
+		}
+		v.secrets[path] = secret
+	}
+
+	value, ok := secret.values[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: no %s value in secret %s", key, path)
+	}
+	return value, nil
+}
+
+func (v *VaultClient) readSecret(path string) (*vaultSecret, error) {
+	if err := v.ensureToken(); err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err := v.call("GET", "/v1/"+strings.TrimPrefix(path, "/"), nil, &result); err != nil {
+		return nil, err
+	}
+
+	values := result.Data
+	// KV v2 secrets have their values under data, along with their metadata
+	if data, ok := result.Data["data"].(map[string]interface{}); ok {
+		if _, ok := result.Data["metadata"]; ok {
+			values = data
+		}
+	}
+
+	ttl := v.config.CacheTTL.Duration
+	if result.LeaseDuration > 0 {
+		ttl = time.Duration(result.LeaseDuration) * time.Second
+	}
+	if ttl == 0 {
+		ttl = 5 * time.Minute
+	}
+	return &vaultSecret{values: values, expiresAt: time.Now().Add(ttl)}, nil
+}
+
+// Logs in, or renews the token, when there is no token or it expires within a minute
+func (v *VaultClient) ensureToken() error {
+	if len(v.token) != 0 && (v.tokenExpiresAt.IsZero() || time.Until(v.tokenExpiresAt) > time.Minute) {
+		return nil
+	}
+
+	if len(v.token) != 0 && v.renewable {
+		if err := v.authenticate("POST", "/v1/auth/token/renew-self", map[string]string{}); err == nil {
+			return nil
+		}
+	}
+
+	if len(v.config.RoleId) != 0 {
+		secretId, err := readSecretValue(v.config.SecretId, v.config.SecretIdFile)
+		if err != nil {
+			return err
+		}
+		mount := v.config.ApproleMount
+		if len(mount) == 0 {
+			mount = "approle"
+		}
+		v.token = ""
+		return v.authenticate("POST", "/v1/auth/"+mount+"/login", map[string]string{"role_id": v.config.RoleId, "secret_id": secretId})
+	}
+
+	token, err := readSecretValue(v.config.Token, v.config.TokenFile)
+	if err != nil {
+		return err
+	}
+	if len(token) == 0 {
+		return errors.New("vault: no token or AppRole configured")
+	}
+	v.token = token
+	return v.authenticate("GET", "/v1/auth/token/lookup-self", nil)
+}
+
+// Calls a login, renewal or lookup endpoint and records the resulting token and its expiration
+func (v *VaultClient) authenticate(method string, path string, request interface{}) error {
+	var result struct {
+		Auth *struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+		// Lookup answer
+		Data *struct {
+			Ttl       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.call(method, path, request, &result); err != nil {
+		return err
+	}
+
+	ttl := 0
+	switch {
+	case result.Auth != nil:
+		v.token = result.Auth.ClientToken
+		RedactSecret(v.token)
+		ttl = result.Auth.LeaseDuration
+		v.renewable = result.Auth.Renewable
+	case result.Data != nil:
+		ttl = result.Data.Ttl
+		v.renewable = result.Data.Renewable
+	default:
+		return fmt.Errorf("vault: unexpected answer of %s", path)
+	}
+	v.tokenExpiresAt = time.Time{}
+	if ttl > 0 {
+		v.tokenExpiresAt = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	return nil
+}
+
+func (v *VaultClient) call(method string, path string, request interface{}, result interface{}) error {
+	var body *bytes.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.config.Address, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if len(v.token) != 0 {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if len(v.config.Namespace) != 0 {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: unexpected status %s for %s: %s", resp.Status, path, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Value given directly (possibly a secret reference) or read from a file
+func readSecretValue(value string, file string) (string, error) {
+	if len(file) == 0 {
+		value, err := ResolveSecret(value)
+		RedactSecret(value)
+		return value, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(string(data))
+	RedactSecret(value)
+	return value, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Fake Vault server, tokens are valid for ttl seconds and the requests are recorded
+type fakeVault struct {
+	mutex    sync.Mutex
+	ttl      int
+	requests []string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("X-Vault-Namespace") != "mining" {
+		http.Error(w, `{"errors": ["no namespace"]}`, http.StatusBadRequest)
+		return
+	}
+	token := r.Header.Get("X-Vault-Token")
+	var request map[string]string
+	json.NewDecoder(r.Body).Decode(&request)
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if request["role_id"] != "role" || request["secret_id"] != "secret-id" {
+			http.Error(w, `{"errors": ["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": f.ttl, "renewable": true},
+		})
+		return
+	case "/v1/auth/token/lookup-self":
+		if token == "root-token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": 0}})
+			return
+		}
+	case "/v1/auth/token/renew-self":
+		if token == "approle-token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": f.ttl, "renewable": true},
+			})
+			return
+		}
+	case "/v1/secret/data/f2pool":
+		if token == "root-token" || token == "approle-token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": map[string]string{"token": "v2-token"}, "metadata": map[string]int{"version": 1}},
+			})
+			return
+		}
+	case "/v1/kv/f2pool":
+		if token == "root-token" || token == "approle-token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"lease_duration": 60, "data": map[string]string{"token": "v1-token"}})
+			return
+		}
+	}
+	http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+}
+
+func (f *fakeVault) take() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	requests := f.requests
+	f.requests = nil
+	return requests
+}
+
+func TestVaultClientSecret(t *testing.T) {
+	vault := &fakeVault{}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	client := NewVaultClient(&VaultConfig{Address: server.URL + "/", Token: "root-token", Namespace: "mining"})
+	tests := []struct {
+		path     string
+		key      string
+		want     string
+		wantErr  bool
+		requests []string
+	}{
+		{"secret/data/f2pool", "token", "v2-token", false, []string{"GET /v1/auth/token/lookup-self", "GET /v1/secret/data/f2pool"}},
+		// Cached
+		{"secret/data/f2pool", "token", "v2-token", false, nil},
+		{"/kv/f2pool", "token", "v1-token", false, []string{"GET /v1/kv/f2pool"}},
+		{"/kv/f2pool", "password", "", true, nil},
+		{"secret/data/other", "token", "", true, []string{"GET /v1/secret/data/other"}},
+	}
+	for _, test := range tests {
+		got, err := client.Secret(test.path, test.key)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Secret(%s, %s) = %q, %v, want %q, error %v", test.path, test.key, got, err, test.want, test.wantErr)
+		}
+		if requests := vault.take(); strings.Join(requests, ",") != strings.Join(test.requests, ",") {
+			t.Errorf("Secret(%s, %s) requests = %v, want %v", test.path, test.key, requests, test.requests)
+		}
+	}
+}
+
+func TestVaultClientAppRole(t *testing.T) {
+	// Tokens expiring within a minute are renewed before each read
+	vault := &fakeVault{ttl: 30}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	secretIdFile := filepath.Join(t.TempDir(), "secret-id")
+	if err := os.WriteFile(secretIdFile, []byte("secret-id\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := NewVaultClient(&VaultConfig{Address: server.URL, RoleId: "role", SecretIdFile: secretIdFile, Namespace: "mining"})
+	for _, want := range [][]string{
+		{"POST /v1/auth/approle/login", "GET /v1/secret/data/f2pool"},
+		{"POST /v1/auth/token/renew-self", "GET /v1/kv/f2pool"},
+	} {
+		path := strings.TrimPrefix(want[1], "GET /v1/")
+		if _, err := client.Secret(path, "token"); err != nil {
+			t.Fatal(err)
+		}
+		if requests := vault.take(); strings.Join(requests, ",") != strings.Join(want, ",") {
+			t.Errorf("Secret(%s) requests = %v, want %v", path, requests, want)
+		}
+	}
+}
+
+func TestVaultClientNoAuthentication(t *testing.T) {
+	if _, err := NewVaultClient(&VaultConfig{Address: "http://127.0.0.1:0"}).Secret("secret/data/f2pool", "token"); err == nil {
+		t.Error("Secret without token or AppRole = nil error, want an error")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// TLS of the web server: certificate, minimum version, cipher suites and client certificate
+// authentication, to meet security policies without a reverse proxy
+
+var tlsVersions = map[string]uint16{
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+// WebTlsConfig returns the TLS configuration of the web server, the cipher suites (names of
+// crypto/tls, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) are separated by commas and only apply
+// to TLS 1.2, client certificates signed by the client CA are verified if it is set: required by
+// the handshake, or only verified when given if the client authentication is restricted to paths
+func WebTlsConfig(minVersion string, cipherSuites string, clientCaFile string, clientAuthPaths []string) (*tls.Config, error) {
+	version, ok := tlsVersions[strings.ToUpper(minVersion)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q (TLS1.2 or TLS1.3)", minVersion)
+	}
+	config := &tls.Config{MinVersion: version}
+
+	if len(cipherSuites) != 0 {
+		suites := map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(cipherSuites, ",") {
+			name = strings.TrimSpace(name)
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	if len(clientCaFile) != 0 {
+		ca, err := ioutil.ReadFile(clientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificate found in " + clientCaFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if len(clientAuthPaths) != 0 {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return config, nil
+}
+
+// RequireClientCertificate refuses the requests to the paths (prefixes) made without a verified
+// client certificate, other paths are served without
+func RequireClientCertificate(handler http.Handler, paths []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range paths {
+			if strings.HasPrefix(r.URL.Path, path) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				http.Error(w, "client certificate required", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
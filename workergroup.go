@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Worker groups: the workers whose name matches the regex of a group are aggregated in per group
+// metrics, and optionally not exported individually to reduce the cardinality of big farms
+
+type WorkerGroup struct {
+	Name string `json:"name"`
+	// Anchored regular expression matched against the worker names (after relabeling)
+	Regex *Regexp `json:"regex"`
+	// Currency and Account restrict the group to matching resources
+	Currency string `json:"currency"`
+	Account  string `json:"account"`
+	// Do not export the individual series of the workers of the group
+	Suppress bool `json:"suppress"`
+}
+
+func (g *WorkerGroup) Matches(currency string, account string, worker string) bool {
+	return (len(g.Currency) == 0 || strings.EqualFold(g.Currency, currency)) &&
+		(len(g.Account) == 0 || g.Account == account) &&
+		g.Regex != nil && g.Regex.MatchString(worker)
+}
+
+type workerGroupTotal struct {
+	WorkerSnapshot
+	workers        int
+	hashingWorkers int
+}
+
+// Aggregates of the groups of a resource, a worker belongs to the first group it matches
+type WorkerGroupTotals struct {
+	groups []WorkerGroup
+	totals map[string]*workerGroupTotal
+	// Group names in order of first appearance
+	names []string
+}
+
+func NewWorkerGroupTotals(groups []WorkerGroup) *WorkerGroupTotals {
+	return &WorkerGroupTotals{groups: groups, totals: map[string]*workerGroupTotal{}}
+}
+
+// Add adds a worker to the totals of its group and returns the group (nil if none)
+func (t *WorkerGroupTotals) Add(currency string, account string, worker *WorkerSnapshot) *WorkerGroup {
+	for i := range t.groups {
+		group := &t.groups[i]
+		if !group.Matches(currency, account, worker.Name) {
+			continue
+		}
+		total, ok := t.totals[group.Name]
+		if !ok {
+			total = &workerGroupTotal{}
+			t.totals[group.Name] = total
+			t.names = append(t.names, group.Name)
+		}
+		total.Hashrate += worker.Hashrate
+		total.HashesLastHour += worker.HashesLastHour
+		total.HashesLastDay += worker.HashesLastDay
+		total.StaleHashesRejectedLastHour += worker.StaleHashesRejectedLastHour
+		total.StaleHashesRejectedLastDay += worker.StaleHashesRejectedLastDay
+		total.workers++
+		if worker.Hashrate > 0 {
+			total.hashingWorkers++
+		}
+		return group
+	}
+	return nil
+}
+
+func (t *WorkerGroupTotals) Collect(ch chan<- prometheus.Metric, currency string, account string, algorithm string, updatedAt *time.Time) {
+	for _, name := range t.names {
+		total := t.totals[name]
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_hashrate, prometheus.GaugeValue, total.Hashrate, currency, account, name, algorithm))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_hashes_last_hour, prometheus.GaugeValue, total.HashesLastHour, currency, account, name, algorithm))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_hashes_last_day, prometheus.GaugeValue, total.HashesLastDay, currency, account, name, algorithm))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_stale_hashes_rejected_last_hour, prometheus.GaugeValue, total.StaleHashesRejectedLastHour, currency, account, name, algorithm))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_stale_hashes_rejected_last_day, prometheus.GaugeValue, total.StaleHashesRejectedLastDay, currency, account, name, algorithm))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_workers, prometheus.GaugeValue, float64(total.workers), currency, account, name))
+		ch <- WithTimestamp(updatedAt, prometheus.MustNewConstMetric(f2pool_group_hashing_workers, prometheus.GaugeValue, float64(total.hashingWorkers), currency, account, name))
+	}
+}
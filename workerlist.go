@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Worker list TTL: the account values are retrieved on every collection (or --api-cache-ttl), but
+// the worker list of a resource, much heavier for large accounts, is reused for --worker-list-ttl
+// before being retrieved again: the worker list request of the v2 backend is not made, and the
+// workers of the v1 answer are not decoded. The reused workers are the ones of the last retrieval
+
+type cachedWorkerList struct {
+	workers []AccountWorker
+	fetched time.Time
+}
+
+type WorkerListCache struct {
+	ttl   time.Duration
+	mutex sync.Mutex
+	lists map[string]cachedWorkerList
+}
+
+func NewWorkerListCache(ttl time.Duration) *WorkerListCache {
+	return &WorkerListCache{ttl: ttl, lists: map[string]cachedWorkerList{}}
+}
+
+// Len returns the number of cached worker lists
+func (c *WorkerListCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.lists)
+}
+
+// Get returns the worker list of a resource retrieved within the TTL
+func (c *WorkerListCache) Get(resource string, now time.Time) ([]AccountWorker, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	list, ok := c.lists[resource]
+	fresh := ok && now.Sub(list.fetched) < c.ttl
+	cacheStats.Lookup("worker_lists", fresh)
+	return list.workers, fresh
+}
+
+func (c *WorkerListCache) Set(resource string, workers []AccountWorker, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lists[resource] = cachedWorkerList{workers: workers, fetched: now}
+}
+
+// Retain drops the worker lists of the resources not collected anymore
+func (c *WorkerListCache) Retain(resources []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	retained := map[string]bool{}
+	for _, resource := range resources {
+		retained[resource] = true
+	}
+	for resource := range c.lists {
+		if !retained[resource] {
+			delete(c.lists, resource)
+		}
+	}
+}
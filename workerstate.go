@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Worker states: the workers of each account counted by state, for the overview panels of farm
+// dashboards. A worker is dead without share for more than --worker-dead-after (or without share time
+// nor hash in 24 hours), idle without hashrate or share for more than --worker-idle-after, degraded
+// when hashing under --worker-degraded-ratio of its 24 hours hashrate or with a high reject rate, and
+// hashing otherwise. Workers of suppressing groups are counted
+
+var workerStates = []string{"hashing", "degraded", "idle", "dead"}
+
+var f2pool_workers = prometheus.NewDesc(prometheus.BuildFQName("f2pool", "", "workers"),
+	"Workers of the account in the state (hashing, degraded, idle or dead)", []string{"currency", "account", "state"}, nil)
+
+// WorkerState returns the state of a worker, whose values are normalized
+func WorkerState(worker *WorkerSnapshot, now time.Time) string {
+	var age time.Duration
+	if worker.LastShareAt != nil {
+		age = now.Sub(*worker.LastShareAt)
+	}
+	switch {
+	case worker.LastShareAt != nil && age > *workerDeadAfter, worker.LastShareAt == nil && worker.HashesLastDay <= 0:
+		return "dead"
+	case worker.Hashrate <= 0, worker.LastShareAt != nil && age > *workerIdleAfter:
+		return "idle"
+	case RejectRateHigh(worker), worker.Hashrate < worker.HashesLastDay/86400**workerDegradedRatio:
+		return "degraded"
+	}
+	return "hashing"
+}
+
+// WorkerStateCounts counts the workers of an account by state
+type WorkerStateCounts map[string]int
+
+func NewWorkerStateCounts() WorkerStateCounts {
+	counts := WorkerStateCounts{}
+	for _, state := range workerStates {
+		counts[state] = 0
+	}
+	return counts
+}
+
+func (c WorkerStateCounts) Collect(ch chan<- prometheus.Metric, currency string, account string) {
+	for _, state := range workerStates {
+		ch <- prometheus.MustNewConstMetric(f2pool_workers, prometheus.GaugeValue, float64(c[state]), currency, account, state)
+	}
+}